@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"playground/rest-api/gomasters/config"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/migrate"
+	"playground/rest-api/gomasters/seeder"
+	"time"
+)
+
+const usage = `usage: gomasters [config flags] command [args]
+
+commands:
+  serve                               run the REST API, the default command
+  migrate up|down [-steps N]|status   apply, roll back or list the schema migrations
+  seed [-n N] [-seed S]               create N fake users
+  users list                          print all users
+  users get id                        print one user
+  users create -firstname F -lastname L -email E -age A
+  users delete id
+  import [-format csv|ndjson] [-map column=Field,...] file
+  config [print|check]                print the effective config or only validate it
+
+config flags: -config file, -env-file file and one per setting, such as -pg-host`
+
+// configCommand implements `config [print|check]`. Loading has already
+// validated the config, check only reports it.
+func configCommand(cfg *config.AppConfig, args []string) error {
+	sub := "print"
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch sub {
+	case "print":
+		return cfg.Print(os.Stdout)
+	case "check":
+		_, err := fmt.Fprintln(os.Stdout, "config OK")
+		return err
+	default:
+		return errors.New("usage: config [print|check]")
+	}
+}
+
+// migrateCommand implements `migrate up|down [-steps N]|status` on the
+// database of DB_DRIVER.
+func migrateCommand(cfg *config.AppConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down [-steps N]|status")
+	}
+	fs := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	db, ms, err := openMigrations(cfg)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		done, err := migrate.Up(db, ms)
+		for _, version := range done {
+			fmt.Println("applied", version)
+		}
+		return err
+	case "down":
+		done, err := migrate.Down(db, ms, *steps)
+		for _, version := range done {
+			fmt.Println("rolled back", version)
+		}
+		return err
+	case "status":
+		statuses, err := migrate.Statuses(db, ms)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied != nil {
+				applied = "applied " + s.Applied.Format(time.RFC3339)
+			}
+			fmt.Println(s.Version, applied)
+		}
+		return nil
+	default:
+		return errors.New("usage: migrate up|down [-steps N]|status")
+	}
+}
+
+// seedCommand implements `seed [-n N] [-seed S]`: it creates N fake users in
+// one batch, so that they get audit records and versions like created ones,
+// and prints the number of created users.
+func seedCommand(s *storage, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	n := fs.Int("n", 100, "number of users")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed, the same seed gives the same users")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	users := seeder.Users(rand.New(rand.NewSource(*seed)), *n)
+	ops := make([]*entity.BatchOperation, len(users))
+	for i, u := range users {
+		ops[i] = &entity.BatchOperation{Op: entity.BatchCreate, ID: u.ID, User: u}
+	}
+
+	results, err := s.usecase().Batch(context.Background(), ops, false)
+	if err != nil {
+		return err
+	}
+	created := 0
+	for _, r := range results {
+		if r.Error == "" {
+			created++
+		} else {
+			fmt.Fprintf(os.Stderr, "seed user %s error: %s\n", r.ID, r.Error)
+		}
+	}
+	return printJSON(map[string]int{"Created": created, "Failed": len(results) - created})
+}
+
+// usersCommand implements `users list|get|create|delete` with usecase/user,
+// so that changes are validated and audited as through the API.
+func usersCommand(s *storage, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: users list|get|create|delete")
+	}
+	ctx := context.Background()
+	uc := s.usecase()
+
+	switch args[0] {
+	case "list":
+		users, err := uc.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(users)
+	case "get":
+		if len(args) != 2 {
+			return errors.New("usage: users get id")
+		}
+		user, err := uc.GetById(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return printJSON(user)
+	case "create":
+		fs := flag.NewFlagSet("users create", flag.ContinueOnError)
+		user := entity.NewUser()
+		fs.StringVar(&user.Firstname, "firstname", "", "first name")
+		fs.StringVar(&user.Lastname, "lastname", "", "last name")
+		fs.StringVar(&user.Email, "email", "", "email")
+		fs.IntVar(&user.Age, "age", 0, "age")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		id, err := uc.Create(ctx, user)
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]string{"ID": id})
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("usage: users delete id")
+		}
+		id, err := uc.Delete(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]string{"ID": id})
+	default:
+		return errors.New("usage: users list|get|create|delete")
+	}
+}
+
+func printJSON(v interface{}) error {
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(v); err != nil {
+		return fmt.Errorf("encode output error: %v", err)
+	}
+	return nil
+}
+
+// parseCommand splits the arguments left after the config flags into the
+// command, serve by default, and its arguments.
+func parseCommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "serve", nil
+	}
+	return args[0], args[1:]
+}
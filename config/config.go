@@ -1,40 +1,321 @@
 package config
 
 import (
+	"errors"
 	"fmt"
-	"github.com/joho/godotenv"
-	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap/zapcore"
+	"math"
+	"net/url"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/logging"
+	"regexp"
+	"strings"
+	"time"
 )
 
-var appConfig *AppConfig
+// Storage drivers for DB_DRIVER.
+const (
+	DriverPostgres = "postgres"
+	DriverPgx      = "pgx"
+	DriverMemory   = "memory"
+	DriverSQLite   = "sqlite"
+)
 
+// AppConfig holds every setting. Settings tagged reload are applied by
+// Reloader without a restart.
 type AppConfig struct {
 	// Server
-	AppAddr string `envconfig:"APP_ADDR" required:"true"`
+	AppAddr string `env:"APP_ADDR" required:"true"`
+
+	// Logging. LOG_FORMAT is json or console; the first LOG_SAMPLING_INITIAL
+	// entries with the same message per second are written, then every
+	// LOG_SAMPLING_THEREAFTER-th, 0 writes all. Paths are files, stdout or stderr.
+	LogLevel              string   `env:"LOG_LEVEL" default:"info" reload:"true"`
+	LogFormat             string   `env:"LOG_FORMAT" default:"json"`
+	LogSamplingInitial    int      `env:"LOG_SAMPLING_INITIAL" default:"100"`
+	LogSamplingThereafter int      `env:"LOG_SAMPLING_THEREAFTER" default:"100"`
+	LogOutputPaths        []string `env:"LOG_OUTPUT_PATHS" default:"stderr"`
+	LogErrorOutputPaths   []string `env:"LOG_ERROR_OUTPUT_PATHS" default:"stderr"`
+	LogRedactEmails       bool     `env:"LOG_REDACT_EMAILS" default:"true"`
+
+	// AdminToken is the bearer token of the /admin routes, which are off without it.
+	AdminToken string `env:"ADMIN_TOKEN" secret:"true"`
+	// APIKeys are the X-API-Key values clients are rate limited by, other
+	// values are ignored.
+	APIKeys []string `env:"API_KEYS" secret:"true"`
+
+	// SIGHUP reloads the config; the config and env files are also checked
+	// for changes every CONFIG_WATCH_INTERVAL.
+	ConfigWatchInterval time.Duration `env:"CONFIG_WATCH_INTERVAL" default:"5s"`
+
+	// TLS, off without a certificate. TLS_CLIENT_CA_FILE turns on client
+	// certificate verification, TLS_CLIENT_AUTH is require or verify_if_given.
+	TLSCertFile       string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `env:"TLS_KEY_FILE"`
+	TLSClientCAFile   string        `env:"TLS_CLIENT_CA_FILE"`
+	TLSClientAuth     string        `env:"TLS_CLIENT_AUTH" default:"require"`
+	TLSReloadInterval time.Duration `env:"TLS_RELOAD_INTERVAL" default:"30s"`
+
+	// Storage
+	DbDriver string `env:"DB_DRIVER" default:"postgres"`
+
+	// SQLite, used by the sqlite driver
+	SqlitePath string `env:"SQLITE_PATH" default:"gomasters.db"`
+
+	// Postgres, used by the postgres and pgx drivers. DATABASE_URL is a
+	// complete connection string that replaces all PG_* settings below.
+	DatabaseURL string `env:"DATABASE_URL" secret:"dsn"`
+	PgHost      string `env:"PG_HOST"`
+	PgPort      string `env:"PG_PORT" default:"5432"`
+	PgDb        string `env:"PG_DB"`
+	PgUser      string `env:"PG_USER" default:"postgres"`
+	PgPassword  string `env:"PG_PASSWORD" secret:"true"`
+
+	// Postgres TLS and session settings
+	PgSSLMode          string        `env:"PG_SSLMODE" default:"disable"`
+	PgSSLRootCert      string        `env:"PG_SSLROOTCERT"`
+	PgSSLCert          string        `env:"PG_SSLCERT"`
+	PgSSLKey           string        `env:"PG_SSLKEY"`
+	PgApplicationName  string        `env:"PG_APPLICATION_NAME" default:"gomasters"`
+	PgConnectTimeout   time.Duration `env:"PG_CONNECT_TIMEOUT" default:"5s"`
+	PgStatementTimeout time.Duration `env:"PG_STATEMENT_TIMEOUT" default:"0s"`
+	PgSearchPath       string        `env:"PG_SEARCH_PATH"`
+
+	// pgx pool, used by the pgx driver
+	PgPoolMaxConns          int32         `env:"PG_POOL_MAX_CONNS" default:"10"`
+	PgPoolMinConns          int32         `env:"PG_POOL_MIN_CONNS" default:"0"`
+	PgPoolMaxConnLifetime   time.Duration `env:"PG_POOL_MAX_CONN_LIFETIME" default:"1h"`
+	PgPoolMaxConnIdleTime   time.Duration `env:"PG_POOL_MAX_CONN_IDLE_TIME" default:"30m"`
+	PgPoolHealthCheckPeriod time.Duration `env:"PG_POOL_HEALTH_CHECK_PERIOD" default:"1m"`
+	PgStatementCacheSize    int           `env:"PG_STATEMENT_CACHE_SIZE" default:"512"`
+
+	// Transactions of the postgres and pgx drivers
+	TxIsolation  string `env:"TX_ISOLATION" default:"read committed"`
+	TxMaxRetries int    `env:"TX_MAX_RETRIES" default:"3"`
+
+	// Batch. BATCH_MAX_BYTES bounds the request body, BATCH_MAX_SIZE the
+	// number of operations.
+	BatchAtomic   bool  `env:"BATCH_ATOMIC" default:"true" reload:"true"`
+	BatchMaxSize  int   `env:"BATCH_MAX_SIZE" default:"5000" reload:"true"`
+	BatchMaxBytes int64 `env:"BATCH_MAX_BYTES" default:"10485760" reload:"true"`
+
+	// In-process cache of GetById and GetAll
+	CacheEnabled bool          `env:"CACHE_ENABLED" default:"false"`
+	CacheSize    int           `env:"CACHE_SIZE" default:"10000"`
+	CacheTTL     time.Duration `env:"CACHE_TTL" default:"30s"`
+
+	// Cache-Control max-age of GET /users and GET /users/{id}
+	HTTPCacheMaxAge time.Duration `env:"HTTP_CACHE_MAX_AGE" default:"0s" reload:"true"`
+
+	// CORS, off without allowed origins. Origins may contain one "*",
+	// such as https://*.example.com
+	CorsAllowedOrigins   []string      `env:"CORS_ALLOWED_ORIGINS" reload:"true"`
+	CorsAllowedMethods   []string      `env:"CORS_ALLOWED_METHODS" default:"GET,POST,PUT,PATCH,DELETE" reload:"true"`
+	CorsAllowedHeaders   []string      `env:"CORS_ALLOWED_HEADERS" default:"Accept,Content-Type,Idempotency-Key,If-Modified-Since,If-None-Match,X-Actor,X-API-Key,X-Request-ID" reload:"true"`
+	CorsExposedHeaders   []string      `env:"CORS_EXPOSED_HEADERS" default:"ETag,Last-Modified,Retry-After,X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,X-Request-ID" reload:"true"`
+	CorsAllowCredentials bool          `env:"CORS_ALLOW_CREDENTIALS" default:"false" reload:"true"`
+	CorsMaxAge           time.Duration `env:"CORS_MAX_AGE" default:"10m" reload:"true"`
+
+	// Idempotency keys of POST and PATCH requests
+	IdempotencyTTL           time.Duration `env:"IDEMPOTENCY_TTL" default:"24h"`
+	IdempotencyLease         time.Duration `env:"IDEMPOTENCY_LEASE" default:"1m"`
+	IdempotencyMaxBytes      int64         `env:"IDEMPOTENCY_MAX_BYTES" default:"10485760"`
+	IdempotencyPurgeInterval time.Duration `env:"IDEMPOTENCY_PURGE_INTERVAL" default:"10m"`
+
+	// Rate limits as LIMIT/PERIOD, such as 100/1m. RATE_LIMITS sets the limits
+	// of single routes: "POST /users:10/1m,GET /users:100/1m"
+	RateLimitEnabled bool              `env:"RATE_LIMIT_ENABLED" default:"true" reload:"true"`
+	RateLimitDefault string            `env:"RATE_LIMIT_DEFAULT" default:"100/1m" reload:"true"`
+	RateLimits       map[string]string `env:"RATE_LIMITS" reload:"true"`
 
-	// Postgres
-	PgHost     string `envconfig:"PG_HOST" required:"true"`
-	PgPort     string `envconfig:"PG_PORT" default:"5432"`
-	PgDb       string `envconfig:"PG_DB" required:"true"`
-	PgUser     string `envconfig:"PG_USER" default:"postgres"`
-	PgPassword string `envconfig:"PG_PASSWORD" required:"true"`
+	// Outbox relay
+	OutboxInterval  time.Duration `env:"OUTBOX_INTERVAL" default:"1s"`
+	OutboxBatchSize int           `env:"OUTBOX_BATCH_SIZE" default:"100"`
 }
 
-func GetAppConfig(path string) (*AppConfig, error) {
-	if appConfig == nil {
-		if err := godotenv.Load(path); err != nil {
-			return nil, err
+func (c *AppConfig) validate() error {
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("LOG_LEVEL error: %v", err)
+	}
+	switch c.LogFormat {
+	case logging.FormatJSON, logging.FormatConsole:
+	default:
+		return fmt.Errorf("unknown LOG_FORMAT %q", c.LogFormat)
+	}
+
+	switch c.DbDriver {
+	case DriverPostgres, DriverPgx:
+		if c.DatabaseURL == "" && (c.PgHost == "" || c.PgDb == "" || c.PgPassword == "") {
+			return errors.New("DATABASE_URL, or PG_HOST, PG_DB and PG_PASSWORD are required by the postgres and pgx drivers")
+		}
+		switch c.PgSSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			return fmt.Errorf("unknown PG_SSLMODE %q", c.PgSSLMode)
+		}
+		if (c.PgSSLCert == "") != (c.PgSSLKey == "") {
+			return errors.New("PG_SSLCERT and PG_SSLKEY have to be set together")
+		}
+	case DriverMemory, DriverSQLite:
+	default:
+		return fmt.Errorf("unknown DB_DRIVER %q", c.DbDriver)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE have to be set together")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		return errors.New("TLS_CLIENT_CA_FILE needs TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	switch c.TLSClientAuth {
+	case "require", "verify_if_given":
+	default:
+		return fmt.Errorf("unknown TLS_CLIENT_AUTH %q", c.TLSClientAuth)
+	}
+
+	switch c.TxIsolation {
+	case "read uncommitted", "read committed", "repeatable read", "serializable":
+	default:
+		return fmt.Errorf("unknown TX_ISOLATION %q", c.TxIsolation)
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"CONFIG_WATCH_INTERVAL", c.ConfigWatchInterval},
+		{"TLS_RELOAD_INTERVAL", c.TLSReloadInterval},
+		{"CACHE_TTL", c.CacheTTL},
+		{"IDEMPOTENCY_TTL", c.IdempotencyTTL},
+		{"IDEMPOTENCY_PURGE_INTERVAL", c.IdempotencyPurgeInterval},
+		{"OUTBOX_INTERVAL", c.OutboxInterval},
+	} {
+		if d.value <= 0 {
+			return fmt.Errorf("%s has to be positive", d.key)
+		}
+	}
+	if c.CacheSize <= 0 {
+		return errors.New("CACHE_SIZE has to be positive")
+	}
+	if c.CorsAllowCredentials {
+		for _, origin := range c.CorsAllowedOrigins {
+			if origin == "*" {
+				return errors.New(`CORS_ALLOW_CREDENTIALS cannot be true with the origin "*" in CORS_ALLOWED_ORIGINS`)
+			}
+		}
+	}
+
+	if c.BatchMaxSize <= 0 || c.BatchMaxBytes <= 0 {
+		return errors.New("BATCH_MAX_SIZE and BATCH_MAX_BYTES have to be positive")
+	}
+	if c.IdempotencyLease <= 0 || c.IdempotencyLease > c.IdempotencyTTL {
+		return errors.New("IDEMPOTENCY_LEASE has to be positive and at most IDEMPOTENCY_TTL")
+	}
+	if c.IdempotencyMaxBytes <= 0 {
+		return errors.New("IDEMPOTENCY_MAX_BYTES has to be positive")
+	}
+
+	if c.RateLimitEnabled {
+		if _, _, err := c.GetRateLimits(); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		appConfig = &AppConfig{}
-		if err := envconfig.Process("", appConfig); err != nil {
-			return nil, err
+// GetRateLimits parses RATE_LIMIT_DEFAULT and the route limits of RATE_LIMITS.
+func (c *AppConfig) GetRateLimits() (entity.RateLimit, map[string]entity.RateLimit, error) {
+	def, err := entity.ParseRateLimit(c.RateLimitDefault)
+	if err != nil {
+		return entity.RateLimit{}, nil, fmt.Errorf("RATE_LIMIT_DEFAULT error: %v", err)
+	}
+
+	routes := make(map[string]entity.RateLimit, len(c.RateLimits))
+	for route, limit := range c.RateLimits {
+		if routes[route], err = entity.ParseRateLimit(limit); err != nil {
+			return entity.RateLimit{}, nil, fmt.Errorf("RATE_LIMITS error: %v", err)
 		}
 	}
-	return appConfig, nil
+	return def, routes, nil
+}
+
+// TLSEnabled tells whether the server serves HTTPS.
+func (c *AppConfig) TLSEnabled() bool {
+	return c.TLSCertFile != ""
 }
 
+// GetDbString returns DATABASE_URL, or a keyword/value connection string
+// built from the PG_* settings. It holds the password, log
+// GetRedactedDbString instead.
 func (c *AppConfig) GetDbString() string {
-	return fmt.Sprintf("user=%s password=%s host=%s port=%s database=%s sslmode=disable",
-		c.PgUser, c.PgPassword, c.PgHost, c.PgPort, c.PgDb)
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
+	return c.dbString(c.PgPassword)
+}
+
+// GetRedactedDbString is GetDbString with the password masked.
+func (c *AppConfig) GetRedactedDbString() string {
+	if c.DatabaseURL == "" {
+		return c.dbString(redacted)
+	}
+	return redactDSN(c.DatabaseURL)
+}
+
+// redactDSN masks the password of a URL or keyword/value connection string.
+func redactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" {
+		return passwordPattern.ReplaceAllString(dsn, "${1}"+redacted)
+	}
+	q := u.Query()
+	if q.Has("password") {
+		q.Set("password", redacted)
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+const redacted = "xxxxx"
+
+var passwordPattern = regexp.MustCompile(`(password\s*=\s*)('(\\.|[^'])*'|\S*)`)
+
+func (c *AppConfig) dbString(password string) string {
+	params := []string{
+		"user=" + dsnValue(c.PgUser),
+		"password=" + dsnValue(password),
+		"host=" + dsnValue(c.PgHost),
+		"port=" + dsnValue(c.PgPort),
+		"database=" + dsnValue(c.PgDb),
+		"sslmode=" + dsnValue(c.PgSSLMode),
+	}
+	optional := []struct{ key, value string }{
+		{"sslrootcert", c.PgSSLRootCert},
+		{"sslcert", c.PgSSLCert},
+		{"sslkey", c.PgSSLKey},
+		{"application_name", c.PgApplicationName},
+		{"search_path", c.PgSearchPath},
+	}
+	for _, o := range optional {
+		if o.value != "" {
+			params = append(params, o.key+"="+dsnValue(o.value))
+		}
+	}
+	// connect_timeout is in seconds, statement_timeout in milliseconds; zero disables both.
+	if c.PgConnectTimeout > 0 {
+		params = append(params, fmt.Sprintf("connect_timeout=%d", int(math.Ceil(c.PgConnectTimeout.Seconds()))))
+	}
+	if c.PgStatementTimeout > 0 {
+		params = append(params, fmt.Sprintf("statement_timeout=%d", c.PgStatementTimeout.Milliseconds()))
+	}
+	return strings.Join(params, " ")
+}
+
+// dsnValue quotes a keyword/value connection string value when it is empty
+// or has spaces, quotes or backslashes.
+func dsnValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
 }
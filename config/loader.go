@@ -0,0 +1,355 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Load builds the configuration from these sources, each one overriding the
+// ones before it:
+//
+//  1. the default tags of AppConfig
+//  2. the YAML or TOML file of -config or CONFIG_FILE, when given
+//  3. the .env file of -env-file or ENV_FILE, .env by default, when it exists
+//  4. the environment
+//  5. the flags, one per setting: -pg-host for PG_HOST
+//
+// Keys of the config file are the setting names in any case, pg_host or
+// PG_HOST. In every source KEY_FILE reads the value of KEY from a file, for
+// secrets mounted as files; setting both KEY and KEY_FILE in one source is
+// an error. Secrets only have the -…-file flag, a secret given on the command
+// line would show in the process list. Load returns the arguments left after the flags.
+func Load(args []string) (*AppConfig, []string, error) {
+	cfg, rest, _, err := load(args, os.LookupEnv)
+	return cfg, rest, err
+}
+
+// setting is an AppConfig field and its value from the sources.
+type setting struct {
+	key    string
+	field  reflect.StructField
+	value  string
+	source string
+	isSet  bool
+}
+
+func (s *setting) flagName() string {
+	return strings.ToLower(strings.ReplaceAll(s.key, "_", "-"))
+}
+
+// load also returns the config and env files it read.
+func load(args []string, lookupEnv func(string) (string, bool)) (*AppConfig, []string, []string, error) {
+	settings := appSettings()
+	byKey := make(map[string]*setting, len(settings))
+	for _, s := range settings {
+		byKey[s.key] = s
+	}
+
+	fs := flag.NewFlagSet("gomasters", flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML or TOML config file, CONFIG_FILE by default")
+	envFile := fs.String("env-file", "", "env file, ENV_FILE or .env by default")
+	flagKeys := make(map[string]string, 2*len(settings))
+	for _, s := range settings {
+		if s.field.Tag.Get("secret") == "" {
+			fs.String(s.flagName(), "", s.key)
+			flagKeys[s.flagName()] = s.key
+		}
+		fs.String(s.flagName()+"-file", "", "file holding "+s.key)
+		flagKeys[s.flagName()+"-file"] = s.key + "_FILE"
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv("CONFIG_FILE")
+	}
+	var files []string
+	if *configFile != "" {
+		files = append(files, *configFile)
+		values, err := readConfigFile(*configFile)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if err = apply(byKey, values, "config file "+*configFile); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	optional := false
+	if *envFile == "" {
+		*envFile, _ = lookupEnv("ENV_FILE")
+	}
+	if *envFile == "" {
+		*envFile, optional = ".env", true
+	}
+	values, err := godotenv.Read(*envFile)
+	if err != nil && !(optional && errors.Is(err, os.ErrNotExist)) {
+		return nil, nil, nil, fmt.Errorf("read env file error: %v", err)
+	}
+	if err == nil {
+		files = append(files, *envFile)
+	}
+	if err = apply(byKey, values, "env file "+*envFile); err != nil {
+		return nil, nil, nil, err
+	}
+
+	values = make(map[string]string)
+	for _, s := range settings {
+		for _, key := range []string{s.key, s.key + "_FILE"} {
+			if v, ok := lookupEnv(key); ok {
+				values[key] = v
+			}
+		}
+	}
+	if err = apply(byKey, values, "environment"); err != nil {
+		return nil, nil, nil, err
+	}
+
+	values = make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			values[key] = f.Value.String()
+		}
+	})
+	if err = apply(byKey, values, "flags"); err != nil {
+		return nil, nil, nil, err
+	}
+
+	cfg := &AppConfig{}
+	rv := reflect.ValueOf(cfg).Elem()
+	for i, s := range settings {
+		if !s.isSet {
+			if s.field.Tag.Get("required") == "true" {
+				return nil, nil, nil, fmt.Errorf("%s is required", s.key)
+			}
+			continue
+		}
+		if err = setValue(rv.Field(i), s.value); err != nil {
+			return nil, nil, nil, fmt.Errorf("%s from %s error: %v", s.key, s.source, err)
+		}
+	}
+
+	if err = cfg.validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, fs.Args(), files, nil
+}
+
+// appSettings lists the fields of AppConfig in order, with their defaults.
+func appSettings() []*setting {
+	t := reflect.TypeOf(AppConfig{})
+	settings := make([]*setting, t.NumField())
+	for i := range settings {
+		f := t.Field(i)
+		s := &setting{key: f.Tag.Get("env"), field: f}
+		s.value, s.isSet = f.Tag.Lookup("default")
+		if s.isSet {
+			s.source = "defaults"
+		}
+		settings[i] = s
+	}
+	return settings
+}
+
+// apply sets the values of one source. Keys may name a setting or its
+// _FILE reference.
+func apply(byKey map[string]*setting, values map[string]string, source string) error {
+	upper := make(map[string]string, len(values))
+	for key, v := range values {
+		upper[strings.ToUpper(key)] = v
+	}
+
+	for key, v := range upper {
+		s, ok := byKey[key]
+		if ok {
+			if _, dup := upper[key+"_FILE"]; dup {
+				return fmt.Errorf("%s and %s_FILE are both set in %s", key, key, source)
+			}
+			s.value, s.source, s.isSet = v, source, true
+			continue
+		}
+
+		if s, ok = byKey[strings.TrimSuffix(key, "_FILE")]; !ok || !strings.HasSuffix(key, "_FILE") {
+			return fmt.Errorf("unknown setting %s in %s", key, source)
+		}
+		secret, err := os.ReadFile(v)
+		if err != nil {
+			return fmt.Errorf("%s from %s error: %v", key, source, err)
+		}
+		s.value, s.source, s.isSet = strings.TrimRight(string(secret), "\r\n"), source, true
+	}
+	return nil
+}
+
+// readConfigFile reads a flat YAML or TOML file into setting values. Lists
+// become comma separated values and maps key:value lists, as in the
+// environment.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file error: %v", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s is neither .yaml, .yml nor .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file error: %v", err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, v := range raw {
+		values[key] = fileValue(v)
+	}
+	return values, nil
+}
+
+func fileValue(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fileValue(item)
+		}
+		return strings.Join(items, ",")
+	case map[string]interface{}:
+		items := make([]string, 0, len(v))
+		for k, item := range v {
+			items = append(items, k+":"+fileValue(item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into v; an empty raw is the zero value of every type.
+func setValue(v reflect.Value, raw string) error {
+	if raw == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(raw)))
+	case reflect.Map:
+		m := make(map[string]string)
+		for _, pair := range splitList(raw) {
+			key, value, ok := strings.Cut(pair, ":")
+			if !ok {
+				return fmt.Errorf("invalid map item %q, expected key:value", pair)
+			}
+			m[key] = value
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Print writes the effective configuration as KEY=value lines in the order
+// of AppConfig. Secrets are masked and connection strings lose their password.
+func (c *AppConfig) Print(w io.Writer) error {
+	keys, values := c.redactedValues()
+	for i, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", key, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactedValues returns the setting names and their values as printed by Print.
+func (c *AppConfig) redactedValues() ([]string, []string) {
+	settings := appSettings()
+	keys, values := make([]string, len(settings)), make([]string, len(settings))
+	rv := reflect.ValueOf(c).Elem()
+	for i, s := range settings {
+		value := formatValue(rv.Field(i))
+		switch s.field.Tag.Get("secret") {
+		case "true":
+			if value != "" {
+				value = redacted
+			}
+		case "dsn":
+			value = redactDSN(value)
+		}
+		keys[i], values[i] = s.key, value
+	}
+	return keys, values
+}
+
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Slice:
+		return strings.Join(v.Interface().([]string), ",")
+	case reflect.Map:
+		m := v.Interface().(map[string]string)
+		items := make([]string, 0, len(m))
+		for k, item := range m {
+			items = append(items, k+":"+item)
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func envOf(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	configFile := writeFile(t, dir, "config.yaml", `
+app_addr: file:1
+db_driver: memory
+cache_size: 50
+cache_ttl: 1m
+cors_allowed_origins: [https://a.example.com, https://*.example.org]
+rate_limits:
+  POST /users: 10/1m
+`)
+	envFile := writeFile(t, dir, "test.env", "CACHE_SIZE=60\nCACHE_TTL=2m\nOUTBOX_BATCH_SIZE=7\n")
+	secret := writeFile(t, dir, "pg_password", "s3cret\n")
+
+	cfg, args, _, err := load(
+		[]string{"-config", configFile, "-env-file", envFile, "-cache-ttl", "3m", "import", "users.csv"},
+		envOf(map[string]string{"CACHE_SIZE": "70", "CACHE_TTL": "4m", "PG_PASSWORD_FILE": secret, "UNRELATED": "x"}),
+	)
+	require.Nil(t, err)
+
+	assert.EqualValues(t, []string{"import", "users.csv"}, args)
+	assert.EqualValues(t, "file:1", cfg.AppAddr, "config file")
+	assert.EqualValues(t, 7, cfg.OutboxBatchSize, "env file over defaults")
+	assert.EqualValues(t, 70, cfg.CacheSize, "environment over env file")
+	assert.EqualValues(t, 3*time.Minute, cfg.CacheTTL, "flags over environment")
+	assert.EqualValues(t, "s3cret", cfg.PgPassword, "_FILE secret")
+	assert.EqualValues(t, "5432", cfg.PgPort, "default")
+	assert.EqualValues(t, []string{"https://a.example.com", "https://*.example.org"}, cfg.CorsAllowedOrigins)
+	assert.EqualValues(t, map[string]string{"POST /users": "10/1m"}, cfg.RateLimits)
+
+	var out bytes.Buffer
+	require.Nil(t, cfg.Print(&out))
+	assert.Contains(t, out.String(), "APP_ADDR=file:1\n")
+	assert.Contains(t, out.String(), "PG_PASSWORD=xxxxx\n")
+	assert.NotContains(t, out.String(), "s3cret")
+}
+
+func TestLoad_TOML(t *testing.T) {
+	configFile := writeFile(t, t.TempDir(), "config.toml", `
+APP_ADDR = "toml:1"
+DB_DRIVER = "sqlite"
+BATCH_ATOMIC = false
+DATABASE_URL = "postgres://app:secret@db/gomasters"
+
+[RATE_LIMITS]
+"GET /users" = "5/1s"
+`)
+
+	cfg, _, _, err := load([]string{"-config", configFile, "-env-file", os.DevNull}, envOf(nil))
+	require.Nil(t, err)
+
+	assert.EqualValues(t, "toml:1", cfg.AppAddr)
+	assert.False(t, cfg.BatchAtomic)
+	assert.EqualValues(t, map[string]string{"GET /users": "5/1s"}, cfg.RateLimits)
+
+	var out bytes.Buffer
+	require.Nil(t, cfg.Print(&out))
+	assert.Contains(t, out.String(), "DATABASE_URL=postgres://app:xxxxx@db/gomasters\n")
+}
+
+func TestLoad_Errors(t *testing.T) {
+	type expected struct {
+		Err string
+	}
+
+	type payload struct {
+		Args []string
+		Env  map[string]string
+	}
+
+	dir := t.TempDir()
+	secret := writeFile(t, dir, "secret", "s3cret")
+	valid := func(env map[string]string) map[string]string {
+		env["APP_ADDR"], env["DB_DRIVER"] = ":1", "memory"
+		return env
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "required",
+			expected: expected{Err: "APP_ADDR is required"},
+			payload:  payload{Env: map[string]string{"DB_DRIVER": "memory"}},
+		},
+		{
+			name:     "value and file",
+			expected: expected{Err: "PG_PASSWORD and PG_PASSWORD_FILE are both set in environment"},
+			payload:  payload{Env: valid(map[string]string{"PG_PASSWORD": "x", "PG_PASSWORD_FILE": secret})},
+		},
+		{
+			name:     "secret flag",
+			expected: expected{Err: "flag provided but not defined: -pg-password"},
+			payload:  payload{Args: []string{"-pg-password", "s3cret"}, Env: valid(map[string]string{})},
+		},
+		{
+			name:     "connection string flag",
+			expected: expected{Err: "flag provided but not defined: -database-url"},
+			payload:  payload{Args: []string{"-database-url", "postgres://app:s3cret@db/gomasters"}, Env: valid(map[string]string{})},
+		},
+		{
+			name:     "invalid value",
+			expected: expected{Err: "CACHE_SIZE from flags error"},
+			payload:  payload{Args: []string{"-cache-size", "many"}, Env: valid(map[string]string{})},
+		},
+		{
+			name:     "unknown key",
+			expected: expected{Err: "unknown setting PG_HOTS"},
+			payload:  payload{Args: []string{"-config", writeFile(t, dir, "typo.yaml", "pg_hots: localhost")}, Env: valid(map[string]string{})},
+		},
+		{
+			name:     "validation",
+			expected: expected{Err: `unknown DB_DRIVER "oracle"`},
+			payload:  payload{Env: map[string]string{"APP_ADDR": ":1", "DB_DRIVER": "oracle"}},
+		},
+		{
+			name:     "zero interval",
+			expected: expected{Err: "CONFIG_WATCH_INTERVAL has to be positive"},
+			payload:  payload{Env: valid(map[string]string{"CONFIG_WATCH_INTERVAL": "0s"})},
+		},
+		{
+			name:     "zero ttl",
+			expected: expected{Err: "IDEMPOTENCY_TTL has to be positive"},
+			payload:  payload{Env: valid(map[string]string{"IDEMPOTENCY_TTL": "0s"})},
+		},
+		{
+			name:     "zero cache size",
+			expected: expected{Err: "CACHE_SIZE has to be positive"},
+			payload:  payload{Env: valid(map[string]string{"CACHE_SIZE": "0"})},
+		},
+		{
+			name:     "any origin with credentials",
+			expected: expected{Err: "CORS_ALLOW_CREDENTIALS cannot be true"},
+			payload:  payload{Env: valid(map[string]string{"CORS_ALLOWED_ORIGINS": "*", "CORS_ALLOW_CREDENTIALS": "true"})},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, _, err := load(append([]string{"-env-file", os.DevNull}, test.payload.Args...), envOf(test.payload.Env))
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), test.expected.Err)
+			}
+		})
+	}
+}
+
+func TestLoad_SecretFileFlag(t *testing.T) {
+	secret := writeFile(t, t.TempDir(), "pg_password", "s3cret\n")
+
+	cfg, _, _, err := load([]string{"-env-file", os.DevNull, "-pg-password-file", secret},
+		envOf(map[string]string{"APP_ADDR": ":1", "DB_DRIVER": "memory"}))
+	require.Nil(t, err)
+
+	assert.EqualValues(t, "s3cret", cfg.PgPassword)
+}
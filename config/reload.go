@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reloader holds the current configuration and replaces it when the sources
+// of Load change. Only settings tagged reload are taken over; changes of the
+// others are logged and wait for a restart. A configuration that does not
+// load or validate is rejected as a whole and the current one stays.
+type Reloader struct {
+	logger    *zap.Logger
+	args      []string
+	lookupEnv func(string) (string, bool)
+
+	mu        sync.RWMutex
+	current   *AppConfig
+	files     map[string]time.Time
+	listeners []listener
+}
+
+// listener is called on reloads that change setting, on every reload when
+// setting is empty.
+type listener struct {
+	setting string
+	fn      func(*AppConfig)
+}
+
+// settingChange is a reloadable setting taken over by a reload.
+type settingChange struct {
+	key    string
+	fields []zap.Field
+}
+
+// NewReloader starts from cfg, which has been loaded with args. Reloads read
+// the same flags again.
+func NewReloader(l *zap.Logger, cfg *AppConfig, args []string) *Reloader {
+	return &Reloader{logger: l, args: args, lookupEnv: os.LookupEnv, current: cfg}
+}
+
+// Current returns the configuration in use. It must not be modified.
+func (r *Reloader) Current() *AppConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// OnReload registers fn to be called with every new configuration, in the
+// order of registration. Listeners apply the reloadable settings they use.
+func (r *Reloader) OnReload(fn func(*AppConfig)) {
+	r.OnSettingChange("", fn)
+}
+
+// OnSettingChange registers fn like OnReload, but fn is only called when the
+// reloaded configuration changes the setting key, such as "LOG_LEVEL". A
+// listener applying a setting that can also be changed at runtime uses it,
+// so that reloads changing other settings do not undo the runtime change.
+func (r *Reloader) OnSettingChange(key string, fn func(*AppConfig)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, listener{setting: key, fn: fn})
+}
+
+// Run reloads on SIGHUP and when the config or env file is modified, checked
+// every interval, until ctx is done. A zero interval only listens to SIGHUP.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		files := r.statFiles(r.sourceFiles())
+		r.mu.Lock()
+		r.files = files
+		r.mu.Unlock()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("SIGHUP received, reloading config")
+		case <-tick:
+			if !r.filesChanged() {
+				continue
+			}
+			r.logger.Info("config files changed, reloading config")
+		}
+
+		if _, err := r.Reload(); err != nil {
+			r.logger.Error("config reload rejected", zap.Error(err))
+		}
+	}
+}
+
+// Reload loads the configuration again and applies the changed reloadable
+// settings. It tells whether any were applied.
+func (r *Reloader) Reload() (bool, error) {
+	next, _, files, err := load(r.args, r.lookupEnv)
+	if err != nil {
+		// The watched files are taken as they are now, so that a broken
+		// file is reported once per change rather than on every check.
+		r.mu.Lock()
+		names := make([]string, 0, len(r.files))
+		for name := range r.files {
+			names = append(names, name)
+		}
+		r.files = r.statFiles(names)
+		r.mu.Unlock()
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.files = r.statFiles(files)
+	applied, changes := r.current.takeReloadable(next, r.logger)
+	if len(changes) == 0 {
+		r.mu.Unlock()
+		return false, nil
+	}
+
+	// Reloadable settings may depend on each other, such as RATE_LIMIT_ENABLED
+	// and RATE_LIMITS, so the result is checked once more before it is used.
+	if err = applied.validate(); err != nil {
+		r.mu.Unlock()
+		return false, fmt.Errorf("reloaded config error: %v", err)
+	}
+	r.current = applied
+	listeners := r.listeners
+	r.mu.Unlock()
+
+	changed := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		r.logger.Info("config changed", c.fields...)
+		changed[c.key] = true
+	}
+	for _, l := range listeners {
+		if l.setting == "" || changed[l.setting] {
+			l.fn(applied)
+		}
+	}
+	return true, nil
+}
+
+// takeReloadable returns a copy of c with the reloadable settings of next and
+// the settings it took over. Other changes are logged as waiting for a
+// restart.
+func (c *AppConfig) takeReloadable(next *AppConfig, l *zap.Logger) (*AppConfig, []settingChange) {
+	applied := *c
+	var changes []settingChange
+	currentValues, nextValues := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	_, oldValues := c.redactedValues()
+	_, newValues := next.redactedValues()
+	for i, s := range appSettings() {
+		if reflect.DeepEqual(currentValues.Field(i).Interface(), nextValues.Field(i).Interface()) {
+			continue
+		}
+
+		fields := []zap.Field{zap.String("setting", s.key), zap.String("old", oldValues[i]), zap.String("new", newValues[i])}
+		if s.field.Tag.Get("reload") != "true" {
+			l.Warn("config change needs a restart", fields...)
+			continue
+		}
+		reflect.ValueOf(&applied).Elem().Field(i).Set(nextValues.Field(i))
+		changes = append(changes, settingChange{key: s.key, fields: fields})
+	}
+	return &applied, changes
+}
+
+func (r *Reloader) sourceFiles() []string {
+	_, _, files, err := load(r.args, r.lookupEnv)
+	if err != nil {
+		return nil
+	}
+	return files
+}
+
+func (r *Reloader) filesChanged() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for name, modTime := range r.files {
+		if !modifiedAt(name).Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// statFiles records the modification times of names, the zero time for
+// missing files, which count as changed once they are back.
+func (r *Reloader) statFiles(names []string) map[string]time.Time {
+	files := make(map[string]time.Time, len(names))
+	for _, name := range names {
+		files[name] = modifiedAt(name)
+	}
+	return files
+}
+
+func modifiedAt(name string) time.Time {
+	info, err := os.Stat(name)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
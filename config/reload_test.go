@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestReloader(t *testing.T, args []string) *Reloader {
+	cfg, _, _, err := load(args, envOf(nil))
+	require.Nil(t, err)
+	r := NewReloader(zap.NewNop(), cfg, args)
+	r.lookupEnv = envOf(nil)
+	return r
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	configFile := writeFile(t, dir, "config.yaml", "app_addr: :1\ndb_driver: memory\nrate_limits:\n  POST /users: 10/1m\n")
+	r := newTestReloader(t, []string{"-config", configFile, "-env-file", os.DevNull})
+
+	var notified []*AppConfig
+	r.OnReload(func(cfg *AppConfig) { notified = append(notified, cfg) })
+
+	reloaded, err := r.Reload()
+	require.Nil(t, err)
+	assert.False(t, reloaded, "nothing has changed")
+
+	writeFile(t, dir, "config.yaml", "app_addr: :2\ndb_driver: memory\nlog_level: debug\ncors_allowed_origins: [https://a.example.com]\n")
+	reloaded, err = r.Reload()
+	require.Nil(t, err)
+	assert.True(t, reloaded)
+	assert.EqualValues(t, "debug", r.Current().LogLevel)
+	assert.EqualValues(t, []string{"https://a.example.com"}, r.Current().CorsAllowedOrigins)
+	assert.Empty(t, r.Current().RateLimits)
+	assert.EqualValues(t, ":1", r.Current().AppAddr, "APP_ADDR needs a restart")
+	if assert.Len(t, notified, 1) {
+		assert.Same(t, r.Current(), notified[0])
+	}
+
+	for name, content := range map[string]string{
+		"invalid file":  "app_addr: [",
+		"invalid value": "app_addr: :2\ndb_driver: memory\nlog_level: loud\n",
+		"invalid limits": "app_addr: :2\ndb_driver: memory\nlog_level: info\n" +
+			"rate_limit_enabled: true\nrate_limit_default: fast\n",
+	} {
+		writeFile(t, dir, "config.yaml", content)
+		reloaded, err = r.Reload()
+		assert.NotNil(t, err, name)
+		assert.False(t, reloaded, name)
+		assert.EqualValues(t, "debug", r.Current().LogLevel, name)
+	}
+	assert.Len(t, notified, 1, "rejected configs are not applied")
+}
+
+func TestReloader_RunWatchesFiles(t *testing.T) {
+	dir := t.TempDir()
+	configFile := writeFile(t, dir, "config.yaml", "app_addr: :1\ndb_driver: memory\n")
+	r := newTestReloader(t, []string{"-config", configFile, "-env-file", os.DevNull})
+
+	notified := make(chan *AppConfig, 1)
+	r.OnReload(func(cfg *AppConfig) { notified <- cfg })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	writeFile(t, dir, "config.yaml", "app_addr: :1\ndb_driver: memory\nlog_level: warn\n")
+	future := time.Now().Add(time.Minute)
+	require.Nil(t, os.Chtimes(configFile, future, future))
+
+	select {
+	case cfg := <-notified:
+		assert.EqualValues(t, "warn", cfg.LogLevel)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the changed config file was not reloaded")
+	}
+}
+
+func TestReloader_RunLogsRejectedConfigOnce(t *testing.T) {
+	dir := t.TempDir()
+	configFile := writeFile(t, dir, "config.yaml", "app_addr: :1\ndb_driver: memory\n")
+	r := newTestReloader(t, []string{"-config", configFile, "-env-file", os.DevNull})
+	core, logs := observer.New(zap.ErrorLevel)
+	r.logger = zap.New(core)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	type payload struct {
+		Content string
+		Remove  bool
+	}
+
+	tc := []struct {
+		name     string
+		expected int
+		payload  payload
+	}{
+		{
+			name:     "invalid file",
+			expected: 1,
+			payload:  payload{Content: "app_addr: ["},
+		},
+		{
+			name:     "another invalid change",
+			expected: 2,
+			payload:  payload{Content: "app_addr: :1\ndb_driver: memory\nlog_level: loud\n"},
+		},
+		{
+			name:     "removed file",
+			expected: 3,
+			payload:  payload{Remove: true},
+		},
+	}
+
+	for i, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			if test.payload.Remove {
+				require.Nil(t, os.Remove(configFile))
+			} else {
+				writeFile(t, dir, "config.yaml", test.payload.Content)
+				future := time.Now().Add(time.Duration(i+1) * time.Minute)
+				require.Nil(t, os.Chtimes(configFile, future, future))
+			}
+
+			// Many checks run meanwhile, the rejection is logged once.
+			time.Sleep(100 * time.Millisecond)
+			assert.EqualValues(t, test.expected, logs.FilterMessage("config reload rejected").Len())
+		})
+	}
+}
+
+func TestReloader_OnSettingChange(t *testing.T) {
+	dir := t.TempDir()
+	configFile := writeFile(t, dir, "config.yaml", "app_addr: :1\ndb_driver: memory\n")
+	r := newTestReloader(t, []string{"-config", configFile, "-env-file", os.DevNull})
+
+	// The level as changed at runtime, only a changed LOG_LEVEL replaces it.
+	level := zap.NewAtomicLevelAt(zap.DebugLevel)
+	r.OnSettingChange("LOG_LEVEL", func(cfg *AppConfig) {
+		require.Nil(t, level.UnmarshalText([]byte(cfg.LogLevel)))
+	})
+	reloads := 0
+	r.OnReload(func(*AppConfig) { reloads++ })
+
+	type expected struct {
+		Level   string
+		Reloads int
+	}
+
+	type payload struct {
+		Content string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "other setting",
+			expected: expected{Level: "debug", Reloads: 1},
+			payload:  payload{Content: "app_addr: :1\ndb_driver: memory\ncors_allowed_origins: [https://a.example.com]\n"},
+		},
+		{
+			name:     "log level",
+			expected: expected{Level: "warn", Reloads: 2},
+			payload:  payload{Content: "app_addr: :1\ndb_driver: memory\ncors_allowed_origins: [https://a.example.com]\nlog_level: warn\n"},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			writeFile(t, dir, "config.yaml", test.payload.Content)
+			reloaded, err := r.Reload()
+			require.Nil(t, err)
+			assert.True(t, reloaded)
+
+			assert.EqualValues(t, test.expected.Level, level.String())
+			assert.EqualValues(t, test.expected.Reloads, reloads)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"reflect"
+	"time"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// FieldChange is one changed field of a user. Before is nil for created
+// users and After is nil for deleted ones.
+type FieldChange struct {
+	Field  string
+	Before interface{}
+	After  interface{}
+}
+
+// AuditRecord tells who changed a user, how and when.
+type AuditRecord struct {
+	ID        string
+	EntityID  string
+	Action    string
+	Actor     string
+	RequestID string
+	Changes   []*FieldChange
+	Created   time.Time
+}
+
+// NewAuditRecord records the change from before to after; before is nil for
+// a create and after is nil for a delete.
+func NewAuditRecord(action, actor, requestId string, before, after *User) (*AuditRecord, error) {
+	changes, err := DiffUsers(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	entityId := ""
+	if after != nil {
+		entityId = after.ID
+	} else if before != nil {
+		entityId = before.ID
+	}
+
+	return &AuditRecord{
+		ID:        uuid.New().String(),
+		EntityID:  entityId,
+		Action:    action,
+		Actor:     actor,
+		RequestID: requestId,
+		Changes:   changes,
+		Created:   time.Now().UTC(),
+	}, nil
+}
+
+// DiffUsers lists the fields that differ between before and after in the
+// order of the User fields. Values are given as they appear in the user JSON.
+// Updated changes with every write and is left out.
+func DiffUsers(before, after *User) ([]*FieldChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*FieldChange
+	t := reflect.TypeOf(User{})
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		if name == "Updated" {
+			continue
+		}
+		b, a := beforeFields[name], afterFields[name]
+		if !reflect.DeepEqual(b, a) {
+			changes = append(changes, &FieldChange{Field: name, Before: b, After: a})
+		}
+	}
+
+	return changes, nil
+}
+
+func jsonFields(u *User) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if u == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return nil, fmt.Errorf("marshal user error: %v", err)
+	}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("unmarshal user error: %v", err)
+	}
+	return fields, nil
+}
+
+func (r *AuditRecord) String() string {
+	return fmt.Sprintf("Id > %v, action > %s, entity id > %s, actor > %s", r.ID, r.Action, r.EntityID, r.Actor)
+}
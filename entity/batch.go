@@ -0,0 +1,28 @@
+package entity
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+type BatchOperation struct {
+	Op   string
+	ID   string
+	User *User
+}
+
+type BatchResult struct {
+	Index int
+	Op    string
+	ID    string
+	Error string `json:",omitempty"`
+}
+
+func NewBatchResults(ops []*BatchOperation) []*BatchResult {
+	results := make([]*BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = &BatchResult{Index: i, Op: op.Op, ID: op.ID}
+	}
+	return results
+}
@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNotFound is wrapped by repositories when the requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+type notFoundError struct {
+	msg string
+}
+
+// NotFound returns an error with a repository specific message that still
+// matches ErrNotFound in errors.Is.
+func NotFound(msg string) error {
+	return &notFoundError{msg: msg}
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// ErrConflict is wrapped by repositories when a write breaks a unique constraint.
+var ErrConflict = errors.New("conflict")
+
+// ConflictError names the user field whose value is already taken.
+type ConflictError struct {
+	Field string
+}
+
+// Conflict returns an error for the taken field that matches ErrConflict in errors.Is.
+func Conflict(field string) error {
+	return &ConflictError{Field: field}
+}
+
+func (e *ConflictError) Error() string {
+	return "duplicate " + strings.ToLower(e.Field)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+)
+
+type Event struct {
+	ID       string
+	Type     string
+	EntityID string
+	Payload  []byte
+	Created  time.Time
+}
+
+func NewEvent(eventType, entityId string, payload []byte) *Event {
+	return &Event{
+		ID:       uuid.New().String(),
+		Type:     eventType,
+		EntityID: entityId,
+		Payload:  payload,
+		Created:  time.Now(),
+	}
+}
+
+// NewUserEvent describes a change of u. Deleted users carry only their ID.
+func NewUserEvent(eventType string, u *User) (*Event, error) {
+	var data interface{} = u
+	if eventType == EventUserDeleted {
+		data = map[string]string{"ID": u.ID}
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s event error: %v", eventType, err)
+	}
+
+	return NewEvent(eventType, u.ID, payload), nil
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("Id > %v, type > %s, entity id > %s", e.ID, e.Type, e.EntityID)
+}
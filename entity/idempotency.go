@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+// IdempotentRequest is a request made with an idempotency key. Once it has
+// been handled it holds the response, which is replayed to its retries until
+// Expires. A Status of 0 means the first request is still in progress.
+type IdempotentRequest struct {
+	Key         string
+	Caller      string
+	BodyHash    string
+	Status      int
+	ContentType string
+	Body        []byte
+	Created     time.Time
+	Expires     time.Time
+}
+
+func NewIdempotentRequest(key, caller, bodyHash string, ttl time.Duration) *IdempotentRequest {
+	now := time.Now().UTC()
+	return &IdempotentRequest{
+		Key:      key,
+		Caller:   caller,
+		BodyHash: bodyHash,
+		Created:  now,
+		Expires:  now.Add(ttl),
+	}
+}
+
+// Done reports whether the response of the request has been stored.
+func (r *IdempotentRequest) Done() bool {
+	return r.Status != 0
+}
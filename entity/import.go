@@ -0,0 +1,55 @@
+package entity
+
+import "fmt"
+
+const (
+	ImportInserted = "inserted"
+	ImportUpdated  = "updated"
+	ImportRejected = "rejected"
+)
+
+// UserReader streams users parsed from an import file. Read returns io.EOF
+// after the last row and a *RowError for a row that cannot be parsed.
+type UserReader interface {
+	Read() (line int, user *User, err error)
+}
+
+// RowError rejects a single line of an import file without stopping the import.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+type ImportRow struct {
+	Line   int
+	Email  string `json:",omitempty"`
+	Status string
+	Reason string `json:",omitempty"`
+}
+
+type ImportReport struct {
+	Inserted int
+	Updated  int
+	Rejected int
+	Rows     []*ImportRow
+}
+
+func (r *ImportReport) Add(row *ImportRow) {
+	switch row.Status {
+	case ImportInserted:
+		r.Inserted++
+	case ImportUpdated:
+		r.Updated++
+	case ImportRejected:
+		r.Rejected++
+	}
+	r.Rows = append(r.Rows, row)
+}
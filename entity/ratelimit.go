@@ -0,0 +1,103 @@
+package entity
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit allows Limit requests per Period. Tokens are refilled
+// continuously, so a client may burst up to Limit requests at once.
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRateLimit parses limits such as "100/1m" or "5/s".
+func ParseRateLimit(s string) (RateLimit, error) {
+	limit, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q is not LIMIT/PERIOD", s)
+	}
+
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has no positive limit", s)
+	}
+
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has no positive period", s)
+	}
+
+	return RateLimit{Limit: n, Period: d}, nil
+}
+
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%d/%v", l.Limit, l.Period)
+}
+
+// RateLimitResult is the outcome of taking a token. Reset is the time until
+// the bucket is full again; RetryAfter, of denied requests, the time until
+// the next token.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// TokenBucket is the state of the bucket of one client. A zero bucket is full.
+type TokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket up to now and takes a token when there is one.
+func (b *TokenBucket) Take(l RateLimit, now time.Time) RateLimitResult {
+	rate := l.rate()
+	b.Refill(l, now)
+
+	res := RateLimitResult{Limit: l.Limit}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.Tokens) / rate)
+	}
+
+	res.Remaining = int(b.Tokens)
+	res.Reset = seconds((float64(l.Limit) - b.Tokens) / rate)
+	return res
+}
+
+// Refill adds the tokens of l since the last update up to now, at most
+// Limit of them.
+func (b *TokenBucket) Refill(l RateLimit, now time.Time) {
+	if b.Updated.IsZero() {
+		b.Tokens = float64(l.Limit)
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(l.Limit), b.Tokens+elapsed*l.rate())
+	}
+	b.Updated = now
+}
+
+// Full reports whether the bucket is full at now, so that it can be dropped.
+func (b *TokenBucket) Full(l RateLimit, now time.Time) bool {
+	rate := l.rate()
+	return b.Tokens+now.Sub(b.Updated).Seconds()*rate >= float64(l.Limit)
+}
+
+func (l RateLimit) rate() float64 {
+	return float64(l.Limit) / l.Period.Seconds()
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
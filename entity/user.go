@@ -13,6 +13,8 @@ type User struct {
 	Email     string    `validate:"required,email" json:"Email"`
 	Age       int       `validate:"required,numeric,gte=0,lte=100" json:"Age"`
 	Created   time.Time `validate:"required"`
+	// Updated is set on every write and drives the HTTP cache validators.
+	Updated time.Time
 }
 
 func NewUser() *User {
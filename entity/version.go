@@ -0,0 +1,19 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+// UserVersion is the state of a user between ValidFrom and ValidTo. The
+// current version has no ValidTo; a deleted user has no current version.
+type UserVersion struct {
+	Version   int
+	User      *User
+	ValidFrom time.Time
+	ValidTo   *time.Time `json:",omitempty"`
+}
+
+func (v *UserVersion) String() string {
+	return fmt.Sprintf("Version > %d, user > %v, valid from > %v", v.Version, v.User, v.ValidFrom)
+}
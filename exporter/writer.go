@@ -0,0 +1,113 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"playground/rest-api/gomasters/entity"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+var contentTypes = map[string]string{
+	FormatCSV:    "text/csv",
+	FormatNDJSON: "application/x-ndjson",
+	FormatXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+var header = []string{"ID", "Firstname", "Lastname", "Email", "Age", "Created"}
+
+// ageColumn is the only numeric column of header.
+const ageColumn = 4
+
+// Writer encodes users one by one, so an export never holds more than one
+// user in memory. Close must be called to flush the output.
+type Writer interface {
+	Write(u *entity.User) error
+	Close() error
+}
+
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{e: json.NewEncoder(w)}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format: %q", format)
+	}
+}
+
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// FormatByContentType returns the export format for a media type, or "" if
+// the media type cannot be exported.
+func FormatByContentType(mediaType string) string {
+	for format, contentType := range contentTypes {
+		if contentType == mediaType {
+			return format
+		}
+	}
+	return ""
+}
+
+func record(u *entity.User) []string {
+	return []string{u.ID, u.Firstname, u.Lastname, u.Email, strconv.Itoa(u.Age), u.Created.Format(time.RFC3339)}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return nil, fmt.Errorf("write csv header error: %v", err)
+	}
+
+	return &csvWriter{w: cw}, nil
+}
+
+func (c *csvWriter) Write(u *entity.User) error {
+	return c.w.Write(record(u))
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	e *json.Encoder
+}
+
+// ndjsonUser has the columns of header, so that new User fields do not change the export.
+type ndjsonUser struct {
+	ID        string
+	Firstname string
+	Lastname  string
+	Email     string
+	Age       int
+	Created   time.Time
+}
+
+func (n *ndjsonWriter) Write(u *entity.User) error {
+	return n.e.Encode(ndjsonUser{
+		ID: u.ID, Firstname: u.Firstname, Lastname: u.Lastname, Email: u.Email, Age: u.Age, Created: u.Created,
+	})
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
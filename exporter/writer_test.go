@@ -0,0 +1,144 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"playground/rest-api/gomasters/entity"
+	"testing"
+	"time"
+)
+
+func TestNewWriter(t *testing.T) {
+	type expected struct {
+		Output string
+		Err    error
+	}
+
+	type payload struct {
+		Format string
+		Users  []*entity.User
+	}
+
+	users := []*entity.User{
+		{
+			ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+			Firstname: "FirstUser",
+			Lastname:  "LastNameA",
+			Email:     "user1@gmail.com",
+			Age:       20,
+			Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:        "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c",
+			Firstname: "Second<User>",
+			Lastname:  "LastNameB",
+			Email:     "user2@gmail.com",
+			Age:       21,
+			Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "csv",
+			expected: expected{
+				Output: "ID,Firstname,Lastname,Email,Age,Created\n" +
+					"1d2ef152-f440-4be2-b659-46cc6dcbc966,FirstUser,LastNameA,user1@gmail.com,20,2022-05-07T00:00:00Z\n" +
+					"1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c,Second<User>,LastNameB,user2@gmail.com,21,2022-05-07T00:00:00Z\n",
+			},
+			payload: payload{
+				Format: FormatCSV,
+				Users:  users,
+			},
+		},
+		{
+			name: "ndjson",
+			expected: expected{
+				Output: `{"ID":"1d2ef152-f440-4be2-b659-46cc6dcbc966","Firstname":"FirstUser","Lastname":"LastNameA","Email":"user1@gmail.com","Age":20,"Created":"2022-05-07T00:00:00Z"}` + "\n" +
+					`{"ID":"1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c","Firstname":"Second\u003cUser\u003e","Lastname":"LastNameB","Email":"user2@gmail.com","Age":21,"Created":"2022-05-07T00:00:00Z"}` + "\n",
+			},
+			payload: payload{
+				Format: FormatNDJSON,
+				Users:  users,
+			},
+		},
+		{
+			name: "xlsx sheet",
+			expected: expected{
+				Output: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+					`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+					`<row><c t="inlineStr"><is><t>ID</t></is></c><c t="inlineStr"><is><t>Firstname</t></is></c><c t="inlineStr"><is><t>Lastname</t></is></c><c t="inlineStr"><is><t>Email</t></is></c><c t="inlineStr"><is><t>Age</t></is></c><c t="inlineStr"><is><t>Created</t></is></c></row>` +
+					`<row><c t="inlineStr"><is><t>1d2ef152-f440-4be2-b659-46cc6dcbc966</t></is></c><c t="inlineStr"><is><t>FirstUser</t></is></c><c t="inlineStr"><is><t>LastNameA</t></is></c><c t="inlineStr"><is><t>user1@gmail.com</t></is></c><c t="n"><v>20</v></c><c t="inlineStr"><is><t>2022-05-07T00:00:00Z</t></is></c></row>` +
+					`<row><c t="inlineStr"><is><t>1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c</t></is></c><c t="inlineStr"><is><t>Second&lt;User&gt;</t></is></c><c t="inlineStr"><is><t>LastNameB</t></is></c><c t="inlineStr"><is><t>user2@gmail.com</t></is></c><c t="n"><v>21</v></c><c t="inlineStr"><is><t>2022-05-07T00:00:00Z</t></is></c></row>` +
+					`</sheetData></worksheet>`,
+			},
+			payload: payload{
+				Format: FormatXLSX,
+				Users:  users,
+			},
+		},
+		{
+			name: "unsupported format",
+			expected: expected{
+				Err: errors.New("unsupported export format: \"xml\""),
+			},
+			payload: payload{
+				Format: "xml",
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, test.payload.Format)
+			if err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+				return
+			}
+
+			for _, u := range test.payload.Users {
+				assert.Nil(t, w.Write(u))
+			}
+			assert.Nil(t, w.Close())
+
+			output := buf.String()
+			if test.payload.Format == FormatXLSX {
+				output = readSheet(t, buf.Bytes())
+			}
+			assert.EqualValues(t, test.expected.Output, output)
+		})
+	}
+}
+
+func readSheet(t *testing.T, data []byte) string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if !assert.Nil(t, err) {
+		return ""
+	}
+
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+
+		rc, err := f.Open()
+		assert.Nil(t, err)
+		//goland:noinspection GoUnhandledErrorResult
+		defer rc.Close()
+
+		sheet, err := io.ReadAll(rc)
+		assert.Nil(t, err)
+		return string(sheet)
+	}
+
+	t.Error("sheet not found")
+	return ""
+}
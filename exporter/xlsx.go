@@ -0,0 +1,94 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"playground/rest-api/gomasters/entity"
+)
+
+// The parts of a minimal workbook with one sheet. The sheet itself is
+// written row by row with inline strings, so no shared string table has to
+// be kept in memory.
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Users" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, fmt.Errorf("create xlsx part %s error: %v", part.name, err)
+		}
+		if _, err = io.WriteString(f, part.content); err != nil {
+			return nil, fmt.Errorf("write xlsx part %s error: %v", part.name, err)
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, fmt.Errorf("create xlsx sheet error: %v", err)
+	}
+
+	x := &xlsxWriter{zw: zw, sheet: bufio.NewWriter(f)}
+	_, _ = x.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	x.writeRow(header, -1)
+
+	return x, nil
+}
+
+func (x *xlsxWriter) Write(u *entity.User) error {
+	x.writeRow(record(u), ageColumn)
+	return nil
+}
+
+// writeRow writes cells as inline strings, except the cell at numberColumn.
+// Errors are kept by bufio.Writer and reported by Close.
+func (x *xlsxWriter) writeRow(cells []string, numberColumn int) {
+	_, _ = x.sheet.WriteString("<row>")
+	for i, cell := range cells {
+		if i == numberColumn {
+			_, _ = x.sheet.WriteString(`<c t="n"><v>` + cell + `</v></c>`)
+			continue
+		}
+
+		_, _ = x.sheet.WriteString(`<c t="inlineStr"><is><t>`)
+		_ = xml.EscapeText(x.sheet, []byte(cell))
+		_, _ = x.sheet.WriteString(`</t></is></c>`)
+	}
+	_, _ = x.sheet.WriteString("</row>")
+}
+
+func (x *xlsxWriter) Close() error {
+	_, _ = x.sheet.WriteString("</sheetData></worksheet>")
+	if err := x.sheet.Flush(); err != nil {
+		return fmt.Errorf("write xlsx sheet error: %v", err)
+	}
+
+	return x.zw.Close()
+}
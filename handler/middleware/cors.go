@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CORSConfig is the cross-origin policy of the API. An origin may contain
+// one "*" standing for any text, such as https://*.example.com; "*" alone
+// allows every origin, but not together with AllowCredentials, which would
+// let every site make requests with the cookies of the user. "*" in
+// AllowedHeaders allows the headers the browser asks for.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+var errCORSWildcardCredentials = errors.New(`CORS origin "*" cannot be allowed with credentials`)
+
+// Validate refuses the origin "*" together with AllowCredentials.
+func (c CORSConfig) Validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return errCORSWildcardCredentials
+		}
+	}
+	return nil
+}
+
+// allowOrigin reports whether origin is allowed.
+func (c CORSConfig) allowOrigin(origin string) bool {
+	for _, a := range c.AllowedOrigins {
+		if a == "*" || strings.EqualFold(a, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(a, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeMethods are the methods tried by Options and CORS to find the routes of a path.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods lists the methods router has a route for at the path of r.
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+	for _, m := range routeMethods {
+		req := r.Clone(r.Context())
+		req.Method = m
+		var match mux.RouteMatch
+		if router.Match(req, &match) && match.MatchErr == nil {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// Options answers OPTIONS requests for every route of router with the Allow
+// header, and 404 Not Found for paths without routes. It has to be
+// registered before the other routes, because mux stops at the first path
+// that matches.
+func Options(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		methods := allowedMethods(router, r)
+		if len(methods) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// CORS adds the Access-Control-* headers to the responses for allowed
+// origins and answers their preflight requests with the methods router has
+// for the path that are also in the allowed methods. Requests of other
+// origins pass through unchanged, so the browser blocks them. The policy can
+// be replaced while serving.
+type CORS struct {
+	router *mux.Router
+
+	mu  sync.RWMutex
+	cfg CORSConfig
+}
+
+// NewCORS returns a CORS middleware that allows no origin until SetConfig.
+func NewCORS(router *mux.Router) *CORS {
+	return &CORS{router: router}
+}
+
+// SetConfig replaces the policy; without allowed origins every request
+// passes through. An invalid policy is refused and the current one kept.
+func (c *CORS) SetConfig(cfg CORSConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+	return nil
+}
+
+func (c *CORS) config() CORSConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cfg
+}
+
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := c.config()
+		if len(cfg.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowedHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+		exposedHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !cfg.allowOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The origin is echoed rather than "*", which browsers refuse
+		// together with credentials. SetConfig refuses "*" with credentials,
+		// so credentials go to listed origins and patterns only.
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if cfg.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			if exposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var methods []string
+		for _, m := range allowedMethods(c.router, r) {
+			for _, allowed := range cfg.AllowedMethods {
+				if strings.EqualFold(m, allowed) {
+					methods = append(methods, m)
+				}
+			}
+		}
+		if len(methods) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if allowedHeaders == "*" {
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			}
+		} else if allowedHeaders != "" {
+			w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		if cfg.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
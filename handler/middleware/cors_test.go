@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSConfig_Validate(t *testing.T) {
+	type expected struct {
+		Err error
+	}
+
+	type payload struct {
+		Config CORSConfig
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "any origin without credentials",
+			expected: expected{},
+			payload:  payload{Config: CORSConfig{AllowedOrigins: []string{"*"}}},
+		},
+		{
+			name:     "origin pattern with credentials",
+			expected: expected{},
+			payload:  payload{Config: CORSConfig{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}},
+		},
+		{
+			name:     "any origin with credentials",
+			expected: expected{Err: errCORSWildcardCredentials},
+			payload:  payload{Config: CORSConfig{AllowedOrigins: []string{"https://example.com", "*"}, AllowCredentials: true}},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			assert.EqualValues(t, test.expected.Err, test.payload.Config.Validate())
+
+			c := NewCORS(mux.NewRouter())
+			assert.EqualValues(t, test.expected.Err, c.SetConfig(test.payload.Config))
+		})
+	}
+}
+
+func TestCORS_Credentials(t *testing.T) {
+	type expected struct {
+		Origin      string
+		Credentials string
+	}
+
+	type payload struct {
+		Origins     []string
+		Credentials bool
+		Origin      string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "listed origin with credentials",
+			expected: expected{Origin: "https://example.com", Credentials: "true"},
+			payload:  payload{Origins: []string{"https://example.com"}, Credentials: true, Origin: "https://example.com"},
+		},
+		{
+			name:     "origin pattern with credentials",
+			expected: expected{Origin: "https://api.example.com", Credentials: "true"},
+			payload:  payload{Origins: []string{"https://*.example.com"}, Credentials: true, Origin: "https://api.example.com"},
+		},
+		{
+			name:     "any origin without credentials",
+			expected: expected{Origin: "https://evil.example.org", Credentials: ""},
+			payload:  payload{Origins: []string{"*"}, Origin: "https://evil.example.org"},
+		},
+		{
+			name:     "other origin",
+			expected: expected{Origin: "", Credentials: ""},
+			payload:  payload{Origins: []string{"https://example.com"}, Credentials: true, Origin: "https://evil.example.org"},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.HandleFunc("/users", func(w http.ResponseWriter, r *http.Request) {}).Methods(http.MethodGet)
+
+			c := NewCORS(router)
+			require.Nil(t, c.SetConfig(CORSConfig{AllowedOrigins: test.payload.Origins, AllowCredentials: test.payload.Credentials}))
+
+			r := httptest.NewRequest(http.MethodGet, "/users", nil)
+			r.Header.Set("Origin", test.payload.Origin)
+			w := httptest.NewRecorder()
+
+			c.Middleware(router).ServeHTTP(w, r)
+
+			assert.EqualValues(t, test.expected.Origin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.EqualValues(t, test.expected.Credentials, w.Header().Get("Access-Control-Allow-Credentials"))
+		})
+	}
+}
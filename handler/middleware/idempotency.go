@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/requestctx"
+	"playground/rest-api/gomasters/usecase/idempotency"
+	"strings"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replayed from an earlier request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyOptions limit the requests the idempotency middleware buffers.
+type IdempotencyOptions struct {
+	// MaxBytes is the largest request body read, larger ones get 413.
+	MaxBytes int64
+	// SkipRoutes are routes such as "POST /users/import" that stream their
+	// body and are passed through without buffering it.
+	SkipRoutes []string
+	// RenderError writes the error answers, in plain text when nil.
+	RenderError func(w http.ResponseWriter, r *http.Request, status int, msg string)
+}
+
+type Idempotency interface {
+	Begin(ctx context.Context, key, caller, bodyHash string) (*entity.IdempotentRequest, error)
+	Complete(ctx context.Context, r *entity.IdempotentRequest) error
+	Release(ctx context.Context, key, caller string) error
+}
+
+// Idempotent handles a POST or PATCH request with an Idempotency-Key header
+// once per key and caller: the response is stored and replayed to retries
+// with the same body, and a retry with another body gets 422 Unprocessable
+// Entity. Server errors are not stored, so that they can be retried.
+// The caller is a verified identity when there is one, see
+// idempotencyCaller, never the X-Actor header, so that nobody replays the
+// responses of someone else. It has to run on the router to see the route.
+func Idempotent(uc Idempotency, opts IdempotencyOptions, l *zap.Logger) func(http.Handler) http.Handler {
+	skip := make(map[string]bool, len(opts.SkipRoutes))
+	for _, route := range opts.SkipRoutes {
+		skip[route] = true
+	}
+	renderError := opts.RenderError
+	if renderError == nil {
+		renderError = func(w http.ResponseWriter, _ *http.Request, status int, msg string) {
+			http.Error(w, msg, status)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) || skip[routeName(r)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				renderError(w, r, http.StatusBadRequest, "idempotency key too long")
+				return
+			}
+
+			if opts.MaxBytes > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, opts.MaxBytes)
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil && strings.Contains(err.Error(), "request body too large") {
+				renderError(w, r, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			if err != nil {
+				renderError(w, r, http.StatusBadRequest, "read body error")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			caller, bodyHash := idempotencyCaller(r), hashRequest(r, body)
+			stored, err := uc.Begin(r.Context(), key, caller, bodyHash)
+			switch {
+			case errors.Is(err, idempotency.ErrMismatch):
+				renderError(w, r, http.StatusUnprocessableEntity, err.Error())
+				return
+			case errors.Is(err, idempotency.ErrInProgress):
+				renderError(w, r, http.StatusConflict, err.Error())
+				return
+			case err != nil:
+				l.Error("begin idempotent request error", zap.Error(err))
+				renderError(w, r, http.StatusInternalServerError, "idempotency error")
+				return
+			case stored != nil:
+				w.Header().Set("Content-Type", stored.ContentType)
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(stored.Status)
+				_, _ = w.Write(stored.Body)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				// A background context, the response has to be stored or
+				// released also when the client has gone away.
+				ctx := context.Background()
+				if p := recover(); p != nil || rec.status >= http.StatusInternalServerError {
+					if err := uc.Release(ctx, key, caller); err != nil {
+						l.Error("release idempotency key error", zap.Error(err))
+					}
+					if p != nil {
+						panic(p)
+					}
+					return
+				}
+
+				err := uc.Complete(ctx, &entity.IdempotentRequest{
+					Key: key, Caller: caller, BodyHash: bodyHash, Status: rec.status,
+					ContentType: rec.Header().Get("Content-Type"), Body: rec.body.Bytes(),
+				})
+				switch {
+				case errors.Is(err, idempotency.ErrLost):
+					l.Warn("idempotent request outlived its lease, response not stored", zap.String("key", key))
+				case err != nil:
+					l.Error("complete idempotent request error", zap.Error(err))
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// idempotencyCaller is the common name of the verified client certificate,
+// else the IP address of the client. Clients without a certificate behind
+// one NAT or proxy share that address and so their keys: they have to pick
+// keys that do not collide, UUIDs for instance.
+func idempotencyCaller(r *http.Request) string {
+	if cn := requestctx.ClientCN(r.Context()); cn != "" {
+		return "cn:" + cn
+	}
+	return "ip:" + remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hashRequest covers the method and path too, so that a key reused for
+// another route does not replay the response of the first one.
+func hashRequest(r *http.Request, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	_, _ = h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes the response through and keeps a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
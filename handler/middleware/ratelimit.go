@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/requestctx"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+)
+
+// RateLimitStore keeps the token buckets. Take has to refill and take from
+// the bucket of key atomically.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit entity.RateLimit, now time.Time) (entity.RateLimitResult, error)
+}
+
+// RateLimits holds the limit of every route, keyed by method and path
+// template such as "POST /users", and the limit of all other routes. A zero
+// limit does not limit the route.
+type RateLimits struct {
+	Default entity.RateLimit
+	Routes  map[string]entity.RateLimit
+}
+
+func (rl RateLimits) forRoute(route string) entity.RateLimit {
+	if l, ok := rl.Routes[route]; ok {
+		return l
+	}
+	return rl.Default
+}
+
+// RateLimiter gives every client a token bucket per route. The client is
+// identified by its verified client certificate, else by an X-API-Key header
+// holding one of the configured keys, else by its IP address; headers that
+// anyone can vary, such as X-Actor or an unknown key, do not give a client
+// another bucket. Every response carries the X-RateLimit-* headers; a request without a
+// token gets 429 Too Many Requests with Retry-After. A failing store lets
+// requests through. The limits can be replaced while serving.
+type RateLimiter struct {
+	store  RateLimitStore
+	logger *zap.Logger
+	// apiKeys holds the SHA-256 hashes of the known API keys, so that the
+	// keys themselves are neither compared nor kept in the store.
+	apiKeys map[string]bool
+
+	mu     sync.RWMutex
+	limits RateLimits
+}
+
+// NewRateLimiter returns a rate limiter without limits until SetLimits.
+// Clients sending one of apiKeys are limited per key.
+func NewRateLimiter(store RateLimitStore, apiKeys []string, l *zap.Logger) *RateLimiter {
+	rl := &RateLimiter{store: store, logger: l, apiKeys: make(map[string]bool, len(apiKeys))}
+	for _, key := range apiKeys {
+		rl.apiKeys[hashAPIKey(key)] = true
+	}
+	return rl
+}
+
+// SetLimits replaces the limits; zero RateLimits turn rate limiting off.
+// Buckets of the store are kept and refill at the new rate.
+func (rl *RateLimiter) SetLimits(limits RateLimits) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limits = limits
+}
+
+func (rl *RateLimiter) limitForRoute(route string) entity.RateLimit {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.limits.forRoute(route)
+}
+
+// Middleware has to run on the router, after RequestContext, to see the route.
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeName(r)
+		limit := rl.limitForRoute(route)
+		if limit.Limit == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res, err := rl.store.Take(r.Context(), route+" "+rl.clientKey(r), limit, time.Now())
+		if err != nil {
+			rl.logger.Error("rate limit store error", zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(RateLimitLimitHeader, strconv.Itoa(res.Limit))
+		w.Header().Set(RateLimitRemainingHeader, strconv.Itoa(res.Remaining))
+		w.Header().Set(RateLimitResetHeader, strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + tpl
+		}
+	}
+	return r.Method + " " + r.URL.Path
+}
+
+func (rl *RateLimiter) clientKey(r *http.Request) string {
+	if cn := requestctx.ClientCN(r.Context()); cn != "" {
+		return "cn:" + cn
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		if hash := hashAPIKey(key); rl.apiKeys[hash] {
+			return "key:" + hash
+		}
+	}
+	return "ip:" + remoteIP(r)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
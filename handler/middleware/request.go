@@ -0,0 +1,56 @@
+// Package middleware holds the HTTP middlewares shared by all routes.
+package middleware
+
+import (
+	"github.com/google/uuid"
+	"net/http"
+	"playground/rest-api/gomasters/requestctx"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	ActorHeader     = "X-Actor"
+
+	// AnonymousActor is the actor of requests without an ActorHeader.
+	AnonymousActor = "anonymous"
+
+	maxRequestIdLength = 128
+)
+
+// RequestContext puts the request ID and the actor into the request context.
+// The request ID is taken from the X-Request-ID header or generated, and is
+// sent back in the response. The actor is taken from the X-Actor header.
+// With mutual TLS the common name of the verified client certificate is
+// added too, see requestctx.ClientCN, and is the actor: a client cannot act
+// as someone else, an X-Actor header naming another actor is answered 403
+// Forbidden.
+func RequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(RequestIDHeader)
+		if requestId == "" || len(requestId) > maxRequestIdLength {
+			requestId = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestId)
+
+		ctx := requestctx.WithRequestID(r.Context(), requestId)
+		cn := ""
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cn = r.TLS.VerifiedChains[0][0].Subject.CommonName
+			ctx = requestctx.WithClientCN(ctx, cn)
+		}
+
+		actor := r.Header.Get(ActorHeader)
+		if cn != "" {
+			if actor != "" && actor != cn {
+				http.Error(w, "X-Actor does not match the client certificate", http.StatusForbidden)
+				return
+			}
+			actor = cn
+		}
+		if actor == "" {
+			actor = AnonymousActor
+		}
+		ctx = requestctx.WithActor(ctx, actor)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
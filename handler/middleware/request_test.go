@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"playground/rest-api/gomasters/requestctx"
+	"testing"
+)
+
+func TestRequestContext_Actor(t *testing.T) {
+	type expected struct {
+		Status int
+		Actor  string
+	}
+
+	type payload struct {
+		Actor    string
+		ClientCN string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "anonymous",
+			expected: expected{Status: http.StatusOK, Actor: AnonymousActor},
+			payload:  payload{},
+		},
+		{
+			name:     "actor header",
+			expected: expected{Status: http.StatusOK, Actor: "alice"},
+			payload:  payload{Actor: "alice"},
+		},
+		{
+			name:     "client certificate",
+			expected: expected{Status: http.StatusOK, Actor: "admin-panel"},
+			payload:  payload{ClientCN: "admin-panel"},
+		},
+		{
+			name:     "actor header matching the client certificate",
+			expected: expected{Status: http.StatusOK, Actor: "admin-panel"},
+			payload:  payload{Actor: "admin-panel", ClientCN: "admin-panel"},
+		},
+		{
+			name:     "actor header of someone else",
+			expected: expected{Status: http.StatusForbidden, Actor: ""},
+			payload:  payload{Actor: "alice", ClientCN: "admin-panel"},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			actor := ""
+			h := RequestContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor = requestctx.Actor(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if test.payload.Actor != "" {
+				r.Header.Set(ActorHeader, test.payload.Actor)
+			}
+			if test.payload.ClientCN != "" {
+				cert := &x509.Certificate{Subject: pkix.Name{CommonName: test.payload.ClientCN}}
+				r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			assert.EqualValues(t, test.expected.Status, w.Code)
+			assert.EqualValues(t, test.expected.Actor, actor)
+		})
+	}
+}
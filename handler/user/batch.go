@@ -0,0 +1,245 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"playground/rest-api/gomasters/entity"
+	"strconv"
+)
+
+type batchOperation struct {
+	Op string
+	ID string
+	// decodeUser decodes the user of the operation onto u, it is nil when
+	// the operation has no user.
+	decodeUser func(u *entity.User) error
+}
+
+// Batch accepts an array of create/update/delete operations in any of the
+// request formats. Update operations are applied on top of the stored user,
+// like Update does. A rolled back atomic batch is answered 422 with the
+// result of every operation.
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	//goland:noinspection GoUnhandledErrorResult
+	defer r.Body.Close()
+
+	cfg := h.config()
+	atomic := cfg.BatchAtomic
+	if param := r.URL.Query().Get("atomic"); param != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(param); err != nil {
+			h.logger.Error("atomic parameter error", zap.Error(err))
+			render(w, r, "atomic parameter error")
+			return
+		}
+	}
+
+	c := requestCodec(r.Header.Get("Content-Type"))
+	if c == nil {
+		h.logger.Error("decode batch error", zap.Error(errUnsupportedMediaType))
+		renderStatus(w, r, http.StatusUnsupportedMediaType, "unsupported content type")
+		return
+	}
+
+	body := io.Reader(r.Body)
+	if cfg.BatchMaxBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, cfg.BatchMaxBytes)
+	}
+	raw, err := decodeBatch(body, c, cfg.BatchMaxSize)
+	if errors.Is(err, errBatchTooLarge) || tooLarge(err) {
+		h.logger.Error("batch too large", zap.Error(err))
+		renderStatus(w, r, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("batch too large, max size is %d operations and %d bytes", cfg.BatchMaxSize, cfg.BatchMaxBytes))
+		return
+	}
+	if err != nil {
+		h.logger.Error("decode batch error", zap.Error(err))
+		render(w, r, "decode batch error")
+		return
+	}
+
+	// The stored users of all updates are read at once, decoding an update on
+	// top of them like Update does.
+	var ids []string
+	for _, rawOp := range raw {
+		if rawOp.Op == entity.BatchUpdate && checkUUID(rawOp.ID) == nil {
+			ids = append(ids, rawOp.ID)
+		}
+	}
+	stored, err := h.uc.GetByIds(r.Context(), ids)
+	if err != nil {
+		h.logger.Error("batch get users error", zap.Error(err))
+		renderStatus(w, r, http.StatusInternalServerError, "batch get users error")
+		return
+	}
+	users := make(map[string]*entity.User, len(stored))
+	for _, u := range stored {
+		users[u.ID] = u
+	}
+
+	ops := make([]*entity.BatchOperation, len(raw))
+	for i, rawOp := range raw {
+		op := &entity.BatchOperation{Op: rawOp.Op, ID: rawOp.ID}
+
+		switch rawOp.Op {
+		case entity.BatchCreate:
+			op.User = entity.NewUser()
+		case entity.BatchUpdate:
+			op.User = users[rawOp.ID]
+		}
+
+		if op.User != nil && rawOp.decodeUser != nil {
+			if err := rawOp.decodeUser(op.User); err != nil {
+				h.logger.Error("decode batch user error", zap.Int("index", i), zap.Error(err))
+				render(w, r, fmt.Sprintf("decode batch user error, operation %d", i))
+				return
+			}
+		}
+
+		ops[i] = op
+	}
+
+	results, err := h.uc.Batch(r.Context(), ops, atomic)
+	if err != nil {
+		h.logger.Error("batch error", zap.Error(err))
+		renderStatus(w, r, batchErrorStatus(results, atomic), results)
+		return
+	}
+	h.logger.Info("batch succeeded", zap.Int("size", len(ops)), zap.Bool("atomic", atomic))
+
+	render(w, r, results)
+}
+
+var errBatchTooLarge = errors.New("batch too large")
+
+// decodeBatch reads the operations in the format of c. JSON is read one
+// operation at a time, so that a batch of more than maxSize operations is
+// rejected without reading the rest; the other formats are read whole,
+// within the size of the body, and counted afterwards.
+func decodeBatch(r io.Reader, c *codec, maxSize int) ([]*batchOperation, error) {
+	var ops []*batchOperation
+	var err error
+	switch c.contentType {
+	case "application/json":
+		ops, err = decodeJSONBatch(r, maxSize)
+	case "application/xml":
+		ops, err = decodeXMLBatch(r)
+	default:
+		ops, err = decodeCodecBatch(r, c)
+	}
+	if err == nil && maxSize > 0 && len(ops) > maxSize {
+		return nil, errBatchTooLarge
+	}
+	return ops, err
+}
+
+func decodeJSONBatch(r io.Reader, maxSize int) ([]*batchOperation, error) {
+	d := json.NewDecoder(r)
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t != json.Delim('[') {
+		return nil, errors.New("batch is not an array")
+	}
+
+	var ops []*batchOperation
+	for d.More() {
+		if maxSize > 0 && len(ops) == maxSize {
+			return nil, errBatchTooLarge
+		}
+
+		var raw struct {
+			Op   string
+			ID   string
+			User json.RawMessage
+		}
+		if err := d.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		op := &batchOperation{Op: raw.Op, ID: raw.ID}
+		if len(raw.User) > 0 {
+			op.decodeUser = func(u *entity.User) error { return json.Unmarshal(raw.User, u) }
+		}
+		ops = append(ops, op)
+	}
+
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// decodeXMLBatch reads a Response element with one Operation element per
+// operation, the user of an operation is kept as XML until it is decoded.
+func decodeXMLBatch(r io.Reader) ([]*batchOperation, error) {
+	var raw []*struct {
+		Op   string
+		ID   string
+		User *struct {
+			Inner []byte `xml:",innerxml"`
+		}
+	}
+	if err := decodeXML(r, &raw); err != nil {
+		return nil, err
+	}
+
+	ops := make([]*batchOperation, len(raw))
+	for i, rawOp := range raw {
+		ops[i] = &batchOperation{Op: rawOp.Op, ID: rawOp.ID}
+		if rawOp.User != nil {
+			user := append(append([]byte("<User>"), rawOp.User.Inner...), "</User>"...)
+			ops[i].decodeUser = func(u *entity.User) error { return xml.Unmarshal(user, u) }
+		}
+	}
+	return ops, nil
+}
+
+// decodeCodecBatch reads the user of every operation as a generic value and
+// encodes it again to decode it onto the user, which keeps the fields the
+// operation does not set.
+func decodeCodecBatch(r io.Reader, c *codec) ([]*batchOperation, error) {
+	var raw []*struct {
+		Op   string
+		ID   string
+		User interface{}
+	}
+	if err := c.decode(r, &raw); err != nil {
+		return nil, err
+	}
+
+	ops := make([]*batchOperation, len(raw))
+	for i, rawOp := range raw {
+		ops[i] = &batchOperation{Op: rawOp.Op, ID: rawOp.ID}
+		if user := rawOp.User; user != nil {
+			ops[i].decodeUser = func(u *entity.User) error {
+				var buf bytes.Buffer
+				if err := c.encode(&buf, user); err != nil {
+					return err
+				}
+				return c.decode(&buf, u)
+			}
+		}
+	}
+	return ops, nil
+}
+
+// batchErrorStatus is 422 when an operation of an atomic batch failed and
+// rolled back the others, 500 when the batch could not run at all.
+func batchErrorStatus(results []*entity.BatchResult, atomic bool) int {
+	if atomic {
+		for _, r := range results {
+			if r.Error != "" {
+				return http.StatusUnprocessableEntity
+			}
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,185 @@
+package user
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type codec struct {
+	contentType string
+	encode      func(w io.Writer, v interface{}) error
+	decode      func(r io.Reader, v interface{}) error
+}
+
+// codecs is the registry of response and request body formats. The first one
+// is used when the client accepts anything or sends no Content-Type.
+var codecs = []*codec{
+	{
+		contentType: "application/json",
+		encode:      func(w io.Writer, v interface{}) error { return json.NewEncoder(w).Encode(v) },
+		decode:      func(r io.Reader, v interface{}) error { return json.NewDecoder(r).Decode(v) },
+	},
+	{
+		contentType: "application/xml",
+		encode:      encodeXML,
+		decode:      decodeXML,
+	},
+	{
+		contentType: "application/msgpack",
+		encode:      func(w io.Writer, v interface{}) error { return msgpack.NewEncoder(w).Encode(v) },
+		decode:      func(r io.Reader, v interface{}) error { return msgpack.NewDecoder(r).Decode(v) },
+	},
+	{
+		contentType: "application/cbor",
+		encode:      func(w io.Writer, v interface{}) error { return cbor.NewEncoder(w).Encode(v) },
+		decode:      func(r io.Reader, v interface{}) error { return cbor.NewDecoder(r).Decode(v) },
+	},
+	{
+		contentType: "application/yaml",
+		encode:      func(w io.Writer, v interface{}) error { return yaml.NewEncoder(w).Encode(v) },
+		decode:      func(r io.Reader, v interface{}) error { return yaml.NewDecoder(r).Decode(v) },
+	},
+}
+
+// aliases are other media types clients send for the registered formats.
+var aliases = map[string]string{
+	"text/xml":              "application/xml",
+	"application/x-msgpack": "application/msgpack",
+	"application/x-yaml":    "application/yaml",
+	"text/yaml":             "application/yaml",
+}
+
+// encodeXML wraps the value in a Response element, so lists of users and
+// plain messages are well-formed documents too.
+func encodeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header+"<"+xmlRoot+">"); err != nil {
+		return err
+	}
+	if err := xml.NewEncoder(w).Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</"+xmlRoot+">\n")
+	return err
+}
+
+// decodeXML reads the Response element written by encodeXML. Every child
+// element is decoded into v, so a list is read into a slice.
+func decodeXML(r io.Reader, v interface{}) error {
+	d := xml.NewDecoder(r)
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		if root, ok := t.(xml.StartElement); ok {
+			if root.Name.Local != xmlRoot {
+				return fmt.Errorf("xml root element is %s, expected %s", root.Name.Local, xmlRoot)
+			}
+			break
+		}
+	}
+
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if err = d.DecodeElement(v, &t); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+const xmlRoot = "Response"
+
+func codecByMediaType(mediaType string) *codec {
+	if alias, ok := aliases[mediaType]; ok {
+		mediaType = alias
+	}
+
+	for _, c := range codecs {
+		if c.contentType == mediaType {
+			return c
+		}
+	}
+	return nil
+}
+
+// negotiate picks the codec for an Accept header, honouring q-values and
+// wildcards. It returns nil when none of the accepted types is supported.
+func negotiate(accept string) *codec {
+	if strings.TrimSpace(accept) == "" {
+		return codecs[0]
+	}
+
+	type acceptedType struct {
+		mediaType string
+		q         float64
+	}
+
+	var accepted []acceptedType
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, acceptedType{mediaType: mediaType, q: q})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+
+	for _, a := range accepted {
+		switch {
+		case a.mediaType == "*/*":
+			return codecs[0]
+		case strings.HasSuffix(a.mediaType, "/*"):
+			prefix := strings.TrimSuffix(a.mediaType, "*")
+			for _, c := range codecs {
+				if strings.HasPrefix(c.contentType, prefix) {
+					return c
+				}
+			}
+		default:
+			if c := codecByMediaType(a.mediaType); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// requestCodec picks the codec for a request Content-Type. It returns nil
+// when the body format is not supported.
+func requestCodec(contentType string) *codec {
+	if contentType == "" {
+		return codecs[0]
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	return codecByMediaType(mediaType)
+}
@@ -0,0 +1,145 @@
+package user
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	type expected struct {
+		Status      int
+		ContentType string
+	}
+
+	type payload struct {
+		Accept string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "no accept header",
+			expected: expected{Status: http.StatusOK, ContentType: "application/json"},
+			payload:  payload{Accept: ""},
+		},
+		{
+			name:     "any type",
+			expected: expected{Status: http.StatusOK, ContentType: "application/json"},
+			payload:  payload{Accept: "*/*"},
+		},
+		{
+			name:     "xml alias",
+			expected: expected{Status: http.StatusOK, ContentType: "application/xml"},
+			payload:  payload{Accept: "text/html, text/xml"},
+		},
+		{
+			name:     "highest q-value wins",
+			expected: expected{Status: http.StatusOK, ContentType: "application/cbor"},
+			payload:  payload{Accept: "application/json;q=0.5, application/cbor, application/yaml;q=0.9"},
+		},
+		{
+			name:     "q zero is refused",
+			expected: expected{Status: http.StatusOK, ContentType: "application/msgpack"},
+			payload:  payload{Accept: "application/json;q=0, application/msgpack;q=0.1"},
+		},
+		{
+			name:     "not acceptable",
+			expected: expected{Status: http.StatusNotAcceptable, ContentType: "application/json"},
+			payload:  payload{Accept: "text/html, image/*"},
+		},
+	}
+
+	h := Negotiate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		render(w, r, "ok")
+	}))
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			req.Header.Set("Accept", test.payload.Accept)
+			rec := httptest.NewRecorder()
+
+			h.ServeHTTP(rec, req)
+
+			assert.EqualValues(t, test.expected.Status, rec.Code)
+			assert.EqualValues(t, test.expected.ContentType, rec.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	type user struct {
+		Firstname string
+		Age       int
+	}
+
+	for _, c := range codecs {
+		t.Run(c.contentType, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			assert.Nil(t, c.encode(rec, user{Firstname: "NewUser", Age: 30}))
+
+			var decoded user
+			assert.Nil(t, requestCodec(c.contentType).decode(rec.Body, &decoded))
+			assert.EqualValues(t, user{Firstname: "NewUser", Age: 30}, decoded)
+
+			list := []*user{{Firstname: "FirstUser", Age: 20}, {Firstname: "SecondUser", Age: 21}}
+			rec = httptest.NewRecorder()
+			assert.Nil(t, c.encode(rec, list))
+
+			var decodedList []*user
+			assert.Nil(t, requestCodec(c.contentType).decode(rec.Body, &decodedList))
+			assert.EqualValues(t, list, decodedList)
+		})
+	}
+
+	assert.Nil(t, requestCodec("text/plain"))
+	assert.Equal(t, codecs[0], requestCodec(""))
+}
+
+func TestDecodeXML(t *testing.T) {
+	type user struct {
+		Firstname string
+		Age       int
+	}
+
+	type expected struct {
+		User user
+		Err  string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  string
+	}{
+		{
+			name:     "response element",
+			expected: expected{User: user{Firstname: "NewUser", Age: 30}},
+			payload:  `<?xml version="1.0"?><Response><user><Firstname>NewUser</Firstname><Age>30</Age></user></Response>`,
+		},
+		{
+			name:     "missing response element",
+			expected: expected{Err: "xml root element is user, expected Response"},
+			payload:  `<user><Firstname>NewUser</Firstname><Age>30</Age></user>`,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			var decoded user
+			err := decodeXML(strings.NewReader(test.payload), &decoded)
+			if test.expected.Err != "" {
+				assert.EqualError(t, err, test.expected.Err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected.User, decoded)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"playground/rest-api/gomasters/entity"
+	"strings"
+	"time"
+)
+
+// validators are the HTTP cache validators of a user or a list of users.
+type validators struct {
+	etag         string
+	lastModified time.Time
+}
+
+// newValidators derives the validators from the ID and Updated of the users.
+// The content type is part of the ETag because every format is a different
+// representation. Deleting a user changes the ETag of the list but not its
+// Last-Modified, so If-None-Match is the reliable validator for lists.
+func newValidators(contentType string, users ...*entity.User) *validators {
+	v := &validators{}
+	hash := sha256.New()
+	hash.Write([]byte(contentType))
+	for _, u := range users {
+		_, _ = fmt.Fprintf(hash, "\n%s %d", u.ID, u.Updated.UnixNano())
+		if u.Updated.After(v.lastModified) {
+			v.lastModified = u.Updated
+		}
+	}
+	v.etag = `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	return v
+}
+
+// renderCached sets the cache headers of data and answers 304 Not Modified
+// without a body when the client already has the current representation.
+func (h *Handler) renderCached(w http.ResponseWriter, r *http.Request, data interface{}, users ...*entity.User) {
+	v := newValidators(responseCodec(r).contentType, users...)
+
+	header := w.Header()
+	header.Set("ETag", v.etag)
+	if !v.lastModified.IsZero() {
+		header.Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	}
+	header.Set("Cache-Control", h.cacheControl())
+	header.Add("Vary", "Accept")
+
+	if v.notModified(r) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	render(w, r, data)
+}
+
+func (h *Handler) cacheControl() string {
+	maxAge := h.config().CacheMaxAge
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("max-age=%d, must-revalidate", int(maxAge.Seconds()))
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when the request
+// has no If-None-Match, as RFC 7232 orders them.
+func (v *validators) notModified(r *http.Request) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == v.etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || v.lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	// Last-Modified has a resolution of one second.
+	return !v.lastModified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,96 @@
+package user
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"playground/rest-api/gomasters/entity"
+	"testing"
+	"time"
+)
+
+func TestRenderCached(t *testing.T) {
+	updated := time.Date(2022, 5, 7, 10, 30, 15, 500, time.UTC)
+	user := &entity.User{ID: "6fa1a6ea-5a3a-4a3a-9a3a-0a3a3a3a3a3a", Updated: updated}
+	etag := newValidators("application/json", user).etag
+
+	type expected struct {
+		Status       int
+		CacheControl string
+	}
+
+	type payload struct {
+		Header      map[string]string
+		CacheMaxAge time.Duration
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "no validators",
+			expected: expected{Status: http.StatusOK, CacheControl: "no-cache"},
+			payload:  payload{},
+		},
+		{
+			name:     "matching etag",
+			expected: expected{Status: http.StatusNotModified, CacheControl: "no-cache"},
+			payload:  payload{Header: map[string]string{"If-None-Match": `"other", ` + etag}},
+		},
+		{
+			name:     "weak matching etag",
+			expected: expected{Status: http.StatusNotModified, CacheControl: "no-cache"},
+			payload:  payload{Header: map[string]string{"If-None-Match": "W/" + etag}},
+		},
+		{
+			name:     "etag of another format",
+			expected: expected{Status: http.StatusOK, CacheControl: "no-cache"},
+			payload:  payload{Header: map[string]string{"If-None-Match": etag, "Accept": "application/xml"}},
+		},
+		{
+			name:     "etag wins over modified since",
+			expected: expected{Status: http.StatusOK, CacheControl: "no-cache"},
+			payload: payload{Header: map[string]string{
+				"If-None-Match":     `"other"`,
+				"If-Modified-Since": updated.Format(http.TimeFormat),
+			}},
+		},
+		{
+			name:     "not modified since",
+			expected: expected{Status: http.StatusNotModified, CacheControl: "no-cache"},
+			payload:  payload{Header: map[string]string{"If-Modified-Since": updated.Format(http.TimeFormat)}},
+		},
+		{
+			name:     "modified since",
+			expected: expected{Status: http.StatusOK, CacheControl: "max-age=60, must-revalidate"},
+			payload: payload{
+				Header:      map[string]string{"If-Modified-Since": updated.Add(-time.Second).Format(http.TimeFormat)},
+				CacheMaxAge: time.Minute,
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			h := NewHandler(zap.NewNop(), nil, Config{CacheMaxAge: test.payload.CacheMaxAge})
+			r := httptest.NewRequest(http.MethodGet, "/users/"+user.ID, nil)
+			for k, v := range test.payload.Header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+
+			h.renderCached(w, r, user, user)
+
+			assert.EqualValues(t, test.expected.Status, w.Code)
+			assert.EqualValues(t, test.expected.CacheControl, w.Header().Get("Cache-Control"))
+			assert.EqualValues(t, updated.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+			assert.NotEmpty(t, w.Header().Get("ETag"))
+			if test.expected.Status == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+			}
+		})
+	}
+}
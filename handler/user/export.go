@@ -0,0 +1,74 @@
+package user
+
+import (
+	"go.uber.org/zap"
+	"mime"
+	"net/http"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/exporter"
+	"strings"
+)
+
+// exportFlushRows is how often the response is flushed to the client.
+const exportFlushRows = 1000
+
+// Export streams all users in CSV, NDJSON or XLSX, chosen by the format
+// query parameter or the Accept header. Like GetAll it has no filters.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormat(r.Header.Get("Accept"))
+	}
+
+	contentType := exporter.ContentType(format)
+	if contentType == "" {
+		h.logger.Error("unsupported export format", zap.String("format", format))
+		render(w, r, "unsupported export format")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=users."+format)
+
+	ew, err := exporter.NewWriter(w, format)
+	if err != nil {
+		h.logger.Error("export writer error", zap.Error(err))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+	err = h.uc.Export(r.Context(), func(u *entity.User) error {
+		if err := ew.Write(u); err != nil {
+			return err
+		}
+
+		rows++
+		if flusher != nil && rows%exportFlushRows == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = ew.Close()
+	}
+
+	// Headers are already sent, all that is left is to log and cut the body short.
+	if err != nil {
+		h.logger.Error("export error", zap.Int("rows", rows), zap.Error(err))
+		return
+	}
+	h.logger.Info("export succeeded", zap.String("format", format), zap.Int("rows", rows))
+}
+
+func exportFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		if format := exporter.FormatByContentType(mediaType); format != "" {
+			return format
+		}
+	}
+	return exporter.FormatCSV
+}
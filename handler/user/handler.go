@@ -1,44 +1,82 @@
 package user
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"net/http"
 	"playground/rest-api/gomasters/entity"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Usecase interface {
-	GetAll() ([]*entity.User, error)
-	Create(*entity.User) (string, error)
-	GetById(id string) (*entity.User, error)
-	Update(string, *entity.User) (string, error)
-	Delete(recordId string) (string, error)
+	GetAll(ctx context.Context) ([]*entity.User, error)
+	Export(ctx context.Context, fn func(*entity.User) error) error
+	Create(ctx context.Context, u *entity.User) (string, error)
+	GetById(ctx context.Context, id string) (*entity.User, error)
+	GetByIds(ctx context.Context, ids []string) ([]*entity.User, error)
+	Update(ctx context.Context, userId string, u *entity.User) (string, error)
+	Delete(ctx context.Context, recordId string) (string, error)
+	Batch(ctx context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error)
+	Import(ctx context.Context, r entity.UserReader) (*entity.ImportReport, error)
+	History(ctx context.Context, userId string) ([]*entity.AuditRecord, error)
+	GetAsOf(ctx context.Context, userId string, at time.Time) (*entity.User, error)
+	Versions(ctx context.Context, userId string) ([]*entity.UserVersion, error)
+	Revert(ctx context.Context, userId string, version int) (string, error)
+}
+
+type Config struct {
+	// BatchAtomic is the default batch mode when the request has no atomic parameter.
+	BatchAtomic   bool
+	BatchMaxSize  int
+	BatchMaxBytes int64
+	// CacheMaxAge is the max-age of the Cache-Control header of user reads;
+	// zero makes clients revalidate every time.
+	CacheMaxAge time.Duration
 }
 
 type Handler struct {
 	logger *zap.Logger
 	uc     Usecase
+
+	mu  sync.RWMutex
+	cfg Config
 }
 
-func NewHandler(l *zap.Logger, uc Usecase) *Handler {
+func NewHandler(l *zap.Logger, uc Usecase, cfg Config) *Handler {
 	return &Handler{
-		logger: l, uc: uc,
+		logger: l, uc: uc, cfg: cfg,
 	}
 }
 
-func (h *Handler) GetAll(w http.ResponseWriter, _ *http.Request) {
-	users, err := h.uc.GetAll()
+// SetConfig replaces the config while serving; requests in flight keep the old one.
+func (h *Handler) SetConfig(cfg Config) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cfg = cfg
+}
+
+func (h *Handler) config() Config {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.cfg
+}
+
+func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
+	users, err := h.uc.GetAll(r.Context())
 	if err != nil {
 		h.logger.Error("get all error", zap.Error(err))
-		render(w, "get all error")
+		render(w, r, "get all error")
 		return
 	}
 	h.logger.Info("ger all succeeded")
 
-	render(w, users)
+	h.renderCached(w, r, users, users...)
 }
 
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
@@ -46,40 +84,47 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	u := entity.NewUser()
-	if err := json.NewDecoder(r.Body).Decode(u); err != nil {
+	if err := decode(r, u); err != nil {
 		h.logger.Error("decode user error", zap.Error(err))
-		render(w, "decode user error")
+		h.renderDecodeError(w, r, err)
 		return
 	}
 
-	userId, err := h.uc.Create(u)
+	userId, err := h.uc.Create(r.Context(), u)
 	if err != nil {
 		h.logger.Error("create user error", zap.Error(err))
-		render(w, "create user error")
+		h.renderWriteError(w, r, err, "create user error")
 		return
 	}
 	h.logger.Info("create user succeeded")
 
-	render(w, fmt.Sprintf("User with ID: %s, created successfully!", userId))
+	render(w, r, fmt.Sprintf("User with ID: %s, created successfully!", userId))
 }
 
+// GetById renders the current user, or the user as it was at the RFC 3339
+// time of the as_of parameter. Only the current user carries cache headers.
 func (h *Handler) GetById(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	if err := checkUUID(id); err != nil {
 		h.logger.Error("uuid error", zap.Error(err))
-		render(w, "uuid error")
+		render(w, r, "uuid error")
 		return
 	}
 
-	user, err := h.uc.GetById(id)
+	if param := r.URL.Query().Get("as_of"); param != "" {
+		h.getAsOf(w, r, id, param)
+		return
+	}
+
+	user, err := h.uc.GetById(r.Context(), id)
 	if err != nil {
 		h.logger.Error("get by id error", zap.Error(err))
-		render(w, "get by id error")
+		render(w, r, "get by id error")
 		return
 	}
 	h.logger.Info("ger by id succeeded")
 
-	render(w, user)
+	h.renderCached(w, r, user, user)
 }
 
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
@@ -89,51 +134,96 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	if err := checkUUID(id); err != nil {
 		h.logger.Error("uuid error", zap.Error(err))
-		render(w, "uuid error")
+		render(w, r, "uuid error")
 		return
 	}
 
-	user, err := h.uc.GetById(id)
+	user, err := h.uc.GetById(r.Context(), id)
 	if err != nil {
 		h.logger.Error("update error, user not found", zap.Error(err))
-		render(w, "update error, user not found")
+		render(w, r, "update error, user not found")
 		return
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(user); err != nil {
+	if err = decode(r, user); err != nil {
 		h.logger.Error("decode user error", zap.Error(err))
-		render(w, "decode user error")
+		h.renderDecodeError(w, r, err)
 		return
 	}
 
-	userId, err := h.uc.Update(id, user)
+	userId, err := h.uc.Update(r.Context(), id, user)
 	if err != nil {
 		h.logger.Error("update error", zap.Error(err))
-		render(w, "update error")
+		h.renderWriteError(w, r, err, "update error")
 		return
 	}
 	h.logger.Info("user update succeeded")
 
-	render(w, fmt.Sprintf("User with ID: %s, updated successfully!", userId))
+	render(w, r, fmt.Sprintf("User with ID: %s, updated successfully!", userId))
 }
 
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	if err := checkUUID(id); err != nil {
 		h.logger.Error("uuid error, can't delete user", zap.Error(err))
-		render(w, "uuid error, can't delete user")
+		render(w, r, "uuid error, can't delete user")
 		return
 	}
 
-	userId, err := h.uc.Delete(id)
+	userId, err := h.uc.Delete(r.Context(), id)
 	if err != nil {
 		h.logger.Error("delete user error", zap.Error(err))
-		render(w, "delete user error")
+		render(w, r, "delete user error")
 		return
 	}
 	h.logger.Info("user delete succeeded")
 
-	render(w, fmt.Sprintf("User with ID: %s, deleted successfully!", userId))
+	render(w, r, fmt.Sprintf("User with ID: %s, deleted successfully!", userId))
+}
+
+// History renders the audit records of a user, oldest first.
+func (h *Handler) History(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := checkUUID(id); err != nil {
+		h.logger.Error("uuid error", zap.Error(err))
+		render(w, r, "uuid error")
+		return
+	}
+
+	records, err := h.uc.History(r.Context(), id)
+	if err != nil {
+		h.logger.Error("get history error", zap.Error(err))
+		render(w, r, "get history error")
+		return
+	}
+	h.logger.Info("get history succeeded")
+
+	render(w, r, records)
+}
+
+func (h *Handler) renderDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errUnsupportedMediaType) {
+		renderStatus(w, r, http.StatusUnsupportedMediaType, "unsupported content type")
+		return
+	}
+	render(w, r, "decode user error")
+}
+
+// conflictResponse is the body of 409 Conflict answers.
+type conflictResponse struct {
+	Error string
+	Field string
+}
+
+// renderWriteError answers 409 Conflict naming the taken field when a write
+// breaks a unique constraint, and renders msg for any other error.
+func (h *Handler) renderWriteError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var conflict *entity.ConflictError
+	if errors.As(err, &conflict) {
+		renderStatus(w, r, http.StatusConflict, &conflictResponse{Error: conflict.Error(), Field: conflict.Field})
+		return
+	}
+	render(w, r, msg)
 }
 
 func checkUUID(userId string) error {
@@ -141,7 +231,68 @@ func checkUUID(userId string) error {
 	return err
 }
 
-func render(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(data)
+type codecKey struct{}
+
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// Negotiate answers 406 Not Acceptable before the handler runs when none of
+// the registered formats matches the Accept header. The answer is in the
+// first format, like the errors of routes without Negotiate.
+func Negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := negotiate(r.Header.Get("Accept"))
+		if c == nil {
+			supported := make([]string, len(codecs))
+			for i, c := range codecs {
+				supported[i] = c.contentType
+			}
+			renderStatus(w, r, http.StatusNotAcceptable, "not acceptable, supported types: "+strings.Join(supported, ", "))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), codecKey{}, c)))
+	})
+}
+
+func decode(r *http.Request, v interface{}) error {
+	c := requestCodec(r.Header.Get("Content-Type"))
+	if c == nil {
+		return errUnsupportedMediaType
+	}
+	return c.decode(r.Body, v)
+}
+
+// tooLarge tells whether err comes from a body cut by http.MaxBytesReader,
+// whose error has no type of its own before Go 1.19.
+func tooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "request body too large")
+}
+
+// RenderError writes msg with status in the format negotiated for r, like
+// the errors of the handlers. Middlewares of the user routes answer with it.
+func RenderError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	renderStatus(w, r, status, msg)
+}
+
+func render(w http.ResponseWriter, r *http.Request, data interface{}) {
+	renderStatus(w, r, http.StatusOK, data)
+}
+
+func renderStatus(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	c := responseCodec(r)
+	w.Header().Set("Content-Type", c.contentType)
+	w.WriteHeader(status)
+	_ = c.encode(w, data)
+}
+
+// responseCodec is the codec chosen by Negotiate, or the best match of the
+// Accept header for routes without it.
+func responseCodec(r *http.Request) *codec {
+	c, ok := r.Context().Value(codecKey{}).(*codec)
+	if !ok {
+		if c = negotiate(r.Header.Get("Accept")); c == nil {
+			c = codecs[0]
+		}
+	}
+	return c
 }
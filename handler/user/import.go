@@ -0,0 +1,68 @@
+package user
+
+import (
+	"go.uber.org/zap"
+	"mime"
+	"net/http"
+	"playground/rest-api/gomasters/importer"
+)
+
+// Import streams a CSV or NDJSON body into the users table. The format comes
+// from the format query parameter or, when missing, from Content-Type; other
+// formats are answered 415. The report is rendered in the negotiated format.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	//goland:noinspection GoUnhandledErrorResult
+	defer r.Body.Close()
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = importFormat(r.Header.Get("Content-Type"))
+	}
+
+	switch format {
+	case importer.FormatCSV, importer.FormatNDJSON:
+	default:
+		h.logger.Error("import format error", zap.String("format", format))
+		renderStatus(w, r, http.StatusUnsupportedMediaType, "unsupported import format, supported formats: csv, ndjson")
+		return
+	}
+
+	mapping, err := importer.ParseMapping(r.URL.Query().Get("map"))
+	if err != nil {
+		h.logger.Error("import mapping error", zap.Error(err))
+		render(w, r, "import mapping error")
+		return
+	}
+
+	reader, err := importer.NewReader(r.Body, format, mapping)
+	if err != nil {
+		h.logger.Error("import reader error", zap.Error(err))
+		render(w, r, "import reader error")
+		return
+	}
+
+	report, err := h.uc.Import(r.Context(), reader)
+	if err != nil {
+		h.logger.Error("import error", zap.Error(err))
+		render(w, r, report)
+		return
+	}
+	h.logger.Info("import succeeded",
+		zap.Int("inserted", report.Inserted),
+		zap.Int("updated", report.Updated),
+		zap.Int("rejected", report.Rejected))
+
+	render(w, r, report)
+}
+
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return importer.FormatCSV
+	case "application/x-ndjson", "application/jsonl":
+		return importer.FormatNDJSON
+	default:
+		return mediaType
+	}
+}
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (h *Handler) getAsOf(w http.ResponseWriter, r *http.Request, id, param string) {
+	at, err := time.Parse(time.RFC3339Nano, param)
+	if err != nil {
+		h.logger.Error("as_of parameter error", zap.Error(err))
+		render(w, r, "as_of parameter error")
+		return
+	}
+
+	user, err := h.uc.GetAsOf(r.Context(), id, at)
+	if err != nil {
+		h.logger.Error("get as of error", zap.Error(err))
+		render(w, r, "get as of error")
+		return
+	}
+	h.logger.Info("get as of succeeded")
+
+	render(w, r, user)
+}
+
+// Versions renders all versions of a user, oldest first.
+func (h *Handler) Versions(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := checkUUID(id); err != nil {
+		h.logger.Error("uuid error", zap.Error(err))
+		render(w, r, "uuid error")
+		return
+	}
+
+	versions, err := h.uc.Versions(r.Context(), id)
+	if err != nil {
+		h.logger.Error("get versions error", zap.Error(err))
+		render(w, r, "get versions error")
+		return
+	}
+	h.logger.Info("get versions succeeded")
+
+	render(w, r, versions)
+}
+
+// Revert restores the version given by the version parameter.
+func (h *Handler) Revert(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if err := checkUUID(id); err != nil {
+		h.logger.Error("uuid error", zap.Error(err))
+		render(w, r, "uuid error")
+		return
+	}
+
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil || version < 1 {
+		h.logger.Error("version parameter error", zap.Error(err))
+		render(w, r, "version parameter error")
+		return
+	}
+
+	userId, err := h.uc.Revert(r.Context(), id, version)
+	if err != nil {
+		h.logger.Error("revert error", zap.Error(err))
+		h.renderWriteError(w, r, err, "revert error")
+		return
+	}
+	h.logger.Info("revert succeeded", zap.Int("version", version))
+
+	render(w, r, fmt.Sprintf("User with ID: %s, reverted to version %d successfully!", userId, version))
+}
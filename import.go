@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"playground/rest-api/gomasters/importer"
+	"strings"
+)
+
+// importUsers implements `import [-format csv|ndjson] [-map column=Field,...] file`
+// and prints the import report as JSON.
+func importUsers(s *storage, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "file format: csv or ndjson, taken from the file extension by default")
+	mapping := fs.String("map", "", "column mapping: column=Field,column=Field")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [-format csv|ndjson] [-map column=Field,...] file")
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	m, err := importer.ParseMapping(*mapping)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open import file error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer f.Close()
+
+	reader, err := importer.NewReader(f, *format, m)
+	if err != nil {
+		return err
+	}
+
+	report, importErr := s.usecase().Import(context.Background(), reader)
+	if err = printJSON(report); err != nil {
+		return err
+	}
+
+	return importErr
+}
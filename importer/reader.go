@@ -0,0 +1,197 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"playground/rest-api/gomasters/entity"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+const maxLineSize = 1024 * 1024
+
+// fields are the entity.User fields an import file can set. ID and Created
+// are generated, like for POST /users.
+var fields = map[string]string{
+	"firstname": "Firstname",
+	"lastname":  "Lastname",
+	"email":     "Email",
+	"age":       "Age",
+}
+
+// NewReader streams users from r. mapping maps source column names to
+// entity.User fields; columns missing from it are matched by name, ignoring
+// case, spaces, underscores and dashes, so "first_name" sets Firstname.
+func NewReader(r io.Reader, format string, mapping map[string]string) (entity.UserReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r, mapping)
+	case FormatNDJSON:
+		return newNDJSONReader(r, mapping), nil
+	default:
+		return nil, fmt.Errorf("unsupported import format: %q", format)
+	}
+}
+
+// ParseMapping parses "column=Field,column=Field" into a column mapping.
+func ParseMapping(s string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	if s == "" {
+		return mapping, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		column, field, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid mapping %q, expected column=Field", pair)
+		}
+
+		f, ok := fields[normalize(field)]
+		if !ok {
+			return nil, fmt.Errorf("unknown user field %q", field)
+		}
+		mapping[strings.TrimSpace(column)] = f
+	}
+
+	return mapping, nil
+}
+
+func resolveField(column string, mapping map[string]string) string {
+	if f, ok := mapping[column]; ok {
+		return f
+	}
+	return fields[normalize(column)]
+}
+
+func normalize(s string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(strings.TrimSpace(s)))
+}
+
+func toUser(values map[string]string) (*entity.User, error) {
+	u := entity.NewUser()
+	u.Firstname = values["Firstname"]
+	u.Lastname = values["Lastname"]
+	u.Email = values["Email"]
+
+	if age := values["Age"]; age != "" {
+		var err error
+		if u.Age, err = strconv.Atoi(strings.TrimSpace(age)); err != nil {
+			return nil, fmt.Errorf("invalid age %q", age)
+		}
+	}
+
+	return u, nil
+}
+
+type csvReader struct {
+	r       *csv.Reader
+	columns []string
+}
+
+func newCSVReader(r io.Reader, mapping map[string]string) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header error: %v", err)
+	}
+
+	columns := make([]string, len(header))
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\uFEFF")
+		}
+		columns[i] = resolveField(column, mapping)
+	}
+
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Read() (int, *entity.User, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return parseErr.StartLine, nil, &entity.RowError{Line: parseErr.StartLine, Err: parseErr.Err}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	values := make(map[string]string, len(fields))
+	for i, value := range record {
+		if c.columns[i] != "" {
+			values[c.columns[i]] = value
+		}
+	}
+
+	u, err := toUser(values)
+	if err != nil {
+		return line, nil, &entity.RowError{Line: line, Err: err}
+	}
+
+	return line, u, nil
+}
+
+type ndjsonReader struct {
+	s       *bufio.Scanner
+	mapping map[string]string
+	line    int
+}
+
+func newNDJSONReader(r io.Reader, mapping map[string]string) *ndjsonReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	return &ndjsonReader{s: s, mapping: mapping}
+}
+
+func (n *ndjsonReader) Read() (int, *entity.User, error) {
+	for n.s.Scan() {
+		n.line++
+		data := bytes.TrimSpace(n.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var object map[string]interface{}
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&object); err != nil {
+			return n.line, nil, &entity.RowError{Line: n.line, Err: fmt.Errorf("invalid json: %v", err)}
+		}
+
+		values := make(map[string]string, len(fields))
+		for key, value := range object {
+			if f := resolveField(key, n.mapping); f != "" {
+				values[f] = fmt.Sprint(value)
+			}
+		}
+
+		u, err := toUser(values)
+		if err != nil {
+			return n.line, nil, &entity.RowError{Line: n.line, Err: err}
+		}
+		return n.line, u, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return 0, nil, fmt.Errorf("read ndjson line %d error: %v", n.line+1, err)
+	}
+	return 0, nil, io.EOF
+}
@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"playground/rest-api/gomasters/entity"
+	"strings"
+	"testing"
+)
+
+type row struct {
+	Line      int
+	Firstname string
+	Lastname  string
+	Email     string
+	Age       int
+	Err       string
+}
+
+func readAll(t *testing.T, r entity.UserReader) []row {
+	var rows []row
+	for {
+		line, u, err := r.Read()
+		if err == io.EOF {
+			return rows
+		}
+
+		var rowErr *entity.RowError
+		if errors.As(err, &rowErr) {
+			rows = append(rows, row{Line: rowErr.Line, Err: rowErr.Err.Error()})
+			continue
+		}
+		if !assert.Nil(t, err) {
+			return rows
+		}
+
+		assert.NotEmpty(t, u.ID)
+		assert.False(t, u.Created.IsZero())
+		rows = append(rows, row{Line: line, Firstname: u.Firstname, Lastname: u.Lastname, Email: u.Email, Age: u.Age})
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	type expected struct {
+		Rows []row
+		Err  error
+	}
+
+	type payload struct {
+		Format  string
+		Mapping string
+		Data    string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "csv with aliases and bad rows",
+			expected: expected{
+				Rows: []row{
+					{Line: 2, Firstname: "NewUser", Lastname: "NewUserLastname", Email: "newuser@gmail.com", Age: 30},
+					{Line: 3, Err: "invalid age \"thirty\""},
+					{Line: 4, Err: "wrong number of fields"},
+					{Line: 5, Firstname: "SecondUser", Lastname: "LastNameB", Email: "user2@gmail.com", Age: 21},
+				},
+			},
+			payload: payload{
+				Format: FormatCSV,
+				Data: "First_Name,last name,EMAIL,age,comment\n" +
+					"NewUser,NewUserLastname,newuser@gmail.com,30,vip\n" +
+					"FirstUser,LastNameA,user1@gmail.com,thirty,\n" +
+					"ThirdUser,LastNameC\n" +
+					"SecondUser,LastNameB,user2@gmail.com,21,\n",
+			},
+		},
+		{
+			name: "csv with mapping",
+			expected: expected{
+				Rows: []row{
+					{Line: 2, Firstname: "NewUser", Lastname: "NewUserLastname", Email: "newuser@gmail.com", Age: 30},
+				},
+			},
+			payload: payload{
+				Format:  FormatCSV,
+				Mapping: "name=Firstname,surname=Lastname,mail=Email,years=Age",
+				Data:    "name,surname,mail,years\nNewUser,NewUserLastname,newuser@gmail.com,30\n",
+			},
+		},
+		{
+			name: "ndjson",
+			expected: expected{
+				Rows: []row{
+					{Line: 1, Firstname: "NewUser", Lastname: "NewUserLastname", Email: "newuser@gmail.com", Age: 30},
+					{Line: 3, Err: "invalid json: unexpected EOF"},
+					{Line: 4, Firstname: "SecondUser", Lastname: "LastNameB", Email: "user2@gmail.com", Age: 21},
+				},
+			},
+			payload: payload{
+				Format: FormatNDJSON,
+				Data: `{"Firstname": "NewUser", "Lastname": "NewUserLastname", "Email": "newuser@gmail.com", "Age": 30}` + "\n\n" +
+					`{"Firstname": "FirstUser"` + "\n" +
+					`{"first_name": "SecondUser", "last_name": "LastNameB", "email": "user2@gmail.com", "age": "21"}` + "\n",
+			},
+		},
+		{
+			name: "unsupported format",
+			expected: expected{
+				Err: errors.New("unsupported import format: \"xml\""),
+			},
+			payload: payload{
+				Format: "xml",
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mapping, err := ParseMapping(test.payload.Mapping)
+			assert.Nil(t, err)
+
+			r, err := NewReader(strings.NewReader(test.payload.Data), test.payload.Format, mapping)
+			if err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected.Rows, readAll(t, r))
+		})
+	}
+}
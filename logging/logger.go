@@ -0,0 +1,136 @@
+// Package logging builds the zap logger of the application from its settings
+// and masks personal data in what it writes.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"regexp"
+	"time"
+)
+
+// Encodings of Options.Format.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+type Options struct {
+	// Level is the minimum level, it can be changed while the logger is in use.
+	Level zap.AtomicLevel
+	// Format is FormatJSON or FormatConsole.
+	Format string
+	// Every second the first SamplingInitial entries with the same level and
+	// message are written, then every SamplingThereafter-th. A zero
+	// SamplingInitial writes every entry.
+	SamplingInitial    int
+	SamplingThereafter int
+	// OutputPaths and ErrorOutputPaths are file paths, stdout or stderr.
+	// Errors of the logger itself go to ErrorOutputPaths.
+	OutputPaths      []string
+	ErrorOutputPaths []string
+	// RedactEmails masks email addresses in messages and in string, byte
+	// string, error, Stringer and reflected fields.
+	RedactEmails bool
+}
+
+// New builds the logger of opts.
+func New(opts Options) (*zap.Logger, error) {
+	cfg := zap.NewProductionConfig()
+	cfg.Level = opts.Level
+	cfg.Sampling = nil
+	switch opts.Format {
+	case FormatJSON:
+	case FormatConsole:
+		cfg.Encoding = FormatConsole
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+	if len(opts.OutputPaths) > 0 {
+		cfg.OutputPaths = opts.OutputPaths
+	}
+	if len(opts.ErrorOutputPaths) > 0 {
+		cfg.ErrorOutputPaths = opts.ErrorOutputPaths
+	}
+
+	// The sampler wraps the redaction, so that sampled entries are redacted too.
+	var wrap []zap.Option
+	if opts.RedactEmails {
+		wrap = append(wrap, zap.WrapCore(func(core zapcore.Core) zapcore.Core { return redactCore{core} }))
+	}
+	if opts.SamplingInitial > 0 {
+		wrap = append(wrap, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewSamplerWithOptions(core, time.Second, opts.SamplingInitial, opts.SamplingThereafter)
+		}))
+	}
+
+	logger, err := cfg.Build(wrap...)
+	if err != nil {
+		return nil, fmt.Errorf("build logger error: %v", err)
+	}
+	return logger, nil
+}
+
+var emailPattern = regexp.MustCompile(`([A-Za-z0-9._%+\-])[A-Za-z0-9._%+\-]*@([A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+)`)
+
+// RedactEmail keeps the first letter and the domain of the email addresses
+// in s: jane.doe@example.com becomes j***@example.com.
+func RedactEmail(s string) string {
+	return emailPattern.ReplaceAllString(s, "$1***@$2")
+}
+
+// redactCore masks the emails of the entries it writes. Reflected fields,
+// such as zap.Any of a struct, are masked in their JSON. Fields of other
+// types, such as numbers and object marshalers, are written unchanged.
+type redactCore struct {
+	zapcore.Core
+}
+
+func (c redactCore) With(fields []zapcore.Field) zapcore.Core {
+	return redactCore{c.Core.With(redactFields(fields))}
+}
+
+func (c redactCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c redactCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = RedactEmail(ent.Message)
+	return c.Core.Write(ent, redactFields(fields))
+}
+
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = RedactEmail(f.String)
+		case zapcore.ByteStringType:
+			if b, ok := f.Interface.([]byte); ok {
+				f = zap.ByteString(f.Key, []byte(RedactEmail(string(b))))
+			}
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok {
+				f = zap.String(f.Key, RedactEmail(err.Error()))
+			}
+		case zapcore.StringerType:
+			if s, ok := f.Interface.(fmt.Stringer); ok {
+				f = zap.String(f.Key, RedactEmail(s.String()))
+			}
+		case zapcore.ReflectType:
+			// A value that does not marshal is left to the encoder, which
+			// fails on it the same way.
+			if b, err := json.Marshal(f.Interface); err == nil {
+				f = zap.Reflect(f.Key, json.RawMessage(RedactEmail(string(b))))
+			}
+		}
+		redacted[i] = f
+	}
+	return redacted
+}
@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactEmail(t *testing.T) {
+	assert.EqualValues(t, "j***@example.com", RedactEmail("jane.doe@example.com"))
+	assert.EqualValues(t, `email "u***@mail.example.org" already exists, u***@gmail.com`,
+		RedactEmail(`email "user1@mail.example.org" already exists, u@gmail.com`))
+	assert.EqualValues(t, "no email @ here", RedactEmail("no email @ here"))
+}
+
+func TestNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	logger, err := New(Options{
+		Level: level, Format: FormatJSON, SamplingInitial: 2, SamplingThereafter: 100,
+		OutputPaths: []string{path}, RedactEmails: true,
+	})
+	require.Nil(t, err)
+
+	logger.With(zap.String("actor", "admin@example.com")).Info("created user1@gmail.com",
+		zap.String("email", "user1@gmail.com"), zap.Error(errors.New("duplicate user2@gmail.com")), zap.Int("age", 20),
+		zap.ByteString("payload", []byte(`{"Email":"user3@gmail.com"}`)), zap.Stringer("addr", &mail.Address{Address: "user4@gmail.com"}),
+		zap.Any("user", struct{ Email string }{Email: "user5@gmail.com"}))
+	logger.Debug("hidden")
+	level.SetLevel(zap.DebugLevel)
+	logger.Debug("shown")
+	for i := 0; i < 5; i++ {
+		logger.Info("repeated")
+	}
+	require.Nil(t, logger.Sync())
+
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	out := string(data)
+	assert.NotContains(t, out, "user1@gmail.com")
+	assert.NotContains(t, out, "user2@gmail.com")
+	assert.NotContains(t, out, "admin@example.com")
+	assert.NotContains(t, out, "user3@gmail.com")
+	assert.NotContains(t, out, "user4@gmail.com")
+	assert.NotContains(t, out, "user5@gmail.com")
+	assert.Contains(t, out, `"msg":"created u***@gmail.com"`)
+	assert.Contains(t, out, `"email":"u***@gmail.com"`)
+	assert.Contains(t, out, `"error":"duplicate u***@gmail.com"`)
+	assert.Contains(t, out, `"actor":"a***@example.com"`)
+	assert.Contains(t, out, `"age":20`)
+	assert.Contains(t, out, `"payload":"{\"Email\":\"u***@gmail.com\"}"`)
+	assert.Contains(t, out, `"addr":"<u***@gmail.com>"`)
+	assert.Contains(t, out, `"user":{"Email":"u***@gmail.com"}`)
+	assert.NotContains(t, out, "hidden")
+	assert.Contains(t, out, "shown")
+	assert.EqualValues(t, 2, strings.Count(out, "repeated"), "sampled")
+
+	_, err = New(Options{Level: level, Format: "xml"})
+	assert.NotNil(t, err)
+}
@@ -1,55 +1,90 @@
 package main
 
 import (
-	"database/sql"
-	_ "github.com/jackc/pgx/v4/stdlib"
+	"fmt"
 	"go.uber.org/zap"
-	"net/http"
+	"os"
 	"playground/rest-api/gomasters/config"
-	"playground/rest-api/gomasters/router"
+	"playground/rest-api/gomasters/logging"
 )
 
 func main() {
-	logger, _ := zap.NewProduction()
-	logger.Info("Golang REST API started")
-
-	cfg, err := config.GetAppConfig(".env")
+	cfg, args, err := config.Load(os.Args[1:])
 	if err != nil {
+		logger, _ := zap.NewProduction()
 		logger.Fatal("config reading error", zap.Error(err))
 	}
-	logger.Info("Config OK")
 
-	// https://github.com/jackc/pgx/blob/master/stdlib/sql.go
-	db, err := sql.Open("pgx", cfg.GetDbString())
-	if err != nil {
-		logger.Fatal("open db error", zap.Error(err))
+	// The level is the only logger setting taken over by a reload, it can
+	// also be changed on /admin/log/level.
+	level := zap.NewAtomicLevel()
+	if err = level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		logger, _ := zap.NewProduction()
+		logger.Fatal("config reading error", zap.Error(err))
 	}
-	//goland:noinspection GoUnhandledErrorResult
-	defer db.Close()
-	if err = db.Ping(); err != nil {
-		logger.Fatal("ping db error", zap.Error(err))
+	logger, err := logging.New(logging.Options{
+		Level:              level,
+		Format:             cfg.LogFormat,
+		SamplingInitial:    cfg.LogSamplingInitial,
+		SamplingThereafter: cfg.LogSamplingThereafter,
+		OutputPaths:        cfg.LogOutputPaths,
+		ErrorOutputPaths:   cfg.LogErrorOutputPaths,
+		RedactEmails:       cfg.LogRedactEmails,
+	})
+	if err != nil {
+		logger, _ := zap.NewProduction()
+		logger.Fatal("logger error", zap.Error(err))
 	}
-	logger.Info("Db OK")
+	// The request log of the router goes through log, it is formatted and redacted the same way.
+	defer zap.RedirectStdLog(logger)()
 
-	r := router.NewRouter(db, logger)
+	command, args := parseCommand(args)
+	switch command {
+	case "serve":
+		logger.Info("Golang REST API started")
+		reloader := config.NewReloader(logger, cfg, os.Args[1:])
+		// Only a changed LOG_LEVEL replaces the level set on /admin/log/level.
+		reloader.OnSettingChange("LOG_LEVEL", func(cfg *config.AppConfig) {
+			if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+				logger.Error("log level error", zap.Error(err))
+			}
+		})
+		err = serve(reloader, level, logger)
+	case "config":
+		err = configCommand(cfg, args)
+	case "migrate":
+		err = migrateCommand(cfg, args)
+	case "seed", "users", "import":
+		err = withStorage(cfg, logger, func(s *storage) error {
+			switch command {
+			case "seed":
+				return seedCommand(s, args)
+			case "users":
+				return usersCommand(s, args)
+			default:
+				return importUsers(s, args)
+			}
+		})
+	case "help":
+		fmt.Println(usage)
+	default:
+		_ = logger.Sync()
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
 
-	server := &http.Server{
-		Addr:    cfg.AppAddr,
-		Handler: r,
+	_ = logger.Sync()
+	if err != nil {
+		logger.Fatal(command+" error", zap.Error(err))
 	}
-	logger.Info("Start http server", zap.String("server", cfg.AppAddr))
-	logger.Fatal("fatal server error", zap.Error(server.ListenAndServe()))
+}
 
-	//c := make(chan os.Signal, 1)
-	//signal.Notify(c, os.Interrupt)
-	//<-c
-	//
-	//cctx, cancel := context.WithTimeout(context.Background(), wait)
-	//defer cancel()
-	//err = server.Shutdown(cctx)
-	//if err != nil {
-	//	logger.Error("shutdown error", zap.Error(err))
-	//}
-	//logger.Error("shutting down")
-	//os.Exit(0)
+// withStorage runs fn with the storage of DB_DRIVER and closes it afterwards.
+func withStorage(cfg *config.AppConfig, logger *zap.Logger, fn func(s *storage) error) error {
+	s, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	return fn(s)
 }
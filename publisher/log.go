@@ -0,0 +1,28 @@
+package publisher
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"playground/rest-api/gomasters/entity"
+)
+
+// LogPublisher writes events to the application log. It is the default
+// publisher until a message broker is plugged in.
+type LogPublisher struct {
+	logger *zap.Logger
+}
+
+func NewLogPublisher(l *zap.Logger) *LogPublisher {
+	return &LogPublisher{
+		logger: l,
+	}
+}
+
+func (p *LogPublisher) Publish(_ context.Context, e *entity.Event) error {
+	p.logger.Info("event published",
+		zap.String("id", e.ID),
+		zap.String("type", e.Type),
+		zap.String("entity_id", e.EntityID),
+		zap.ByteString("payload", e.Payload))
+	return nil
+}
@@ -0,0 +1,33 @@
+package publisher
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/logging"
+	"testing"
+)
+
+func TestLogPublisher_RedactsPayload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	logger, err := logging.New(logging.Options{
+		Level: zap.NewAtomicLevelAt(zap.InfoLevel), Format: logging.FormatJSON,
+		OutputPaths: []string{path}, RedactEmails: true,
+	})
+	require.Nil(t, err)
+
+	payload := []byte(`{"ID":"1","Firstname":"NewUser","Email":"newuser@gmail.com"}`)
+	require.Nil(t, NewLogPublisher(logger).Publish(context.Background(), entity.NewEvent(entity.EventUserCreated, "1", payload)))
+	require.Nil(t, logger.Sync())
+
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	out := string(data)
+	assert.NotContains(t, out, "newuser@gmail.com")
+	assert.Contains(t, out, `\"Email\":\"n***@gmail.com\"`)
+	assert.Contains(t, out, `"entity_id":"1"`)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC)
+	c := NewLRU[string, int](2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used entry.
+	c.Add("c", 3)
+	_, ok = c.Get("b")
+	assert.False(t, ok, "evicted")
+
+	v, ok := c.Get("c")
+	assert.True(t, ok)
+	assert.EqualValues(t, 3, v)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("a")
+	assert.False(t, ok, "expired")
+
+	c.Add("a", 4)
+	c.Remove("a", "unknown")
+	_, ok = c.Get("a")
+	assert.False(t, ok, "removed")
+
+	assert.EqualValues(t, Stats{Hits: 2, Misses: 3, Evictions: 1, Size: 1}, c.Stats(),
+		"expired entries are only dropped on lookup")
+}
+
+func TestGroup_Do(t *testing.T) {
+	var g Group[int]
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	done := make(chan int)
+	go func() {
+		v, shared, err := g.Do("key", func() (int, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		assert.Nil(t, err)
+		assert.False(t, shared)
+		done <- v
+	}()
+	<-started
+
+	go func() {
+		v, _, err := g.Do("key", func() (int, error) {
+			return 2, nil
+		})
+		assert.Nil(t, err)
+		done <- v
+	}()
+
+	// Give the second caller time to join the first call.
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	assert.EqualValues(t, 1, <-done)
+	assert.EqualValues(t, 1, <-done)
+}
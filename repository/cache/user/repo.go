@@ -0,0 +1,291 @@
+package user
+
+import (
+	"context"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/cache"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"sync"
+	"time"
+)
+
+const allKey = "all"
+
+type Options struct {
+	// Size is the number of users kept.
+	Size int
+	TTL  time.Duration
+	// InTx reports whether ctx carries a transaction of the wrapped
+	// repository. Calls inside one bypass the cache, so that uncommitted
+	// users are never cached.
+	InTx func(ctx context.Context) bool
+}
+
+// Stats counts the lookups of GetById and GetAll.
+type Stats struct {
+	Users cache.Stats
+	All   cache.Stats
+}
+
+// Cached is the caching repository, a userUsecase.BatchRepository as well
+// when the wrapped repository is one.
+type Cached interface {
+	userUsecase.Repository
+	Stats() Stats
+	// WrapTxManager returns tm removing the entries written in a transaction
+	// again once it has ended, the usecase has to use it for the cache to
+	// stay right across transactions.
+	WrapTxManager(tm userUsecase.TxManager) userUsecase.TxManager
+}
+
+// Repository caches GetById and GetAll of another repository in process.
+// Writes remove the users they touch and the GetAll result; concurrent
+// misses of the same key share one load. A write inside a transaction
+// removes them again after the commit, as a read outside the transaction
+// may have cached the old user meanwhile. Other instances of the service do
+// not see the removals at all, so entries may be stale for up to the TTL.
+type Repository struct {
+	next  userUsecase.Repository
+	opts  Options
+	users *cache.LRU[string, entity.User]
+	all   *cache.LRU[string, []entity.User]
+
+	userLoads cache.Group[entity.User]
+	allLoads  cache.Group[[]entity.User]
+
+	// generation changes with every write, a load that overlaps a write
+	// does not store its result.
+	mu         sync.Mutex
+	generation uint64
+}
+
+// NewRepository wraps next with the cache.
+func NewRepository(next userUsecase.Repository, opts Options) Cached {
+	r := &Repository{
+		next:  next,
+		opts:  opts,
+		users: cache.NewLRU[string, entity.User](opts.Size, opts.TTL),
+		all:   cache.NewLRU[string, []entity.User](1, opts.TTL),
+	}
+	if br, ok := next.(userUsecase.BatchRepository); ok {
+		return &BatchRepository{Repository: r, next: br}
+	}
+	return r
+}
+
+func (r *Repository) Stats() Stats {
+	return Stats{Users: r.users.Stats(), All: r.all.Stats()}
+}
+
+func (r *Repository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	if r.inTx(ctx) {
+		return r.next.GetAll(ctx)
+	}
+
+	users, ok := r.all.Get(allKey)
+	if !ok {
+		var err error
+		users, _, err = r.allLoads.Do(allKey, func() ([]entity.User, error) {
+			generation := r.currentGeneration()
+			loaded, err := r.next.GetAll(cache.Detach(ctx))
+			if err != nil {
+				return nil, err
+			}
+
+			users := make([]entity.User, len(loaded))
+			for i, u := range loaded {
+				users[i] = *u
+			}
+			r.store(generation, func() { r.all.Add(allKey, users) })
+			return users, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var copies []*entity.User
+	for _, u := range users {
+		u := u
+		copies = append(copies, &u)
+	}
+	return copies, nil
+}
+
+// StreamAll is not cached, it reads more users than the cache keeps.
+func (r *Repository) StreamAll(ctx context.Context, fn func(*entity.User) error) error {
+	return r.next.StreamAll(ctx, fn)
+}
+
+func (r *Repository) GetById(ctx context.Context, id string) (*entity.User, error) {
+	if r.inTx(ctx) {
+		return r.next.GetById(ctx, id)
+	}
+
+	u, ok := r.users.Get(id)
+	if !ok {
+		var err error
+		u, _, err = r.userLoads.Do(id, func() (entity.User, error) {
+			generation := r.currentGeneration()
+			loaded, err := r.next.GetById(cache.Detach(ctx), id)
+			if err != nil {
+				return entity.User{}, err
+			}
+
+			r.store(generation, func() { r.users.Add(id, *loaded) })
+			return *loaded, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &u, nil
+}
+
+// GetByIds is not cached, it is only used by batches, which read the users
+// they change in their own transaction.
+func (r *Repository) GetByIds(ctx context.Context, ids []string) ([]*entity.User, error) {
+	return r.next.GetByIds(ctx, ids)
+}
+
+// GetByEmail is not cached, it is only used by imports.
+func (r *Repository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+	return r.next.GetByEmail(ctx, email)
+}
+
+func (r *Repository) Create(ctx context.Context, u *entity.User) (string, error) {
+	defer r.invalidate(ctx)
+	return r.next.Create(ctx, u)
+}
+
+func (r *Repository) Update(ctx context.Context, userId string, u *entity.User) (string, error) {
+	defer r.invalidate(ctx, userId, u.ID)
+	return r.next.Update(ctx, userId, u)
+}
+
+func (r *Repository) Delete(ctx context.Context, userId string) (string, error) {
+	defer r.invalidate(ctx, userId)
+	return r.next.Delete(ctx, userId)
+}
+
+func (r *Repository) WrapTxManager(tm userUsecase.TxManager) userUsecase.TxManager {
+	return &txManager{repo: r, next: tm}
+}
+
+func (r *Repository) inTx(ctx context.Context) bool {
+	return r.opts.InTx != nil && r.opts.InTx(ctx)
+}
+
+func (r *Repository) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.generation
+}
+
+// store runs add unless a write has happened since generation.
+func (r *Repository) store(generation uint64, add func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generation == generation {
+		add()
+	}
+}
+
+// invalidate removes the users with ids and the GetAll result; without ids
+// only the GetAll result. Inside a transaction of the wrapped TxManager they
+// are removed again when it ends.
+func (r *Repository) invalidate(ctx context.Context, ids ...string) {
+	r.remove(ids...)
+	if w, ok := ctx.Value(writesKey{}).(*writes); ok {
+		w.add(ids...)
+	}
+}
+
+func (r *Repository) remove(ids ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	r.users.Remove(ids...)
+	r.all.Purge()
+}
+
+func (r *Repository) purge(ctx context.Context) {
+	r.purgeAll()
+	if w, ok := ctx.Value(writesKey{}).(*writes); ok {
+		w.addAll()
+	}
+}
+
+func (r *Repository) purgeAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	r.users.Purge()
+	r.all.Purge()
+}
+
+type writesKey struct{}
+
+// writes collects the users written in a transaction.
+type writes struct {
+	mu      sync.Mutex
+	written bool
+	ids     []string
+	all     bool
+}
+
+func (w *writes) add(ids ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = true
+	w.ids = append(w.ids, ids...)
+}
+
+func (w *writes) addAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.all = true
+}
+
+// txManager removes the users written in a transaction once it has been
+// committed or rolled back.
+type txManager struct {
+	repo *Repository
+	next userUsecase.TxManager
+}
+
+func (m *txManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(writesKey{}).(*writes); ok {
+		return m.next.WithinTx(ctx, fn)
+	}
+
+	w := &writes{}
+	err := m.next.WithinTx(context.WithValue(ctx, writesKey{}, w), fn)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case w.all:
+		m.repo.purgeAll()
+	case w.written:
+		m.repo.remove(w.ids...)
+	}
+	return err
+}
+
+// BatchRepository is the caching repository of a userUsecase.BatchRepository.
+type BatchRepository struct {
+	*Repository
+	next userUsecase.BatchRepository
+}
+
+// Batch removes all cached users, a batch may touch any number of them.
+func (br *BatchRepository) Batch(ctx context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error) {
+	defer br.purge(ctx)
+	return br.next.Batch(ctx, ops, atomic)
+}
@@ -0,0 +1,258 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/memory"
+	memoryUserRepo "playground/rest-api/gomasters/repository/memory/user"
+	"playground/rest-api/gomasters/repository/repotest"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var options = Options{Size: 100, TTL: time.Minute, InTx: memory.InTx}
+
+func TestRepository_Contract(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, func(t *testing.T) userUsecase.Repository {
+		return NewRepository(memoryUserRepo.NewRepository(), options)
+	})
+}
+
+func TestRepository_Tx(t *testing.T) {
+	repotest.RunTxTests(t, func(t *testing.T) (userUsecase.Repository, userUsecase.TxManager) {
+		repo := memoryUserRepo.NewRepository()
+		return NewRepository(repo, options), memory.NewTxManager(repo)
+	})
+}
+
+// countingRepository counts the reads that reach the wrapped repository.
+type countingRepository struct {
+	*memoryUserRepo.Repository
+	getById, getAll int32
+	// wait, when set, holds GetById until it is closed.
+	wait chan struct{}
+}
+
+func (cr *countingRepository) GetById(ctx context.Context, id string) (*entity.User, error) {
+	atomic.AddInt32(&cr.getById, 1)
+	if cr.wait != nil {
+		<-cr.wait
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cr.Repository.GetById(ctx, id)
+}
+
+func (cr *countingRepository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	atomic.AddInt32(&cr.getAll, 1)
+	return cr.Repository.GetAll(ctx)
+}
+
+func newUser() *entity.User {
+	return &entity.User{
+		ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+		Firstname: "FirstUser",
+		Lastname:  "LastNameA",
+		Email:     "user1@gmail.com",
+		Age:       20,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestRepository_Caching(t *testing.T) {
+	ctx := context.Background()
+	next := &countingRepository{Repository: memoryUserRepo.NewRepository()}
+	repo := NewRepository(next, options)
+	_, isBatch := repo.(userUsecase.BatchRepository)
+	assert.True(t, isBatch, "batches of the wrapped repository are kept")
+
+	user := newUser()
+	_, err := repo.Create(ctx, user)
+	require.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		u, err := repo.GetById(ctx, user.ID)
+		require.Nil(t, err)
+		u.Firstname = "Changed"
+
+		users, err := repo.GetAll(ctx)
+		require.Nil(t, err)
+		assert.Len(t, users, 1)
+	}
+	assert.EqualValues(t, 1, next.getById, "the second GetById is a hit")
+	assert.EqualValues(t, 1, next.getAll, "the second GetAll is a hit")
+
+	u, _ := repo.GetById(ctx, user.ID)
+	assert.EqualValues(t, "FirstUser", u.Firstname, "returned users are copies")
+
+	updated := newUser()
+	updated.Age = 21
+	_, err = repo.Update(ctx, user.ID, updated)
+	require.Nil(t, err)
+
+	u, _ = repo.GetById(ctx, user.ID)
+	assert.EqualValues(t, 21, u.Age, "update removes the user")
+	users, _ := repo.GetAll(ctx)
+	assert.EqualValues(t, 21, users[0].Age, "update removes GetAll")
+
+	// Reads in a transaction go to the wrapped repository.
+	tm := memory.NewTxManager(next.Repository)
+	_ = tm.WithinTx(ctx, func(ctx context.Context) error {
+		_, err := repo.GetById(ctx, user.ID)
+		return err
+	})
+	assert.EqualValues(t, 3, next.getById)
+
+	_, err = repo.Delete(ctx, user.ID)
+	require.Nil(t, err)
+	_, err = repo.GetById(ctx, user.ID)
+	assert.ErrorIs(t, err, entity.ErrNotFound, "delete removes the user")
+
+	stats := repo.Stats()
+	assert.EqualValues(t, []uint64{2, 3}, []uint64{stats.Users.Hits, stats.Users.Misses}, "GetById hits and misses")
+	assert.EqualValues(t, []uint64{1, 2}, []uint64{stats.All.Hits, stats.All.Misses}, "GetAll hits and misses")
+}
+
+func TestRepository_Stampede(t *testing.T) {
+	ctx := context.Background()
+	next := &countingRepository{Repository: memoryUserRepo.NewRepository(), wait: make(chan struct{})}
+	repo := NewRepository(next, options)
+
+	user := newUser()
+	_, err := repo.Create(ctx, user)
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := repo.GetById(ctx, user.ID)
+			assert.Nil(t, err)
+			assert.EqualValues(t, user, u)
+		}()
+	}
+
+	// Give the readers time to miss and join the first load.
+	time.Sleep(10 * time.Millisecond)
+	close(next.wait)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, next.getById, "one load for all misses")
+}
+
+// isolatedRepository shows reads outside of a transaction the users as they
+// were committed, like a database does, while the memory repository shows
+// uncommitted writes to everyone.
+type isolatedRepository struct {
+	*memoryUserRepo.Repository
+	committed *entity.User
+}
+
+func (ir *isolatedRepository) GetById(ctx context.Context, id string) (*entity.User, error) {
+	if !memory.InTx(ctx) && ir.committed != nil {
+		u := *ir.committed
+		return &u, nil
+	}
+	return ir.Repository.GetById(ctx, id)
+}
+
+func TestRepository_ReadDuringTx(t *testing.T) {
+	type expected struct {
+		Age int
+	}
+
+	type payload struct {
+		Err error
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "committed",
+			expected: expected{Age: 21},
+			payload:  payload{},
+		},
+		{
+			name:     "rolled back",
+			expected: expected{Age: 20},
+			payload:  payload{Err: errors.New("rollback")},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			next := &isolatedRepository{Repository: memoryUserRepo.NewRepository()}
+			repo := NewRepository(next, options)
+			tm := repo.WrapTxManager(memory.NewTxManager(next.Repository))
+
+			user := newUser()
+			_, err := repo.Create(ctx, user)
+			require.Nil(t, err)
+
+			err = tm.WithinTx(ctx, func(txCtx context.Context) error {
+				next.committed = user
+				updated := newUser()
+				updated.Age = 21
+				if _, err := repo.Update(txCtx, user.ID, updated); err != nil {
+					return err
+				}
+
+				// A read outside the transaction caches the committed user.
+				u, err := repo.GetById(ctx, user.ID)
+				require.Nil(t, err)
+				assert.EqualValues(t, 20, u.Age)
+
+				next.committed = nil
+				return test.payload.Err
+			})
+			assert.EqualValues(t, test.payload.Err, err)
+
+			u, err := repo.GetById(ctx, user.ID)
+			require.Nil(t, err)
+			assert.EqualValues(t, test.expected.Age, u.Age)
+		})
+	}
+}
+
+func TestRepository_LoadOfCanceledCaller(t *testing.T) {
+	next := &countingRepository{Repository: memoryUserRepo.NewRepository(), wait: make(chan struct{})}
+	repo := NewRepository(next, options)
+
+	user := newUser()
+	_, err := repo.Create(context.Background(), user)
+	require.Nil(t, err)
+
+	// The first caller gives up while its load is shared with a second one.
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = repo.GetById(ctx, user.ID)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		u, err := repo.GetById(context.Background(), user.ID)
+		assert.Nil(t, err)
+		assert.EqualValues(t, user, u)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	close(next.wait)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, next.getById, "one shared load")
+}
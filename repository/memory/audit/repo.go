@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"context"
+	"playground/rest-api/gomasters/entity"
+	"sync"
+)
+
+// Repository keeps the audit log in memory, in the order it was written.
+type Repository struct {
+	mu      sync.RWMutex
+	records []entity.AuditRecord
+}
+
+func NewRepository() *Repository {
+	return &Repository{}
+}
+
+func (ar *Repository) Save(_ context.Context, r *entity.AuditRecord) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	ar.records = append(ar.records, copyRecord(r))
+	return nil
+}
+
+func (ar *Repository) History(_ context.Context, entityId string) ([]*entity.AuditRecord, error) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	var records []*entity.AuditRecord
+	for _, r := range ar.records {
+		if r.EntityID == entityId {
+			r := copyRecord(&r)
+			records = append(records, &r)
+		}
+	}
+	return records, nil
+}
+
+// Snapshot lets the repository take part in memory.TxManager transactions.
+func (ar *Repository) Snapshot() func() {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	n := len(ar.records)
+	return func() {
+		ar.mu.Lock()
+		defer ar.mu.Unlock()
+
+		ar.records = ar.records[:n]
+	}
+}
+
+func copyRecord(r *entity.AuditRecord) entity.AuditRecord {
+	c := *r
+	c.Changes = make([]*entity.FieldChange, len(r.Changes))
+	for i, change := range r.Changes {
+		change := *change
+		c.Changes[i] = &change
+	}
+	return c
+}
@@ -0,0 +1,81 @@
+package idempotency
+
+import (
+	"context"
+	"playground/rest-api/gomasters/entity"
+	"sync"
+	"time"
+)
+
+type requestKey struct {
+	key, caller string
+}
+
+// Repository keeps idempotent requests in memory.
+type Repository struct {
+	mu       sync.Mutex
+	requests map[requestKey]entity.IdempotentRequest
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		requests: make(map[requestKey]entity.IdempotentRequest),
+	}
+}
+
+func (ir *Repository) Reserve(_ context.Context, r *entity.IdempotentRequest) (*entity.IdempotentRequest, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	k := requestKey{key: r.Key, caller: r.Caller}
+	if existing, ok := ir.requests[k]; ok && existing.Expires.After(r.Created) {
+		existing.Body = append([]byte(nil), existing.Body...)
+		return &existing, nil
+	}
+
+	ir.requests[k] = entity.IdempotentRequest{
+		Key: r.Key, Caller: r.Caller, BodyHash: r.BodyHash, Created: r.Created, Expires: r.Expires,
+	}
+	return nil, nil
+}
+
+func (ir *Repository) Complete(_ context.Context, r *entity.IdempotentRequest, now time.Time) (bool, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	k := requestKey{key: r.Key, caller: r.Caller}
+	stored, ok := ir.requests[k]
+	if !ok || stored.BodyHash != r.BodyHash || stored.Done() || !stored.Expires.After(now) {
+		return false, nil
+	}
+
+	stored.Status, stored.ContentType, stored.Expires = r.Status, r.ContentType, r.Expires
+	stored.Body = append([]byte(nil), r.Body...)
+	ir.requests[k] = stored
+	return true, nil
+}
+
+func (ir *Repository) Release(_ context.Context, key, caller string) error {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	k := requestKey{key: key, caller: caller}
+	if stored, ok := ir.requests[k]; ok && !stored.Done() {
+		delete(ir.requests, k)
+	}
+	return nil
+}
+
+func (ir *Repository) DeleteExpired(_ context.Context, now time.Time) (int, error) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+
+	deleted := 0
+	for k, r := range ir.requests {
+		if !r.Expires.After(now) {
+			delete(ir.requests, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
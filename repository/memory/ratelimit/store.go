@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"playground/rest-api/gomasters/entity"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have filled up again are dropped.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	entity.TokenBucket
+	limit entity.RateLimit
+}
+
+// Store keeps the token buckets of one process in memory. Instances behind
+// a load balancer each count their own requests.
+type Store struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (s *Store) Take(_ context.Context, key string, limit entity.RateLimit, now time.Time) (entity.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	switch {
+	case !ok:
+		b = &bucket{limit: limit}
+		s.buckets[key] = b
+	case b.limit != limit:
+		// The tokens left are kept, so that a drained client is not given
+		// a full bucket by a reload; they refill at the new rate from now.
+		b.Refill(b.limit, now)
+		b.Tokens = math.Min(b.Tokens, float64(limit.Limit))
+		b.limit = limit
+	}
+	return b.Take(limit, now), nil
+}
+
+// sweep drops full buckets, a new bucket is full as well.
+func (s *Store) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if b.Full(b.limit, now) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// Len returns the number of buckets kept.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.buckets)
+}
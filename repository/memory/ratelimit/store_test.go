@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"playground/rest-api/gomasters/entity"
+	"testing"
+	"time"
+)
+
+func TestStore_Take(t *testing.T) {
+	limit := entity.RateLimit{Limit: 2, Period: time.Minute}
+	start := time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC)
+
+	tc := []struct {
+		name     string
+		at       time.Duration
+		expected entity.RateLimitResult
+	}{
+		{
+			name:     "full bucket",
+			expected: entity.RateLimitResult{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second},
+		},
+		{
+			name:     "last token",
+			expected: entity.RateLimitResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:     "empty bucket",
+			at:       10 * time.Second,
+			expected: entity.RateLimitResult{Limit: 2, Remaining: 0, Reset: 50 * time.Second, RetryAfter: 20 * time.Second},
+		},
+		{
+			name:     "refilled token",
+			at:       30 * time.Second,
+			expected: entity.RateLimitResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute},
+		},
+	}
+
+	store := NewStore()
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := store.Take(context.Background(), "GET /users ip:127.0.0.1", limit, start.Add(test.at))
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected, res)
+		})
+	}
+}
+
+func TestStore_Sweep(t *testing.T) {
+	limit := entity.RateLimit{Limit: 2, Period: time.Minute}
+	start := time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC)
+
+	store := NewStore()
+	_, _ = store.Take(context.Background(), "idle", limit, start)
+	_, _ = store.Take(context.Background(), "busy", limit, start.Add(50*time.Second))
+	_, _ = store.Take(context.Background(), "busy", limit, start.Add(55*time.Second))
+	assert.EqualValues(t, 2, store.Len())
+
+	// The idle bucket has filled up again by the next sweep, the busy one not.
+	_, _ = store.Take(context.Background(), "busy", limit, start.Add(sweepInterval))
+	assert.EqualValues(t, 1, store.Len())
+}
+
+func TestStore_TakeLimitChange(t *testing.T) {
+	start := time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC)
+
+	type expected struct {
+		Result entity.RateLimitResult
+	}
+
+	type payload struct {
+		Before entity.RateLimit
+		Taken  int
+		After  entity.RateLimit
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "drained client stays throttled at a higher limit",
+			expected: expected{Result: entity.RateLimitResult{
+				Limit: 10, Remaining: 0, Reset: time.Minute, RetryAfter: 6 * time.Second,
+			}},
+			payload: payload{
+				Before: entity.RateLimit{Limit: 2, Period: time.Minute},
+				Taken:  2,
+				After:  entity.RateLimit{Limit: 10, Period: time.Minute},
+			},
+		},
+		{
+			name: "tokens clamped to a lower limit",
+			expected: expected{Result: entity.RateLimitResult{
+				Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second,
+			}},
+			payload: payload{
+				Before: entity.RateLimit{Limit: 10, Period: time.Minute},
+				Taken:  1,
+				After:  entity.RateLimit{Limit: 2, Period: time.Minute},
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore()
+			for i := 0; i < test.payload.Taken; i++ {
+				_, _ = store.Take(context.Background(), "ip:127.0.0.1", test.payload.Before, start)
+			}
+
+			res, err := store.Take(context.Background(), "ip:127.0.0.1", test.payload.After, start)
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected.Result, res)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Package memory holds what the in-memory repositories share.
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+// Snapshotter is implemented by in-memory repositories that take part in
+// transactions. Snapshot copies the current state and returns a function
+// restoring it.
+type Snapshotter interface {
+	Snapshot() (restore func())
+}
+
+type txKey struct{}
+
+// TxManager is the in-memory counterpart of the database transaction
+// managers, for tests and development only. Transactions run one at a time,
+// and a failed one restores every store to its state from before the
+// transaction: writes made outside of transactions meanwhile are lost too,
+// so it is no substitute for database transactions in production.
+type TxManager struct {
+	mu     sync.Mutex
+	stores []Snapshotter
+}
+
+func NewTxManager(stores ...Snapshotter) *TxManager {
+	return &TxManager{
+		stores: stores,
+	}
+}
+
+// WithinTx runs fn as a transaction over the stores. A call inside another
+// transaction joins it.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	restores := make([]func(), len(m.stores))
+	for i, s := range m.stores {
+		restores[i] = s.Snapshot()
+	}
+
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		for _, restore := range restores {
+			restore()
+		}
+		return err
+	}
+	return nil
+}
+
+// InTx reports whether ctx carries a transaction started by WithinTx.
+func InTx(ctx context.Context) bool {
+	return ctx.Value(txKey{}) != nil
+}
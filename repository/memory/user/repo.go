@@ -0,0 +1,240 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"sort"
+	"sync"
+)
+
+// Repository keeps users in memory. It follows the postgres repository:
+// emails are unique, lists are ordered by Created and ID, and missing users
+// are reported with errors matching entity.ErrNotFound.
+type Repository struct {
+	mu    sync.RWMutex
+	users map[string]entity.User
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		users: make(map[string]entity.User),
+	}
+}
+
+func (ur *Repository) GetAll(_ context.Context) ([]*entity.User, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	return ur.sorted(), nil
+}
+
+// StreamAll hands fn a snapshot taken under the lock, so fn may call back
+// into the repository.
+func (ur *Repository) StreamAll(_ context.Context, fn func(*entity.User) error) error {
+	ur.mu.RLock()
+	users := ur.sorted()
+	ur.mu.RUnlock()
+
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ur *Repository) Create(_ context.Context, u *entity.User) (string, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	if err := ur.create(u); err != nil {
+		return "", err
+	}
+	return u.ID, nil
+}
+
+func (ur *Repository) GetById(_ context.Context, id string) (*entity.User, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	u, ok := ur.users[id]
+	if !ok {
+		return nil, fmt.Errorf("get user by id error: %w", entity.ErrNotFound)
+	}
+	return &u, nil
+}
+
+func (ur *Repository) GetByIds(_ context.Context, ids []string) ([]*entity.User, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	var users []*entity.User
+	for _, id := range ids {
+		if u, ok := ur.users[id]; ok {
+			users = append(users, &u)
+		}
+	}
+	return users, nil
+}
+
+func (ur *Repository) GetByEmail(_ context.Context, email string) (*entity.User, error) {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	for _, u := range ur.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, fmt.Errorf("get user by email error: %w", entity.ErrNotFound)
+}
+
+func (ur *Repository) Update(_ context.Context, userId string, u *entity.User) (string, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	if err := ur.update(userId, u); err != nil {
+		return "", err
+	}
+	return u.ID, nil
+}
+
+func (ur *Repository) Delete(_ context.Context, userId string) (string, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	if err := ur.delete(userId); err != nil {
+		return "", err
+	}
+	return userId, nil
+}
+
+// Batch applies the operations under one lock. In atomic mode the users are
+// restored from a copy when an operation fails.
+func (ur *Repository) Batch(_ context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	var backup map[string]entity.User
+	if atomic {
+		backup = ur.copyUsers()
+	}
+
+	results := entity.NewBatchResults(ops)
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case entity.BatchCreate:
+			err = ur.create(op.User)
+		case entity.BatchUpdate:
+			err = ur.update(op.ID, op.User)
+		case entity.BatchDelete:
+			err = ur.delete(op.ID)
+		default:
+			err = fmt.Errorf("unknown batch operation: %s", op.Op)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		results[i].Error = err.Error()
+		if atomic {
+			ur.users = backup
+			for _, r := range results {
+				if r.Error == "" {
+					r.Error = "rolled back"
+				}
+			}
+			return results, fmt.Errorf("batch error: %v", err)
+		}
+	}
+
+	return results, nil
+}
+
+// Snapshot lets the repository take part in memory.TxManager transactions.
+func (ur *Repository) Snapshot() func() {
+	ur.mu.RLock()
+	defer ur.mu.RUnlock()
+
+	users := ur.copyUsers()
+	return func() {
+		ur.mu.Lock()
+		defer ur.mu.Unlock()
+
+		ur.users = users
+	}
+}
+
+func (ur *Repository) copyUsers() map[string]entity.User {
+	users := make(map[string]entity.User, len(ur.users))
+	for id, u := range ur.users {
+		users[id] = u
+	}
+	return users
+}
+
+func (ur *Repository) create(u *entity.User) error {
+	if _, ok := ur.users[u.ID]; ok {
+		return fmt.Errorf("create error: %w", entity.Conflict("ID"))
+	}
+	if err := ur.checkEmail(u.ID, u.Email); err != nil {
+		return fmt.Errorf("create error: %w", err)
+	}
+
+	ur.users[u.ID] = *u
+	return nil
+}
+
+func (ur *Repository) update(userId string, u *entity.User) error {
+	if _, ok := ur.users[userId]; !ok {
+		return fmt.Errorf("update error: %w", entity.ErrNotFound)
+	}
+	if _, ok := ur.users[u.ID]; ok && u.ID != userId {
+		return fmt.Errorf("update error: %w", entity.Conflict("ID"))
+	}
+	if err := ur.checkEmail(userId, u.Email); err != nil {
+		return fmt.Errorf("update error: %w", err)
+	}
+
+	delete(ur.users, userId)
+	ur.users[u.ID] = *u
+	return nil
+}
+
+func (ur *Repository) delete(userId string) error {
+	if _, ok := ur.users[userId]; !ok {
+		return entity.NotFound("no row found to delete")
+	}
+
+	delete(ur.users, userId)
+	return nil
+}
+
+// checkEmail plays the role of the UNIQUE constraint on users.email.
+func (ur *Repository) checkEmail(ownerId, email string) error {
+	for id, u := range ur.users {
+		if u.Email == email && id != ownerId {
+			return entity.Conflict("Email")
+		}
+	}
+	return nil
+}
+
+func (ur *Repository) sorted() []*entity.User {
+	var users []*entity.User
+	for _, u := range ur.users {
+		u := u
+		users = append(users, &u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].Created.Equal(users[j].Created) {
+			return users[i].Created.Before(users[j].Created)
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
@@ -0,0 +1,71 @@
+package user
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/memory"
+	"playground/rest-api/gomasters/repository/memory/audit"
+	"playground/rest-api/gomasters/repository/memory/idempotency"
+	"playground/rest-api/gomasters/repository/memory/version"
+	"playground/rest-api/gomasters/repository/repotest"
+	idempotencyUsecase "playground/rest-api/gomasters/usecase/idempotency"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"testing"
+	"time"
+)
+
+func TestRepository_Contract(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, func(t *testing.T) userUsecase.Repository {
+		return NewRepository()
+	})
+}
+
+func TestRepository_Tx(t *testing.T) {
+	repotest.RunTxTests(t, func(t *testing.T) (userUsecase.Repository, userUsecase.TxManager) {
+		repo := NewRepository()
+		return repo, memory.NewTxManager(repo)
+	})
+}
+
+func TestAuditRepository_Contract(t *testing.T) {
+	repotest.RunAuditRepositoryTests(t, func(t *testing.T) userUsecase.AuditRepository {
+		return audit.NewRepository()
+	})
+}
+
+func TestVersionRepository_Contract(t *testing.T) {
+	repotest.RunVersionRepositoryTests(t, func(t *testing.T) userUsecase.VersionRepository {
+		return version.NewRepository()
+	})
+}
+
+func TestIdempotencyRepository_Contract(t *testing.T) {
+	repotest.RunIdempotencyRepositoryTests(t, func(t *testing.T) idempotencyUsecase.Repository {
+		return idempotency.NewRepository()
+	})
+}
+
+func TestRepository_Copies(t *testing.T) {
+	user := &entity.User{
+		ID:        "f2a44f36-0956-4019-9134-bbb0a2f63b01",
+		Firstname: "NewUser",
+		Lastname:  "NewUserLastname",
+		Email:     "user2@gmail.com",
+		Age:       30,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+
+	userRepo := NewRepository()
+	_, err := userRepo.Create(context.Background(), user)
+	assert.Nil(t, err)
+
+	// Changing the created or a returned user must not change the stored one.
+	user.Firstname = "Changed"
+	stored, _ := userRepo.GetById(context.Background(), user.ID)
+	assert.EqualValues(t, "NewUser", stored.Firstname)
+
+	stored.Firstname = "Changed"
+	stored, _ = userRepo.GetByEmail(context.Background(), user.Email)
+	assert.EqualValues(t, "NewUser", stored.Firstname)
+}
@@ -0,0 +1,123 @@
+package version
+
+import (
+	"context"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"sync"
+	"time"
+)
+
+// Repository keeps the versions of the users in memory, in the order they were written.
+type Repository struct {
+	mu       sync.RWMutex
+	versions []entity.UserVersion
+}
+
+func NewRepository() *Repository {
+	return &Repository{}
+}
+
+func (vr *Repository) Save(_ context.Context, u *entity.User, at time.Time) error {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	vr.close(u.ID, at)
+
+	version := 0
+	for _, v := range vr.versions {
+		if v.User.ID == u.ID && v.Version > version {
+			version = v.Version
+		}
+	}
+
+	user := *u
+	vr.versions = append(vr.versions, entity.UserVersion{Version: version + 1, User: &user, ValidFrom: at.UTC()})
+	return nil
+}
+
+func (vr *Repository) Close(_ context.Context, userId string, at time.Time) error {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	vr.close(userId, at)
+	return nil
+}
+
+func (vr *Repository) AsOf(_ context.Context, userId string, at time.Time) (*entity.User, error) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+
+	for _, v := range vr.versions {
+		if v.User.ID == userId && !v.ValidFrom.After(at) && (v.ValidTo == nil || v.ValidTo.After(at)) {
+			user := *v.User
+			return &user, nil
+		}
+	}
+	return nil, fmt.Errorf("get user as of %v error: %w", at, entity.ErrNotFound)
+}
+
+func (vr *Repository) Version(_ context.Context, userId string, version int) (*entity.UserVersion, error) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+
+	for _, v := range vr.versions {
+		if v.User.ID == userId && v.Version == version {
+			v := copyVersion(&v)
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("get user version %d error: %w", version, entity.ErrNotFound)
+}
+
+func (vr *Repository) Versions(_ context.Context, userId string) ([]*entity.UserVersion, error) {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+
+	var versions []*entity.UserVersion
+	for _, v := range vr.versions {
+		if v.User.ID == userId {
+			v := copyVersion(&v)
+			versions = append(versions, &v)
+		}
+	}
+	return versions, nil
+}
+
+// Snapshot lets the repository take part in memory.TxManager transactions.
+func (vr *Repository) Snapshot() func() {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+
+	versions := make([]entity.UserVersion, len(vr.versions))
+	for i, v := range vr.versions {
+		versions[i] = copyVersion(&v)
+	}
+	return func() {
+		vr.mu.Lock()
+		defer vr.mu.Unlock()
+
+		vr.versions = versions
+	}
+}
+
+// close ends the current version of the user, if there is one.
+func (vr *Repository) close(userId string, at time.Time) {
+	for i, v := range vr.versions {
+		if v.User.ID == userId && v.ValidTo == nil {
+			validTo := at.UTC()
+			vr.versions[i].ValidTo = &validTo
+		}
+	}
+}
+
+func copyVersion(v *entity.UserVersion) entity.UserVersion {
+	c := *v
+	user := *v.User
+	c.User = &user
+	if v.ValidTo != nil {
+		validTo := *v.ValidTo
+		c.ValidTo = &validTo
+	}
+	return c
+}
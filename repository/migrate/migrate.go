@@ -0,0 +1,183 @@
+// Package migrate applies and rolls back the versioned SQL migrations of the
+// postgres and SQLite schemas and records them in schema_migrations.
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migration is one schema change. Down undoes Up and is empty for migrations
+// that cannot be rolled back.
+type Migration struct {
+	Version string
+	Up      string
+	Down    string
+}
+
+// Status tells whether a migration has been applied, and when.
+type Status struct {
+	Version string
+	Applied *time.Time
+}
+
+// Load reads the migrations of dir in fsys, VERSION.up.sql and the optional
+// VERSION.down.sql, ordered by version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations error: %v", err)
+	}
+
+	byVersion := make(map[string]*Migration)
+	for _, e := range entries {
+		version, direction := strings.TrimSuffix(e.Name(), ".up.sql"), "up"
+		if version == e.Name() {
+			version, direction = strings.TrimSuffix(e.Name(), ".down.sql"), "down"
+		}
+		if version == e.Name() {
+			return nil, fmt.Errorf("migration %s is neither .up.sql nor .down.sql", e.Name())
+		}
+
+		script, err := fs.ReadFile(fsys, dir+"/"+e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s error: %v", e.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s has no .up.sql", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the pending migrations in order, each one in its own
+// transaction, and returns their versions.
+func Up(db *sql.DB, migrations []Migration) ([]string, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err = run(db, m.Version, m.Up, "INSERT INTO schema_migrations(version) VALUES ($1);"); err != nil {
+			return done, err
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns their versions.
+func Down(db *sql.DB, migrations []Migration, steps int) ([]string, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []string
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %s cannot be rolled back", m.Version)
+		}
+		if err = run(db, m.Version, m.Down, "DELETE FROM schema_migrations WHERE version=$1;"); err != nil {
+			return done, err
+		}
+		done = append(done, m.Version)
+	}
+	return done, nil
+}
+
+// Statuses returns the status of every migration in order.
+func Statuses(db *sql.DB, migrations []Migration) ([]Status, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, m := range migrations {
+		statuses[i].Version = m.Version
+		if at, ok := applied[m.Version]; ok {
+			statuses[i].Applied = &at
+		}
+	}
+	return statuses, nil
+}
+
+func appliedVersions(db *sql.DB) (map[string]time.Time, error) {
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version text PRIMARY KEY, applied timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP);"); err != nil {
+		return nil, fmt.Errorf("create schema_migrations error: %v", err)
+	}
+
+	rows, err := db.Query("SELECT version, applied FROM schema_migrations;")
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	applied := make(map[string]time.Time)
+	for rows.Next() {
+		var version string
+		var at time.Time
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("scan schema_migrations error: %v", err)
+		}
+		applied[version] = at.UTC()
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("read schema_migrations error: %v", err)
+	}
+	return applied, nil
+}
+
+// run executes script and records it with record in one transaction.
+func run(db *sql.DB, version, script, record string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %s begin error: %v", version, err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %s error: %v", version, err)
+	}
+	if _, err = tx.Exec(record, version); err != nil {
+		return fmt.Errorf("record migration %s error: %v", version, err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("migration %s commit error: %v", version, err)
+	}
+	return nil
+}
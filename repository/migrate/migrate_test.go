@@ -0,0 +1,139 @@
+package migrate_test
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/migrate"
+	"playground/rest-api/gomasters/repository/postgres"
+	"playground/rest-api/gomasters/repository/sqlite"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"m/0001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"m/0002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int); INSERT INTO b VALUES (1);")},
+		"m/0002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"m/0003_c.up.sql":   {Data: []byte("CREATE TABLE c (id int);")},
+	}
+	ms, err := migrate.Load(fsys, "m")
+	require.Nil(t, err)
+	require.Len(t, ms, 3)
+	assert.EqualValues(t, "0002_b", ms[1].Version)
+	assert.Empty(t, ms[2].Down)
+
+	db, err := sqlite.Connect(":memory:")
+	require.Nil(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer db.Close()
+
+	done, err := migrate.Up(db, ms[:2])
+	require.Nil(t, err)
+	assert.EqualValues(t, []string{"0001_a", "0002_b"}, done)
+
+	statuses, err := migrate.Statuses(db, ms)
+	require.Nil(t, err)
+	assert.NotNil(t, statuses[1].Applied)
+	assert.Nil(t, statuses[2].Applied)
+
+	done, err = migrate.Up(db, ms)
+	require.Nil(t, err)
+	assert.EqualValues(t, []string{"0003_c"}, done, "applied migrations are skipped")
+
+	done, err = migrate.Down(db, ms, 2)
+	assert.NotNil(t, err, "0003_c has no down migration")
+	assert.Empty(t, done)
+
+	done, err = migrate.Down(db, ms[:2], 1)
+	require.Nil(t, err)
+	assert.EqualValues(t, []string{"0002_b"}, done)
+	_, err = db.Exec("SELECT * FROM b;")
+	assert.NotNil(t, err, "b is dropped")
+
+	fsys["m/0004_d.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE d;")}
+	_, err = migrate.Load(fsys, "m")
+	assert.NotNil(t, err, "down without up")
+}
+
+func TestMigrate_SQLiteRoundTrip(t *testing.T) {
+	ms, err := sqlite.Migrations()
+	require.Nil(t, err)
+
+	db, err := sqlite.Connect(":memory:")
+	require.Nil(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer db.Close()
+
+	_, err = migrate.Up(db, ms)
+	require.Nil(t, err)
+	done, err := migrate.Down(db, ms, len(ms))
+	require.Nil(t, err)
+	assert.Len(t, done, len(ms))
+	done, err = migrate.Up(db, ms)
+	require.Nil(t, err)
+	assert.Len(t, done, len(ms))
+}
+
+func TestMigrate_SQLiteEmailLower(t *testing.T) {
+	ms, err := sqlite.Migrations()
+	require.Nil(t, err)
+
+	db, err := sqlite.Connect(":memory:")
+	require.Nil(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer db.Close()
+
+	// A row written before emails were lowercased is backfilled.
+	_, err = migrate.Up(db, ms[:5])
+	require.Nil(t, err)
+	_, err = db.Exec(`INSERT INTO users(id, first_name, last_name, email, age, created)
+		VALUES ('1', 'First', 'Last', ' User1@GMail.com', 20, '2022-05-07 00:00:00')`)
+	require.Nil(t, err)
+	_, err = migrate.Up(db, ms)
+	require.Nil(t, err)
+
+	var email string
+	require.Nil(t, db.QueryRow("SELECT email FROM users WHERE id = '1'").Scan(&email))
+	assert.EqualValues(t, "user1@gmail.com", email)
+
+	_, err = db.Exec(`INSERT INTO users(id, first_name, last_name, email, age, created)
+		VALUES ('2', 'First', 'Last', 'USER1@gmail.com', 20, '2022-05-07 00:00:00')`)
+	require.NotNil(t, err)
+	assert.EqualValues(t, entity.Conflict("Email"), sqlite.Conflict(err))
+}
+
+func TestMigrate_SQLiteHistoryBackfill(t *testing.T) {
+	ms, err := sqlite.Migrations()
+	require.Nil(t, err)
+
+	db, err := sqlite.Connect(":memory:")
+	require.Nil(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer db.Close()
+
+	// A user created before the history existed gets its first version.
+	_, err = migrate.Up(db, ms[:2])
+	require.Nil(t, err)
+	_, err = db.Exec(`INSERT INTO users(id, first_name, last_name, email, age, created)
+		VALUES ('1', 'First', 'Last', 'user1@gmail.com', 20, '2022-05-07 00:00:00')`)
+	require.Nil(t, err)
+	_, err = migrate.Up(db, ms)
+	require.Nil(t, err)
+
+	var version int
+	var current bool
+	require.Nil(t, db.QueryRow("SELECT version, valid_to IS NULL FROM users_history WHERE id = '1'").Scan(&version, &current))
+	assert.EqualValues(t, 1, version)
+	assert.True(t, current)
+}
+
+func TestMigrate_PostgresFiles(t *testing.T) {
+	ms, err := postgres.Migrations()
+	require.Nil(t, err)
+	for _, m := range ms {
+		assert.NotEmpty(t, m.Down, m.Version)
+	}
+}
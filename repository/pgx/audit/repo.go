@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"playground/rest-api/gomasters/entity"
+	pgxRepo "playground/rest-api/gomasters/repository/pgx"
+)
+
+// Repository is the native pgx implementation of the audit log repository.
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{
+		pool: pool,
+	}
+}
+
+func (ar *Repository) Save(ctx context.Context, r *entity.AuditRecord) error {
+	changes, err := json.Marshal(r.Changes)
+	if err != nil {
+		return fmt.Errorf("marshal audit changes error: %v", err)
+	}
+
+	if _, err = pgxRepo.Conn(ctx, ar.pool).Exec(ctx,
+		"INSERT INTO audit_log(id, entity_id, action, actor, request_id, changes, created) VALUES ($1, $2, $3, $4, $5, $6, $7);",
+		r.ID, r.EntityID, r.Action, r.Actor, r.RequestID, changes, r.Created); err != nil {
+		return fmt.Errorf("save audit record error: %v", err)
+	}
+
+	return nil
+}
+
+func (ar *Repository) History(ctx context.Context, entityId string) ([]*entity.AuditRecord, error) {
+	rows, err := pgxRepo.Conn(ctx, ar.pool).Query(ctx,
+		"SELECT id, entity_id, action, actor, request_id, changes, created FROM audit_log WHERE entity_id=$1 ORDER BY seq;",
+		entityId)
+	if err != nil {
+		return nil, fmt.Errorf("get audit history query error: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*entity.AuditRecord
+	for rows.Next() {
+		var r entity.AuditRecord
+		var changes []byte
+		if err = rows.Scan(&r.ID, &r.EntityID, &r.Action, &r.Actor, &r.RequestID, &changes, &r.Created); err != nil {
+			return nil, fmt.Errorf("get audit history rows scan error: %v", err)
+		}
+		if err = json.Unmarshal(changes, &r.Changes); err != nil {
+			return nil, fmt.Errorf("unmarshal audit changes error: %v", err)
+		}
+		r.Created = r.Created.UTC()
+
+		records = append(records, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get audit history rows error: %v", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,121 @@
+package pgx
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"playground/rest-api/gomasters/repository/postgres"
+	"time"
+)
+
+// Querier is implemented by both *pgxpool.Pool and pgx.Tx.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+type txKey struct{}
+
+// TxManager starts transactions on the pool and hands them to the pgx
+// repositories through the context. It runs transactions again after
+// serialization failures and deadlocks.
+type TxManager struct {
+	pool       *pgxpool.Pool
+	isolation  pgx.TxIsoLevel
+	maxRetries int
+}
+
+// NewTxManager takes the isolation as named in configuration, such as
+// "repeatable read"; an empty one is the server default.
+func NewTxManager(pool *pgxpool.Pool, isolation string, maxRetries int) *TxManager {
+	return &TxManager{
+		pool: pool, isolation: pgx.TxIsoLevel(isolation), maxRetries: maxRetries,
+	}
+}
+
+// WithinTx runs fn in a transaction carried by the context passed to fn and
+// commits it when fn succeeds. A call inside another transaction joins it.
+// fn may run several times, so it must not have side effects outside of the database.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := FromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := m.run(ctx, fn)
+		if err == nil || !postgres.IsRetryable(err) || attempt >= m.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+		}
+	}
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := m.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: m.isolation})
+	if err != nil {
+		return fmt.Errorf("begin tx error: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback(ctx)
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit tx error: %w", err)
+	}
+	return nil
+}
+
+// FromContext returns the transaction started by WithinTx, if any.
+func FromContext(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(pgx.Tx)
+	return tx, ok
+}
+
+// InTx reports whether ctx carries a transaction.
+func InTx(ctx context.Context) bool {
+	_, ok := FromContext(ctx)
+	return ok
+}
+
+// Conn returns the transaction carried by ctx, or the pool outside of one.
+func Conn(ctx context.Context, pool *pgxpool.Pool) Querier {
+	if tx, ok := FromContext(ctx); ok {
+		return tx
+	}
+	return pool
+}
+
+// Run runs fn in the transaction carried by ctx, or else in a new one that is
+// committed when fn succeeds.
+func Run(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	if tx, ok := FromContext(ctx); ok {
+		return fn(tx)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback(ctx)
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit tx error: %v", err)
+	}
+	return nil
+}
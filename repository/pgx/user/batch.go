@@ -0,0 +1,186 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"playground/rest-api/gomasters/entity"
+	pgxRepo "playground/rest-api/gomasters/repository/pgx"
+	"playground/rest-api/gomasters/repository/postgres"
+	"playground/rest-api/gomasters/repository/postgres/mapper"
+)
+
+// batchCopyChunk limits how many rows one COPY holds in memory.
+const batchCopyChunk = 1000
+
+// Batch runs all operations in the transaction carried by ctx or in its own.
+// Consecutive creates are written with COPY. In atomic mode the first failure
+// rolls back the whole batch; otherwise every failed operation is rolled back
+// to its savepoint and reported in its result while the rest is committed.
+func (ur *Repository) Batch(ctx context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error) {
+	results := entity.NewBatchResults(ops)
+
+	var batchErr error
+	err := pgxRepo.Run(ctx, ur.pool, func(tx pgx.Tx) error {
+		for start := 0; start < len(ops); {
+			end := start + 1
+			if ops[start].Op == entity.BatchCreate {
+				for end < len(ops) && ops[end].Op == entity.BatchCreate && end-start < batchCopyChunk {
+					end++
+				}
+			}
+
+			if atomic {
+				if err := runOperations(ctx, tx, ops[start:end]); err != nil {
+					for _, r := range results {
+						r.Error = "rolled back"
+					}
+					for _, r := range results[start:end] {
+						r.Error = err.Error()
+					}
+					batchErr = fmt.Errorf("batch error: %v", err)
+					return batchErr
+				}
+			} else if err := runOperationsEach(ctx, tx, ops[start:end], results[start:end]); err != nil {
+				return err
+			}
+
+			start = end
+		}
+		return nil
+	})
+	if batchErr != nil {
+		return results, batchErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("batch error: %v", err)
+	}
+
+	return results, nil
+}
+
+// runOperationsEach tries the whole run under one savepoint and only falls
+// back to a savepoint per operation when the run fails, to find the culprits.
+func runOperationsEach(ctx context.Context, tx pgx.Tx, ops []*entity.BatchOperation, results []*entity.BatchResult) error {
+	err := withSavepoint(ctx, tx, func(sp pgx.Tx) error {
+		return runOperations(ctx, sp, ops)
+	})
+	if err == nil || len(ops) == 1 {
+		if err != nil {
+			results[0].Error = err.Error()
+		}
+		return nil
+	}
+
+	for i, op := range ops {
+		err = withSavepoint(ctx, tx, func(sp pgx.Tx) error {
+			return runOperations(ctx, sp, []*entity.BatchOperation{op})
+		})
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	return nil
+}
+
+// withSavepoint runs fn in a pgx pseudo nested transaction, which is a savepoint.
+func withSavepoint(ctx context.Context, tx pgx.Tx, fn func(pgx.Tx) error) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("savepoint error: %v", err)
+	}
+
+	if err = fn(sp); err != nil {
+		if rbErr := sp.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("rollback to savepoint error: %v", rbErr)
+		}
+		return err
+	}
+
+	return sp.Commit(ctx)
+}
+
+// runOperations executes a run of operations produced by Batch: either
+// consecutive creates or a single update or delete.
+func runOperations(ctx context.Context, tx pgx.Tx, ops []*entity.BatchOperation) error {
+	op := ops[0]
+	switch op.Op {
+	case entity.BatchCreate:
+		return copyUsers(ctx, tx, ops)
+	case entity.BatchUpdate:
+		b := &pgx.Batch{}
+		b.Queue(mapper.UpdateUser()+";", append(mapper.UserValues(op.User), op.ID)...)
+		if err := queueEvent(b, entity.EventUserUpdated, op.User); err != nil {
+			return err
+		}
+
+		if err := sendBatch(ctx, tx, b); err != nil {
+			if errors.Is(err, entity.ErrNotFound) {
+				return fmt.Errorf("update error: %w", err)
+			}
+			if conflict := postgres.Conflict(err); conflict != nil {
+				return fmt.Errorf("update error: %w", conflict)
+			}
+			return fmt.Errorf("update error: %v", err)
+		}
+		return nil
+	case entity.BatchDelete:
+		b := &pgx.Batch{}
+		b.Queue("DELETE FROM users WHERE id=$1;", op.ID)
+		if err := queueEvent(b, entity.EventUserDeleted, &entity.User{ID: op.ID}); err != nil {
+			return err
+		}
+
+		if err := sendBatch(ctx, tx, b); err != nil {
+			if errors.Is(err, entity.ErrNotFound) {
+				return entity.NotFound("no row found to delete")
+			}
+			return fmt.Errorf("delete error: %v", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown batch operation: %s", op.Op)
+	}
+}
+
+func copyUsers(ctx context.Context, tx pgx.Tx, ops []*entity.BatchOperation) error {
+	users := make([][]interface{}, len(ops))
+	events := make([][]interface{}, len(ops))
+	for i, op := range ops {
+		u := op.User
+		users[i] = mapper.UserValues(u)
+
+		e, err := entity.NewUserEvent(entity.EventUserCreated, u)
+		if err != nil {
+			return err
+		}
+		events[i] = []interface{}{e.ID, e.Type, e.EntityID, e.Payload, e.Created}
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"users"},
+		mapper.UserColumnNames(), pgx.CopyFromRows(users)); err != nil {
+		if conflict := postgres.Conflict(err); conflict != nil {
+			return fmt.Errorf("create error: %w", conflict)
+		}
+		return fmt.Errorf("create error: %v", err)
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"outbox"},
+		[]string{"id", "event_type", "entity_id", "payload", "created"}, pgx.CopyFromRows(events)); err != nil {
+		return fmt.Errorf("save outbox event error: %v", err)
+	}
+	return nil
+}
+
+func queueEvent(b *pgx.Batch, eventType string, u *entity.User) error {
+	e, err := entity.NewUserEvent(eventType, u)
+	if err != nil {
+		return err
+	}
+
+	b.Queue("INSERT INTO outbox(id, event_type, entity_id, payload, created) VALUES ($1, $2, $3, $4, $5);",
+		e.ID, e.Type, e.EntityID, e.Payload, e.Created)
+	return nil
+}
@@ -0,0 +1,128 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/postgres/pgtest"
+	sqlUserRepo "playground/rest-api/gomasters/repository/postgres/user"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"testing"
+)
+
+// The benchmarks compare this repository with the database/sql one on the
+// same schema of the gomasters-db-test database:
+//
+//	go test -run none -bench . ./repository/pgx/user
+func benchRepositories(b *testing.B) map[string]userUsecase.Repository {
+	pool := newPool(b)
+
+	db, err := sql.Open("pgx", pgtest.DbString(b, schema))
+	require.Nil(b, err)
+	b.Cleanup(func() { _ = db.Close() })
+
+	return map[string]userUsecase.Repository{
+		"pgxpool":      NewRepository(pool),
+		"database/sql": sqlUserRepo.NewRepository(db),
+	}
+}
+
+func benchUser(n int) *entity.User {
+	u := entity.NewUser()
+	u.Firstname, u.Lastname, u.Age = "BenchUser", "BenchLastname", 30
+	u.Email = fmt.Sprintf("bench%d@gmail.com", n)
+	return u
+}
+
+func BenchmarkRepository_Create(b *testing.B) {
+	for name, repo := range benchRepositories(b) {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.Create(context.Background(), benchUser(i)); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.StopTimer()
+			for _, u := range mustGetAll(b, repo) {
+				_, _ = repo.Delete(context.Background(), u.ID)
+			}
+		})
+	}
+}
+
+func BenchmarkRepository_GetById(b *testing.B) {
+	for name, repo := range benchRepositories(b) {
+		b.Run(name, func(b *testing.B) {
+			u := benchUser(0)
+			_, err := repo.Create(context.Background(), u)
+			require.Nil(b, err)
+			b.Cleanup(func() { _, _ = repo.Delete(context.Background(), u.ID) })
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err = repo.GetById(context.Background(), u.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkRepository_GetAll(b *testing.B) {
+	for name, repo := range benchRepositories(b) {
+		b.Run(name, func(b *testing.B) {
+			ops := make([]*entity.BatchOperation, 1000)
+			for i := range ops {
+				u := benchUser(i)
+				ops[i] = &entity.BatchOperation{Op: entity.BatchCreate, ID: u.ID, User: u}
+			}
+			_, err := repo.(userUsecase.BatchRepository).Batch(context.Background(), ops, true)
+			require.Nil(b, err)
+			b.Cleanup(func() {
+				for _, op := range ops {
+					_, _ = repo.Delete(context.Background(), op.ID)
+				}
+			})
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				mustGetAll(b, repo)
+			}
+		})
+	}
+}
+
+func BenchmarkRepository_Batch(b *testing.B) {
+	for name, repo := range benchRepositories(b) {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ops := make([]*entity.BatchOperation, 100)
+				for j := range ops {
+					u := benchUser(i*len(ops) + j)
+					ops[j] = &entity.BatchOperation{Op: entity.BatchCreate, ID: u.ID, User: u}
+				}
+
+				if _, err := repo.(userUsecase.BatchRepository).Batch(context.Background(), ops, true); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.StopTimer()
+			for _, u := range mustGetAll(b, repo) {
+				_, _ = repo.Delete(context.Background(), u.ID)
+			}
+		})
+	}
+}
+
+func mustGetAll(b *testing.B, repo userUsecase.Repository) []*entity.User {
+	users, err := repo.GetAll(context.Background())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return users
+}
@@ -0,0 +1,192 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"playground/rest-api/gomasters/entity"
+	pgxRepo "playground/rest-api/gomasters/repository/pgx"
+	"playground/rest-api/gomasters/repository/postgres"
+	"playground/rest-api/gomasters/repository/postgres/mapper"
+)
+
+// Repository is the native pgx implementation of the user repository. It
+// writes the same users and outbox rows as the database/sql one, but sends
+// the statements of a write in one pgx.Batch round trip and bulk inserts with COPY.
+type Repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) *Repository {
+	return &Repository{
+		pool: pool,
+	}
+}
+
+func (ur *Repository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	var users []*entity.User
+	err := ur.StreamAll(ctx, func(u *entity.User) error {
+		user := *u
+		users = append(users, &user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (ur *Repository) StreamAll(ctx context.Context, fn func(*entity.User) error) error {
+	rows, err := pgxRepo.Conn(ctx, ur.pool).Query(ctx, mapper.SelectUsers()+" ORDER BY created, id;")
+	if err != nil {
+		return fmt.Errorf("get all users query error: %v", err)
+	}
+	defer rows.Close()
+
+	var u entity.User
+	for rows.Next() {
+		if err = mapper.ScanUser(rows, &u); err != nil {
+			return fmt.Errorf("get all users rows scan error: %v", err)
+		}
+
+		if err = fn(&u); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("get all users rows error: %v", err)
+	}
+	return nil
+}
+
+func (ur *Repository) Create(ctx context.Context, u *entity.User) (string, error) {
+	b := &pgx.Batch{}
+	b.Queue(mapper.InsertUsers(1)+";", mapper.UserValues(u)...)
+
+	if err := ur.write(ctx, b, entity.EventUserCreated, u); err != nil {
+		if conflict := postgres.Conflict(err); conflict != nil {
+			return "", fmt.Errorf("create error: %w", conflict)
+		}
+		return "", fmt.Errorf("create error: %v", err)
+	}
+
+	return u.ID, nil
+}
+
+func (ur *Repository) GetById(ctx context.Context, id string) (*entity.User, error) {
+	return ur.getBy(ctx, "id", id)
+}
+
+// GetByIds reads all users in one query.
+func (ur *Repository) GetByIds(ctx context.Context, ids []string) ([]*entity.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := pgxRepo.Conn(ctx, ur.pool).Query(ctx, mapper.SelectUsers()+" WHERE id IN ("+mapper.Params(1, len(ids))+");", args...)
+	if err != nil {
+		return nil, fmt.Errorf("get users by ids query error: %v", err)
+	}
+	defer rows.Close()
+
+	var users []*entity.User
+	for rows.Next() {
+		var u entity.User
+		if err = mapper.ScanUser(rows, &u); err != nil {
+			return nil, fmt.Errorf("get users by ids rows scan error: %v", err)
+		}
+
+		users = append(users, &u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get users by ids rows error: %v", err)
+	}
+	return users, nil
+}
+
+func (ur *Repository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+	return ur.getBy(ctx, "email", email)
+}
+
+func (ur *Repository) Update(ctx context.Context, userId string, u *entity.User) (string, error) {
+	b := &pgx.Batch{}
+	b.Queue(mapper.UpdateUser()+";", append(mapper.UserValues(u), userId)...)
+
+	if err := ur.write(ctx, b, entity.EventUserUpdated, u); err != nil {
+		if errors.Is(err, entity.ErrNotFound) {
+			return "", fmt.Errorf("update error: %w", err)
+		}
+		if conflict := postgres.Conflict(err); conflict != nil {
+			return "", fmt.Errorf("update error: %w", conflict)
+		}
+		return "", fmt.Errorf("update error: %v", err)
+	}
+
+	return u.ID, nil
+}
+
+func (ur *Repository) Delete(ctx context.Context, userId string) (string, error) {
+	b := &pgx.Batch{}
+	b.Queue("DELETE FROM users WHERE id=$1;", userId)
+
+	if err := ur.write(ctx, b, entity.EventUserDeleted, &entity.User{ID: userId}); err != nil {
+		if errors.Is(err, entity.ErrNotFound) {
+			return "", entity.NotFound("no row found to delete")
+		}
+		return "", fmt.Errorf("delete error: %v", err)
+	}
+
+	return userId, nil
+}
+
+func (ur *Repository) getBy(ctx context.Context, column, value string) (*entity.User, error) {
+	var u entity.User
+	row := pgxRepo.Conn(ctx, ur.pool).QueryRow(ctx, mapper.SelectUsers()+" WHERE "+column+"=$1;", value)
+	if err := mapper.ScanUser(row, &u); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("get user by %s error: %w", column, entity.ErrNotFound)
+		}
+		return nil, fmt.Errorf("get user by %s row scan error: %v", column, err)
+	}
+
+	return &u, nil
+}
+
+// write sends the queued users statement together with its outbox event in
+// one round trip, in the transaction carried by ctx or in its own. A
+// statement that changes no row means the user does not exist.
+func (ur *Repository) write(ctx context.Context, b *pgx.Batch, eventType string, u *entity.User) error {
+	if err := queueEvent(b, eventType, u); err != nil {
+		return err
+	}
+
+	return pgxRepo.Run(ctx, ur.pool, func(tx pgx.Tx) error {
+		return sendBatch(ctx, tx, b)
+	})
+}
+
+func sendBatch(ctx context.Context, tx pgx.Tx, b *pgx.Batch) error {
+	br := tx.SendBatch(ctx, b)
+
+	tag, err := br.Exec()
+	if err == nil && tag.RowsAffected() != 1 {
+		err = entity.ErrNotFound
+	}
+	for i := 1; i < b.Len() && err == nil; i++ {
+		_, err = br.Exec()
+	}
+
+	if closeErr := br.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
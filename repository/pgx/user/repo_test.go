@@ -0,0 +1,59 @@
+package user
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/require"
+	pgxRepo "playground/rest-api/gomasters/repository/pgx"
+	"playground/rest-api/gomasters/repository/pgx/audit"
+	"playground/rest-api/gomasters/repository/pgx/version"
+	"playground/rest-api/gomasters/repository/postgres/pgtest"
+	"playground/rest-api/gomasters/repository/repotest"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"testing"
+)
+
+// schema holds the tables of this package in the test database.
+const schema = "pgx_user_test"
+
+func newPool(tb testing.TB) *pgxpool.Pool {
+	pool, err := pgxRepo.NewPool(context.Background(), pgtest.DbString(tb, schema), pgxRepo.PoolOptions{StatementCacheCapacity: 512})
+	require.Nil(tb, err)
+
+	truncate := func() {
+		_, err := pool.Exec(context.Background(), "TRUNCATE "+pgtest.Tables+";")
+		require.Nil(tb, err)
+	}
+	truncate()
+	tb.Cleanup(func() {
+		truncate()
+		pool.Close()
+	})
+
+	return pool
+}
+
+func TestRepository_Contract(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, func(t *testing.T) userUsecase.Repository {
+		return NewRepository(newPool(t))
+	})
+}
+
+func TestRepository_Tx(t *testing.T) {
+	repotest.RunTxTests(t, func(t *testing.T) (userUsecase.Repository, userUsecase.TxManager) {
+		pool := newPool(t)
+		return NewRepository(pool), pgxRepo.NewTxManager(pool, "serializable", 3)
+	})
+}
+
+func TestAuditRepository_Contract(t *testing.T) {
+	repotest.RunAuditRepositoryTests(t, func(t *testing.T) userUsecase.AuditRepository {
+		return audit.NewRepository(newPool(t))
+	})
+}
+
+func TestVersionRepository_Contract(t *testing.T) {
+	repotest.RunVersionRepositoryTests(t, func(t *testing.T) userUsecase.VersionRepository {
+		return version.NewRepository(newPool(t))
+	})
+}
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"errors"
+	"github.com/jackc/pgconn"
+	"playground/rest-api/gomasters/entity"
+)
+
+const uniqueViolation = "23505"
+
+// uniqueFields maps the unique constraints of the users table to the user fields they guard.
+var uniqueFields = map[string]string{
+	"users_pkey":            "ID",
+	"users_email_key":       "Email",
+	"users_email_lower_key": "Email",
+}
+
+// Conflict returns an entity.ConflictError when err is a unique violation on
+// the users table, otherwise nil.
+func Conflict(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return nil
+	}
+
+	field, ok := uniqueFields[pgErr.ConstraintName]
+	if !ok {
+		return nil
+	}
+	return entity.Conflict(field)
+}
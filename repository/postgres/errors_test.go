@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"playground/rest-api/gomasters/entity"
+	"testing"
+)
+
+func TestConflict(t *testing.T) {
+	type expected struct {
+		Conflict error
+	}
+
+	type payload struct {
+		Err error
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "duplicate email",
+			expected: expected{Conflict: entity.Conflict("Email")},
+			payload:  payload{Err: &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}},
+		},
+		{
+			name:     "email differing only in case",
+			expected: expected{Conflict: entity.Conflict("Email")},
+			payload:  payload{Err: &pgconn.PgError{Code: "23505", ConstraintName: "users_email_lower_key"}},
+		},
+		{
+			name:     "duplicate id in a wrapped error",
+			expected: expected{Conflict: entity.Conflict("ID")},
+			payload:  payload{Err: fmt.Errorf("commit tx error: %w", &pgconn.PgError{Code: "23505", ConstraintName: "users_pkey"})},
+		},
+		{
+			name:     "unique violation of another table",
+			expected: expected{Conflict: nil},
+			payload:  payload{Err: &pgconn.PgError{Code: "23505", ConstraintName: "outbox_pkey"}},
+		},
+		{
+			name:     "serialization failure",
+			expected: expected{Conflict: nil},
+			payload:  payload{Err: &pgconn.PgError{Code: "40001"}},
+		},
+		{
+			name:     "other error",
+			expected: expected{Conflict: nil},
+			payload:  payload{Err: errors.New("connection reset")},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			assert.EqualValues(t, test.expected.Conflict, Conflict(test.payload.Err))
+		})
+	}
+}
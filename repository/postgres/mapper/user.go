@@ -0,0 +1,106 @@
+// Package mapper maps rows of the postgres users table to entity.User and
+// back. Both postgres repositories build their queries from it, so a schema
+// change only has to be reflected here.
+package mapper
+
+import (
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"strings"
+)
+
+// Scanner is implemented by *sql.Row, *sql.Rows, pgx.Row and pgx.Rows.
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// userColumns must stay in the same order as userFields and UserValues.
+var userColumns = []string{"id", "first_name", "last_name", "email", "age", "created", "updated_at"}
+
+func userFields(u *entity.User) []interface{} {
+	return []interface{}{&u.ID, &u.Firstname, &u.Lastname, &u.Email, &u.Age, &u.Created, &u.Updated}
+}
+
+// UserValues returns the values of u in column order, ready to be bound.
+func UserValues(u *entity.User) []interface{} {
+	return []interface{}{u.ID, u.Firstname, u.Lastname, u.Email, u.Age, u.Created, u.Updated}
+}
+
+// UserColumnNames lists the mapped columns in scan order.
+func UserColumnNames() []string {
+	return append([]string(nil), userColumns...)
+}
+
+// UserColumns returns the comma separated column list for SELECT and INSERT.
+func UserColumns() string {
+	return strings.Join(userColumns, ", ")
+}
+
+// SelectUsers selects the mapped columns of users; callers append WHERE and ORDER BY.
+func SelectUsers() string {
+	return "SELECT " + UserColumns() + " FROM users"
+}
+
+// ScanUser reads one row selected with UserColumns into u. Columns selected
+// after them are read into extra.
+func ScanUser(s Scanner, u *entity.User, extra ...interface{}) error {
+	if err := s.Scan(append(userFields(u), extra...)...); err != nil {
+		return err
+	}
+	u.Updated = u.Updated.UTC()
+	return nil
+}
+
+// Placeholders returns "($n, $n+1, ...)" for one row of UserValues whose
+// first parameter is $n.
+func Placeholders(n int) string {
+	params := make([]string, len(userColumns))
+	for i := range userColumns {
+		params[i] = fmt.Sprintf("$%d", n+i)
+	}
+	return "(" + strings.Join(params, ", ") + ")"
+}
+
+// SetUsers returns "id=$1, first_name=$2, ..." for an UPDATE bound with UserValues.
+func SetUsers() string {
+	set := make([]string, len(userColumns))
+	for i, c := range userColumns {
+		set[i] = fmt.Sprintf("%s=$%d", c, i+1)
+	}
+	return strings.Join(set, ", ")
+}
+
+// ColumnCount is the number of parameters UserValues binds per user.
+func ColumnCount() int {
+	return len(userColumns)
+}
+
+// InsertUsers is a multi-row INSERT for n users bound with UserValues of each.
+func InsertUsers(n int) string {
+	values := make([]string, n)
+	for i := range values {
+		values[i] = Placeholders(i*len(userColumns) + 1)
+	}
+	return "INSERT INTO users(" + UserColumns() + ") VALUES " + strings.Join(values, ", ")
+}
+
+// UpdateUser updates a user bound with UserValues followed by the current id.
+func UpdateUser() string {
+	return fmt.Sprintf("UPDATE users SET %s WHERE id=$%d", SetUsers(), len(userColumns)+1)
+}
+
+// Params returns "$first, $first+1, ..." for n parameters, such as the
+// values of an IN list.
+func Params(first, n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", first+i)
+	}
+	return strings.Join(params, ", ")
+}
+
+// UserParams returns "$n, $n+1, ..." for the UserValues of one user without
+// the parentheses of Placeholders, for use in a SELECT list.
+func UserParams(n int) string {
+	return strings.Trim(Placeholders(n), "()")
+}
@@ -0,0 +1,123 @@
+package mapper
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"playground/rest-api/gomasters/entity"
+	"testing"
+	"time"
+)
+
+type fakeRow []interface{}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if len(dest) != len(r) {
+		return errors.New("column count mismatch")
+	}
+	for i, d := range dest {
+		switch p := d.(type) {
+		case *string:
+			*p = r[i].(string)
+		case *int:
+			*p = r[i].(int)
+		case *time.Time:
+			*p = r[i].(time.Time)
+		}
+	}
+	return nil
+}
+
+func TestScanUser(t *testing.T) {
+	created := time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC)
+	user := &entity.User{
+		ID:        "6fa1a6ea-5a3a-4a3a-9a3a-0a3a3a3a3a3a",
+		Firstname: "John",
+		Lastname:  "Smith",
+		Email:     "john@mail.com",
+		Age:       33,
+		Created:   created,
+		Updated:   created.Add(time.Hour),
+	}
+
+	type expected struct {
+		User *entity.User
+		Err  error
+	}
+
+	type payload struct {
+		Row fakeRow
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "all columns",
+			expected: expected{User: user, Err: nil},
+			payload:  payload{Row: UserValues(user)},
+		},
+		{
+			name:     "missing column",
+			expected: expected{User: &entity.User{}, Err: errors.New("column count mismatch")},
+			payload:  payload{Row: UserValues(user)[1:]},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			var u entity.User
+			err := ScanUser(test.payload.Row, &u)
+
+			assert.EqualValues(t, test.expected.Err, err)
+			assert.EqualValues(t, test.expected.User, &u)
+		})
+	}
+
+	assert.Len(t, UserColumnNames(), len(UserValues(user)))
+}
+
+func TestQueries(t *testing.T) {
+	type expected struct {
+		Query string
+	}
+
+	type payload struct {
+		Query func() string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "select",
+			expected: expected{Query: "SELECT id, first_name, last_name, email, age, created, updated_at FROM users"},
+			payload:  payload{Query: SelectUsers},
+		},
+		{
+			name: "insert two users",
+			expected: expected{Query: "INSERT INTO users(id, first_name, last_name, email, age, created, updated_at) " +
+				"VALUES ($1, $2, $3, $4, $5, $6, $7), ($8, $9, $10, $11, $12, $13, $14)"},
+			payload: payload{Query: func() string { return InsertUsers(2) }},
+		},
+		{
+			name:     "update",
+			expected: expected{Query: "UPDATE users SET id=$1, first_name=$2, last_name=$3, email=$4, age=$5, created=$6, updated_at=$7 WHERE id=$8"},
+			payload:  payload{Query: UpdateUser},
+		},
+		{
+			name:     "in list",
+			expected: expected{Query: "$2, $3, $4"},
+			payload:  payload{Query: func() string { return Params(2, 3) }},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			assert.EqualValues(t, test.expected.Query, test.payload.Query())
+		})
+	}
+}
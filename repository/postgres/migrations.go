@@ -0,0 +1,18 @@
+package postgres
+
+import (
+	"embed"
+	"playground/rest-api/gomasters/repository/migrate"
+)
+
+// The tables are created IF NOT EXISTS, so that databases set up before the
+// migrations take them over.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrations returns the embedded migrations of the postgres schema, used by
+// the postgres and pgx drivers.
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Load(migrations, "migrations")
+}
@@ -1,2 +1 @@
 DROP TABLE users;
-DROP TABLE admins;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    id         uuid PRIMARY KEY,
+    first_name varchar(40) NOT NULL,
+    last_name  varchar(40) NOT NULL,
+    email      varchar(40) NOT NULL UNIQUE,
+    age        int         NOT NULL,
+    created    date        NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id         uuid PRIMARY KEY,
+    event_type varchar(40) NOT NULL,
+    entity_id  uuid        NOT NULL,
+    payload    jsonb       NOT NULL,
+    created    timestamptz NOT NULL,
+    sent       timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unsent_idx ON outbox (created) WHERE sent IS NULL;
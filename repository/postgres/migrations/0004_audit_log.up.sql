@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    seq        bigserial PRIMARY KEY,
+    id         uuid        NOT NULL UNIQUE,
+    entity_id  uuid        NOT NULL,
+    action     varchar(10) NOT NULL,
+    actor      text        NOT NULL,
+    request_id text        NOT NULL,
+    changes    jsonb       NOT NULL,
+    created    timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_id, seq);
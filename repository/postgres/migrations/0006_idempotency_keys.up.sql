@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    key          text        NOT NULL,
+    caller       text        NOT NULL,
+    body_hash    text        NOT NULL,
+    status       int,
+    content_type text,
+    body         bytea,
+    created      timestamptz NOT NULL,
+    expires      timestamptz NOT NULL,
+    PRIMARY KEY (key, caller)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys (expires);
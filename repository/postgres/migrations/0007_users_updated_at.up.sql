@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
+ALTER TABLE users_history ADD COLUMN IF NOT EXISTS updated_at timestamptz NOT NULL DEFAULT now();
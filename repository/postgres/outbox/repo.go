@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"database/sql"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"strings"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Save writes the events inside the caller's transaction, so they are stored
+// only if the business write they describe is committed as well.
+func Save(tx *sql.Tx, events ...*entity.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*5)
+	for i, e := range events {
+		n := i * 5
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, e.ID, e.Type, e.EntityID, e.Payload, e.Created)
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO outbox(id, event_type, entity_id, payload, created) VALUES "+strings.Join(values, ", ")+";",
+		args...); err != nil {
+		return fmt.Errorf("save outbox event error: %v", err)
+	}
+
+	return nil
+}
+
+// Process locks up to limit unsent events with SKIP LOCKED, so several relays
+// can work in parallel, and marks as sent every event publish accepted.
+// Processing stops at the first publish error to keep events in order.
+func (or *Repository) Process(limit int, publish func(*entity.Event) error) (int, error) {
+	tx, err := or.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("process outbox begin error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		"SELECT id, event_type, entity_id, payload, created FROM outbox WHERE sent IS NULL ORDER BY created LIMIT $1 FOR UPDATE SKIP LOCKED;",
+		limit)
+	if err != nil {
+		return 0, fmt.Errorf("process outbox query error: %v", err)
+	}
+
+	var events []*entity.Event
+	for rows.Next() {
+		var e entity.Event
+		if err = rows.Scan(&e.ID, &e.Type, &e.EntityID, &e.Payload, &e.Created); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("process outbox rows scan error: %v", err)
+		}
+
+		events = append(events, &e)
+	}
+	if err = rows.Close(); err != nil {
+		return 0, fmt.Errorf("process outbox rows close error: %v", err)
+	}
+
+	sent := 0
+	var publishErr error
+	for _, e := range events {
+		if publishErr = publish(e); publishErr != nil {
+			break
+		}
+
+		if _, err = tx.Exec("UPDATE outbox SET sent=now() WHERE id=$1;", e.ID); err != nil {
+			return 0, fmt.Errorf("process outbox mark sent error: %v", err)
+		}
+		sent++
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("process outbox commit error: %v", err)
+	}
+
+	if publishErr != nil {
+		return sent, fmt.Errorf("publish event error: %v", publishErr)
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,46 @@
+// Package pgtest sets up the gomasters-db-test database for the tests of the
+// postgres and pgx repositories. Every test package gets a schema of its
+// own: go test ./... runs packages in parallel, and packages sharing tables
+// would truncate each other's rows.
+package pgtest
+
+import (
+	"database/sql"
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/repository/migrate"
+	"playground/rest-api/gomasters/repository/postgres"
+	"testing"
+)
+
+const dbString = "user=postgres password=postgres host=localhost port=5432 database=gomasters-db-test sslmode=disable"
+
+// Tables lists the tables the tests empty around every test.
+const Tables = "users, outbox, audit_log, users_history, idempotency_keys"
+
+// DbString creates schema in the test database, applies the migrations in
+// it and returns a connection string whose search_path is schema. schema
+// must be a plain identifier, it is not quoted.
+func DbString(tb testing.TB, schema string) string {
+	db, err := sql.Open("pgx", dbString)
+	require.Nil(tb, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer db.Close()
+	require.Nil(tb, db.Ping(), "the tests need the gomasters-db-test database")
+
+	_, err = db.Exec("CREATE SCHEMA IF NOT EXISTS " + schema + ";")
+	require.Nil(tb, err)
+
+	dsn := dbString + " search_path=" + schema
+	schemaDb, err := sql.Open("pgx", dsn)
+	require.Nil(tb, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer schemaDb.Close()
+
+	ms, err := postgres.Migrations()
+	require.Nil(tb, err)
+	_, err = migrate.Up(schemaDb, ms)
+	require.Nil(tb, err)
+
+	return dsn
+}
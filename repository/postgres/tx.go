@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgconn"
+	"playground/rest-api/gomasters/repository/sqltx"
+	"strings"
+)
+
+// SQLSTATE codes of transactions aborted only because of concurrent ones.
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+// NewTxManager returns a transaction manager for the postgres repositories
+// that runs transactions again after serialization failures and deadlocks.
+func NewTxManager(db *sql.DB, isolation sql.IsolationLevel, maxRetries int) *sqltx.Manager {
+	return sqltx.NewManager(db, sqltx.Options{
+		Isolation:  isolation,
+		MaxRetries: maxRetries,
+		Retryable:  IsRetryable,
+	})
+}
+
+// IsRetryable reports whether err comes from a serialization failure or a
+// deadlock. Repository errors keep only the message of the driver error, so
+// the SQLSTATE in the message is checked as well.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "(SQLSTATE "+serializationFailure+")") ||
+		strings.Contains(msg, "(SQLSTATE "+deadlockDetected+")")
+}
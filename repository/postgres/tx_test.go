@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	type expected struct {
+		Retryable bool
+	}
+
+	type payload struct {
+		Err error
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "serialization failure",
+			expected: expected{Retryable: true},
+			payload:  payload{Err: &pgconn.PgError{Code: "40001"}},
+		},
+		{
+			name:     "deadlock",
+			expected: expected{Retryable: true},
+			payload:  payload{Err: fmt.Errorf("commit tx error: %w", &pgconn.PgError{Code: "40P01"})},
+		},
+		{
+			name:     "unique violation",
+			expected: expected{Retryable: false},
+			payload:  payload{Err: &pgconn.PgError{Code: "23505"}},
+		},
+		{
+			name:     "message of a wrapped serialization failure",
+			expected: expected{Retryable: true},
+			payload: payload{Err: fmt.Errorf("update error: %v", &pgconn.PgError{
+				Severity: "ERROR", Code: "40001", Message: "could not serialize access due to concurrent update",
+			})},
+		},
+		{
+			name:     "other error",
+			expected: expected{Retryable: false},
+			payload:  payload{Err: errors.New("connection reset")},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			assert.EqualValues(t, test.expected.Retryable, IsRetryable(test.payload.Err))
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/sqltx"
+)
+
+// batchInsertChunk keeps multi-row INSERTs below the Postgres limit of 65535 bind parameters.
+const batchInsertChunk = 1000
+
+// Batch runs all operations in the transaction carried by ctx or in its own.
+// Consecutive creates are written with multi-row INSERTs. In atomic mode the
+// first failure rolls back the whole batch; otherwise every failed operation
+// is rolled back to its savepoint and reported in its result while the rest
+// is committed.
+func (ur *Repository) Batch(ctx context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error) {
+	results := entity.NewBatchResults(ops)
+
+	var batchErr error
+	err := sqltx.Run(ctx, ur.db, func(tx *sql.Tx) error {
+		for start := 0; start < len(ops); {
+			end := start + 1
+			if ops[start].Op == entity.BatchCreate {
+				for end < len(ops) && ops[end].Op == entity.BatchCreate && end-start < batchInsertChunk {
+					end++
+				}
+			}
+
+			if atomic {
+				if err := runOperations(tx, ops[start:end]); err != nil {
+					for _, r := range results {
+						r.Error = "rolled back"
+					}
+					for _, r := range results[start:end] {
+						r.Error = err.Error()
+					}
+					batchErr = fmt.Errorf("batch error: %v", err)
+					return batchErr
+				}
+			} else if err := runOperationsEach(tx, ops[start:end], results[start:end]); err != nil {
+				return err
+			}
+
+			start = end
+		}
+		return nil
+	})
+	if batchErr != nil {
+		return results, batchErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("batch error: %v", err)
+	}
+
+	return results, nil
+}
+
+// runOperationsEach tries the whole run under one savepoint and only falls
+// back to a savepoint per operation when the run fails, to find the culprits.
+func runOperationsEach(tx *sql.Tx, ops []*entity.BatchOperation, results []*entity.BatchResult) error {
+	err := withSavepoint(tx, func() error {
+		return runOperations(tx, ops)
+	})
+	if err == nil || len(ops) == 1 {
+		if err != nil {
+			results[0].Error = err.Error()
+		}
+		return nil
+	}
+
+	for i, op := range ops {
+		err = withSavepoint(tx, func() error {
+			return runOperations(tx, []*entity.BatchOperation{op})
+		})
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	return nil
+}
+
+func withSavepoint(tx *sql.Tx, fn func() error) error {
+	if _, err := tx.Exec("SAVEPOINT batch_item;"); err != nil {
+		return fmt.Errorf("savepoint error: %v", err)
+	}
+
+	if err := fn(); err != nil {
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT batch_item;"); rbErr != nil {
+			return fmt.Errorf("rollback to savepoint error: %v", rbErr)
+		}
+		return err
+	}
+
+	if _, err := tx.Exec("RELEASE SAVEPOINT batch_item;"); err != nil {
+		return fmt.Errorf("release savepoint error: %v", err)
+	}
+	return nil
+}
+
+// runOperations executes a run of operations produced by Batch: either
+// consecutive creates or a single update or delete.
+func runOperations(tx *sql.Tx, ops []*entity.BatchOperation) error {
+	switch ops[0].Op {
+	case entity.BatchCreate:
+		users := make([]*entity.User, len(ops))
+		for i, op := range ops {
+			users[i] = op.User
+		}
+
+		if err := insertUsers(tx, users...); err != nil {
+			return err
+		}
+		return saveEvents(tx, entity.EventUserCreated, users...)
+	case entity.BatchUpdate:
+		if _, err := updateUser(tx, ops[0].ID, ops[0].User); err != nil {
+			return err
+		}
+		return saveEvents(tx, entity.EventUserUpdated, ops[0].User)
+	case entity.BatchDelete:
+		if err := deleteUser(tx, ops[0].ID); err != nil {
+			return err
+		}
+		return saveEvents(tx, entity.EventUserDeleted, &entity.User{ID: ops[0].ID})
+	default:
+		return fmt.Errorf("unknown batch operation: %s", ops[0].Op)
+	}
+}
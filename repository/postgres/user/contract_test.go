@@ -0,0 +1,69 @@
+package user
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/repository/postgres"
+	"playground/rest-api/gomasters/repository/postgres/audit"
+	"playground/rest-api/gomasters/repository/postgres/idempotency"
+	"playground/rest-api/gomasters/repository/postgres/pgtest"
+	"playground/rest-api/gomasters/repository/postgres/version"
+	"playground/rest-api/gomasters/repository/repotest"
+	idempotencyUsecase "playground/rest-api/gomasters/usecase/idempotency"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"testing"
+)
+
+// schema holds the tables of this package in the test database.
+const schema = "postgres_user_test"
+
+// openDb connects to the schema of the package in the test database and
+// empties its tables before and after the test, every test starts from an
+// empty database.
+func openDb(t *testing.T) *sql.DB {
+	db, err := sql.Open("pgx", pgtest.DbString(t, schema))
+	require.Nil(t, err)
+
+	truncate := func() {
+		_, err := db.Exec("TRUNCATE " + pgtest.Tables + ";")
+		require.Nil(t, err)
+	}
+	truncate()
+	t.Cleanup(func() {
+		truncate()
+		_ = db.Close()
+	})
+
+	return db
+}
+
+func TestRepository_Contract(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, func(t *testing.T) userUsecase.Repository {
+		return NewRepository(openDb(t))
+	})
+}
+
+func TestRepository_Tx(t *testing.T) {
+	repotest.RunTxTests(t, func(t *testing.T) (userUsecase.Repository, userUsecase.TxManager) {
+		db := openDb(t)
+		return NewRepository(db), postgres.NewTxManager(db, sql.LevelSerializable, 3)
+	})
+}
+
+func TestAuditRepository_Contract(t *testing.T) {
+	repotest.RunAuditRepositoryTests(t, func(t *testing.T) userUsecase.AuditRepository {
+		return audit.NewRepository(openDb(t))
+	})
+}
+
+func TestVersionRepository_Contract(t *testing.T) {
+	repotest.RunVersionRepositoryTests(t, func(t *testing.T) userUsecase.VersionRepository {
+		return version.NewRepository(openDb(t))
+	})
+}
+
+func TestIdempotencyRepository_Contract(t *testing.T) {
+	repotest.RunIdempotencyRepositoryTests(t, func(t *testing.T) idempotencyUsecase.Repository {
+		return idempotency.NewRepository(openDb(t))
+	})
+}
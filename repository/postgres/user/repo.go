@@ -1,10 +1,15 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/postgres"
+	"playground/rest-api/gomasters/repository/postgres/mapper"
+	"playground/rest-api/gomasters/repository/postgres/outbox"
+	"playground/rest-api/gomasters/repository/sqltx"
 )
 
 type Repository struct {
@@ -17,8 +22,8 @@ func NewRepository(db *sql.DB) *Repository {
 	}
 }
 
-func (ur *Repository) GetAll() ([]*entity.User, error) {
-	rows, err := ur.db.Query("SELECT * FROM users;")
+func (ur *Repository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	rows, err := sqltx.Conn(ctx, ur.db).QueryContext(ctx, mapper.SelectUsers()+" ORDER BY created, id;")
 	if err != nil {
 		return nil, fmt.Errorf("get all users query error: %v", err)
 	}
@@ -28,7 +33,7 @@ func (ur *Repository) GetAll() ([]*entity.User, error) {
 	var users []*entity.User
 	for rows.Next() {
 		var u entity.User
-		if err = rows.Scan(&u.ID, &u.Firstname, &u.Lastname, &u.Email, &u.Age, &u.Created); err != nil {
+		if err = mapper.ScanUser(rows, &u); err != nil {
 			return nil, fmt.Errorf("get all users rows scan error: %v", err)
 		}
 
@@ -38,62 +43,203 @@ func (ur *Repository) GetAll() ([]*entity.User, error) {
 	return users, nil
 }
 
-func (ur *Repository) Create(u *entity.User) (string, error) {
-	row := ur.db.QueryRow(
-		"INSERT INTO users(id, first_name, last_name, email, age, created) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;",
-		u.ID, u.Firstname, u.Lastname, u.Email, u.Age, u.Created)
-	if row.Err() != nil {
-		return "", fmt.Errorf("create error: %v", row.Err())
+// StreamAll reads users from the cursor and hands them to fn one at a time
+// instead of collecting them like GetAll does.
+func (ur *Repository) StreamAll(ctx context.Context, fn func(*entity.User) error) error {
+	rows, err := sqltx.Conn(ctx, ur.db).QueryContext(ctx, mapper.SelectUsers()+" ORDER BY created, id;")
+	if err != nil {
+		return fmt.Errorf("stream users query error: %v", err)
 	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	var u entity.User
+	for rows.Next() {
+		if err = mapper.ScanUser(rows, &u); err != nil {
+			return fmt.Errorf("stream users rows scan error: %v", err)
+		}
 
-	var userId string
-	if err := row.Scan(&userId); err != nil {
-		return "", fmt.Errorf("scan id of created user error: %v", err)
+		if err = fn(&u); err != nil {
+			return err
+		}
 	}
 
-	return userId, nil
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("stream users rows error: %v", err)
+	}
+	return nil
 }
 
-func (ur *Repository) GetById(id string) (*entity.User, error) {
+// Create, Update and Delete write the user together with its outbox event,
+// in the transaction carried by ctx or in their own.
+func (ur *Repository) Create(ctx context.Context, u *entity.User) (string, error) {
+	err := sqltx.Run(ctx, ur.db, func(tx *sql.Tx) error {
+		if err := insertUsers(tx, u); err != nil {
+			return err
+		}
+		return saveEvents(tx, entity.EventUserCreated, u)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return u.ID, nil
+}
+
+func (ur *Repository) GetById(ctx context.Context, id string) (*entity.User, error) {
 	var u entity.User
-	row := ur.db.QueryRow("SELECT * FROM users WHERE id=$1;", id)
+	row := sqltx.Conn(ctx, ur.db).QueryRowContext(ctx, mapper.SelectUsers()+" WHERE id=$1;", id)
 	if row.Err() != nil {
 		return nil, fmt.Errorf("get user by id error: %v", row.Err())
 	}
 
-	if err := row.Scan(&u.ID, &u.Firstname, &u.Lastname, &u.Email, &u.Age, &u.Created); err != nil {
+	if err := mapper.ScanUser(row, &u); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user by id error: %w", entity.ErrNotFound)
+		}
 		return nil, fmt.Errorf("get user by id row scan error: %v", err)
 	}
 
 	return &u, nil
 }
 
-func (ur *Repository) Update(userId string, u *entity.User) (string, error) {
-	row := ur.db.QueryRow(
-		"UPDATE users SET id=$1, first_name=$2, last_name=$3, email=$4, age=$5, created=$6 WHERE id=$7 RETURNING id;",
-		u.ID, u.Firstname, u.Lastname, u.Email, u.Age, u.Created, userId)
+// GetByIds reads all users in one query.
+func (ur *Repository) GetByIds(ctx context.Context, ids []string) ([]*entity.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := sqltx.Conn(ctx, ur.db).QueryContext(ctx, mapper.SelectUsers()+" WHERE id IN ("+mapper.Params(1, len(ids))+");", args...)
+	if err != nil {
+		return nil, fmt.Errorf("get users by ids query error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	var users []*entity.User
+	for rows.Next() {
+		var u entity.User
+		if err = mapper.ScanUser(rows, &u); err != nil {
+			return nil, fmt.Errorf("get users by ids rows scan error: %v", err)
+		}
+
+		users = append(users, &u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get users by ids rows error: %v", err)
+	}
+	return users, nil
+}
+
+func (ur *Repository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+	var u entity.User
+	row := sqltx.Conn(ctx, ur.db).QueryRowContext(ctx, mapper.SelectUsers()+" WHERE email=$1;", email)
 	if row.Err() != nil {
-		return "", fmt.Errorf("update error: %v", row.Err())
+		return nil, fmt.Errorf("get user by email error: %v", row.Err())
 	}
 
+	if err := mapper.ScanUser(row, &u); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user by email error: %w", entity.ErrNotFound)
+		}
+		return nil, fmt.Errorf("get user by email row scan error: %v", err)
+	}
+
+	return &u, nil
+}
+
+func (ur *Repository) Update(ctx context.Context, userId string, u *entity.User) (string, error) {
+	var id string
+	err := sqltx.Run(ctx, ur.db, func(tx *sql.Tx) error {
+		var err error
+		if id, err = updateUser(tx, userId, u); err != nil {
+			return err
+		}
+		return saveEvents(tx, entity.EventUserUpdated, u)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (ur *Repository) Delete(ctx context.Context, userId string) (string, error) {
+	err := sqltx.Run(ctx, ur.db, func(tx *sql.Tx) error {
+		if err := deleteUser(tx, userId); err != nil {
+			return err
+		}
+		return saveEvents(tx, entity.EventUserDeleted, &entity.User{ID: userId})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return userId, nil
+}
+
+// insertUsers writes all users with a single multi-row INSERT.
+func insertUsers(tx *sql.Tx, users ...*entity.User) error {
+	args := make([]interface{}, 0, len(users)*mapper.ColumnCount())
+	for _, u := range users {
+		args = append(args, mapper.UserValues(u)...)
+	}
+
+	if _, err := tx.Exec(mapper.InsertUsers(len(users))+";", args...); err != nil {
+		if conflict := postgres.Conflict(err); conflict != nil {
+			return fmt.Errorf("create error: %w", conflict)
+		}
+		return fmt.Errorf("create error: %v", err)
+	}
+
+	return nil
+}
+
+func updateUser(tx *sql.Tx, userId string, u *entity.User) (string, error) {
+	row := tx.QueryRow(mapper.UpdateUser()+" RETURNING id;", append(mapper.UserValues(u), userId)...)
 	var id string
 	if err := row.Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("update error: %w", entity.ErrNotFound)
+		}
+		if conflict := postgres.Conflict(err); conflict != nil {
+			return "", fmt.Errorf("update error: %w", conflict)
+		}
 		return "", fmt.Errorf("update ok but row scan for id error: %v", err)
 	}
 
 	return id, nil
 }
 
-func (ur *Repository) Delete(userId string) (string, error) {
-	res, err := ur.db.Exec("DELETE FROM users WHERE id=$1;", userId)
+func deleteUser(tx *sql.Tx, userId string) error {
+	res, err := tx.Exec("DELETE FROM users WHERE id=$1;", userId)
 	if err != nil {
-		return "", fmt.Errorf("delete error: %v", err)
+		return fmt.Errorf("delete error: %v", err)
 	}
 
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected != 1 {
-		return "", errors.New("no row found to delete")
+		return entity.NotFound("no row found to delete")
 	}
 
-	return userId, nil
+	return nil
+}
+
+// saveEvents stores one outbox event per user.
+func saveEvents(tx *sql.Tx, eventType string, users ...*entity.User) error {
+	events := make([]*entity.Event, 0, len(users))
+	for _, u := range users {
+		e, err := entity.NewUserEvent(eventType, u)
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+	}
+
+	return outbox.Save(tx, events...)
 }
@@ -0,0 +1,121 @@
+package version
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/postgres/mapper"
+	"playground/rest-api/gomasters/repository/sqltx"
+	"time"
+)
+
+// Repository keeps the versions of the users in the users_history table.
+// Each row is valid from valid_from until valid_to, the current version of a
+// user has no valid_to.
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+var (
+	insertVersion = fmt.Sprintf(
+		"INSERT INTO users_history(%s, version, valid_from) SELECT %s, COALESCE(MAX(version), 0) + 1, $%d FROM users_history WHERE id=$1;",
+		mapper.UserColumns(), mapper.UserParams(1), mapper.ColumnCount()+1)
+	selectVersions = "SELECT " + mapper.UserColumns() + ", version, valid_from, valid_to FROM users_history"
+)
+
+func (vr *Repository) Save(ctx context.Context, u *entity.User, at time.Time) error {
+	return sqltx.Run(ctx, vr.db, func(tx *sql.Tx) error {
+		if err := closeVersion(ctx, tx, u.ID, at); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, insertVersion, append(mapper.UserValues(u), at)...); err != nil {
+			return fmt.Errorf("save user version error: %v", err)
+		}
+		return nil
+	})
+}
+
+func (vr *Repository) Close(ctx context.Context, userId string, at time.Time) error {
+	return closeVersion(ctx, sqltx.Conn(ctx, vr.db), userId, at)
+}
+
+func (vr *Repository) AsOf(ctx context.Context, userId string, at time.Time) (*entity.User, error) {
+	v, err := scanVersion(sqltx.Conn(ctx, vr.db).QueryRowContext(ctx,
+		selectVersions+" WHERE id=$1 AND valid_from <= $2 AND (valid_to IS NULL OR valid_to > $2);", userId, at))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user as of %v error: %w", at, entity.ErrNotFound)
+		}
+		return nil, fmt.Errorf("get user as of row scan error: %v", err)
+	}
+
+	return v.User, nil
+}
+
+func (vr *Repository) Version(ctx context.Context, userId string, version int) (*entity.UserVersion, error) {
+	v, err := scanVersion(sqltx.Conn(ctx, vr.db).QueryRowContext(ctx,
+		selectVersions+" WHERE id=$1 AND version=$2;", userId, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user version %d error: %w", version, entity.ErrNotFound)
+		}
+		return nil, fmt.Errorf("get user version row scan error: %v", err)
+	}
+
+	return v, nil
+}
+
+func (vr *Repository) Versions(ctx context.Context, userId string) ([]*entity.UserVersion, error) {
+	rows, err := sqltx.Conn(ctx, vr.db).QueryContext(ctx, selectVersions+" WHERE id=$1 ORDER BY version;", userId)
+	if err != nil {
+		return nil, fmt.Errorf("get user versions query error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	var versions []*entity.UserVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get user versions rows scan error: %v", err)
+		}
+		versions = append(versions, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get user versions rows error: %v", err)
+	}
+	return versions, nil
+}
+
+func closeVersion(ctx context.Context, q sqltx.Querier, userId string, at time.Time) error {
+	if _, err := q.ExecContext(ctx,
+		"UPDATE users_history SET valid_to=$2 WHERE id=$1 AND valid_to IS NULL;", userId, at); err != nil {
+		return fmt.Errorf("close user version error: %v", err)
+	}
+	return nil
+}
+
+func scanVersion(s mapper.Scanner) (*entity.UserVersion, error) {
+	v := &entity.UserVersion{User: &entity.User{}}
+	var validTo sql.NullTime
+	if err := mapper.ScanUser(s, v.User, &v.Version, &v.ValidFrom, &validTo); err != nil {
+		return nil, err
+	}
+
+	v.ValidFrom = v.ValidFrom.UTC()
+	if validTo.Valid {
+		t := validTo.Time.UTC()
+		v.ValidTo = &t
+	}
+	return v, nil
+}
@@ -0,0 +1,52 @@
+package repotest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/entity"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"testing"
+	"time"
+)
+
+// AuditFixture returns an empty audit repository owned by one test.
+type AuditFixture func(t *testing.T) userUsecase.AuditRepository
+
+func newAuditRecord(t *testing.T, action string, before, after *entity.User, created time.Time) *entity.AuditRecord {
+	r, err := entity.NewAuditRecord(action, "tester", "req-1", before, after)
+	require.Nil(t, err)
+	r.Created = created
+	return r
+}
+
+// RunAuditRepositoryTests checks that records are kept per user in the order
+// they were saved and read back unchanged.
+func RunAuditRepositoryTests(t *testing.T, newRepo AuditFixture) {
+	repo := newRepo(t)
+
+	history, err := repo.History(ctx, "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c")
+	require.Nil(t, err)
+	assert.Empty(t, history)
+
+	user := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	updated := newUser(user.ID, "user1upd@gmail.com", day)
+	other := newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", "user2@gmail.com", day)
+
+	// The same timestamp for all records, the order of saving decides.
+	created := day.Add(time.Hour)
+	expected := []*entity.AuditRecord{
+		newAuditRecord(t, entity.AuditCreate, nil, user, created),
+		newAuditRecord(t, entity.AuditUpdate, user, updated, created),
+		newAuditRecord(t, entity.AuditDelete, updated, nil, created),
+	}
+	for i, r := range expected {
+		require.Nil(t, repo.Save(ctx, r))
+		if i == 0 {
+			require.Nil(t, repo.Save(ctx, newAuditRecord(t, entity.AuditCreate, nil, other, created)))
+		}
+	}
+
+	history, err = repo.History(ctx, user.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, expected, history)
+}
@@ -0,0 +1,85 @@
+package repotest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/usecase/idempotency"
+	"testing"
+	"time"
+)
+
+// IdempotencyFixture returns an empty idempotency repository owned by one test.
+type IdempotencyFixture func(t *testing.T) idempotency.Repository
+
+func newIdempotentRequest(key, caller, bodyHash string, created time.Time) *entity.IdempotentRequest {
+	return &entity.IdempotentRequest{
+		Key: key, Caller: caller, BodyHash: bodyHash, Created: created, Expires: created.Add(time.Hour),
+	}
+}
+
+// RunIdempotencyRepositoryTests checks that a key is reserved once per
+// caller until it expires, that the stored response is returned to later
+// reservations until the expiry set by Complete, that Complete stores only
+// the response of a reservation with the same body hash still in its lease
+// and that only requests without a response are released.
+func RunIdempotencyRepositoryTests(t *testing.T, newRepo IdempotencyFixture) {
+	repo := newRepo(t)
+	created := day.Add(time.Hour)
+
+	first := newIdempotentRequest("key-1", "alice", "hash-1", created)
+	existing, err := repo.Reserve(ctx, first)
+	require.Nil(t, err)
+	assert.Nil(t, existing, "new key")
+
+	existing, err = repo.Reserve(ctx, newIdempotentRequest("key-1", "alice", "hash-2", created.Add(time.Minute)))
+	require.Nil(t, err)
+	if assert.NotNil(t, existing, "reserved key") {
+		assert.EqualValues(t, "hash-1", existing.BodyHash)
+		assert.False(t, existing.Done(), "in progress")
+	}
+
+	existing, err = repo.Reserve(ctx, newIdempotentRequest("key-1", "bob", "hash-1", created))
+	require.Nil(t, err)
+	assert.Nil(t, existing, "the same key of another caller")
+
+	require.Nil(t, repo.Release(ctx, "key-1", "bob"))
+	existing, err = repo.Reserve(ctx, newIdempotentRequest("key-1", "bob", "hash-3", created))
+	require.Nil(t, err)
+	assert.Nil(t, existing, "released key")
+
+	lapsed := newIdempotentRequest("key-1", "bob", "hash-3", created)
+	lapsed.Status, lapsed.Expires = 200, created.Add(3*time.Hour)
+	stored, err := repo.Complete(ctx, lapsed, created.Add(time.Hour))
+	require.Nil(t, err)
+	assert.False(t, stored, "lease expired")
+
+	other := newIdempotentRequest("key-1", "alice", "hash-2", created)
+	other.Status, other.Expires = 200, created.Add(3*time.Hour)
+	stored, err = repo.Complete(ctx, other, created.Add(time.Minute))
+	require.Nil(t, err)
+	assert.False(t, stored, "reserved with another body hash")
+
+	first.Status, first.ContentType, first.Body = 200, "application/json", []byte(`"created"`)
+	first.Expires = created.Add(2 * time.Hour)
+	stored, err = repo.Complete(ctx, first, created.Add(time.Minute))
+	require.Nil(t, err)
+	assert.True(t, stored)
+	require.Nil(t, repo.Release(ctx, first.Key, first.Caller))
+
+	stored, err = repo.Complete(ctx, first, created.Add(2*time.Minute))
+	require.Nil(t, err)
+	assert.False(t, stored, "response already stored")
+
+	existing, err = repo.Reserve(ctx, newIdempotentRequest("key-1", "alice", "hash-1", created.Add(time.Hour)))
+	require.Nil(t, err)
+	assert.EqualValues(t, first, existing, "completed keys are kept past the reservation")
+
+	existing, err = repo.Reserve(ctx, newIdempotentRequest("key-1", "alice", "hash-2", created.Add(2*time.Hour)))
+	require.Nil(t, err)
+	assert.Nil(t, existing, "expired key is taken over")
+
+	deleted, err := repo.DeleteExpired(ctx, created.Add(time.Hour))
+	require.Nil(t, err)
+	assert.EqualValues(t, 1, deleted, "the key of bob")
+}
@@ -0,0 +1,363 @@
+// Package repotest is the conformance test suite for implementations of
+// usecase/user.Repository. Every backend runs it from its own tests.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/entity"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fixture returns an empty repository owned by one test. It registers its
+// own cleanup with t.Cleanup.
+type Fixture func(t *testing.T) userUsecase.Repository
+
+// TxFixture returns an empty repository together with the transaction
+// manager it takes part in.
+type TxFixture func(t *testing.T) (userUsecase.Repository, userUsecase.TxManager)
+
+var ctx = context.Background()
+
+// day is the creation date of the test users. Dates are whole days in UTC
+// because the postgres users.created column is a date.
+var day = time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC)
+
+func newUser(id, email string, created time.Time) *entity.User {
+	return &entity.User{
+		ID:        id,
+		Firstname: "NewUser",
+		Lastname:  "NewUserLastname",
+		Email:     email,
+		Age:       30,
+		Created:   created,
+		Updated:   created.Add(time.Minute),
+	}
+}
+
+// RunUserRepositoryTests runs the suite, every test against a fresh repository.
+func RunUserRepositoryTests(t *testing.T, newRepo Fixture) {
+	tests := []struct {
+		name string
+		run  func(*testing.T, userUsecase.Repository)
+	}{
+		{"create and get", testCreateAndGet},
+		{"not found", testNotFound},
+		{"get by ids", testGetByIds},
+		{"duplicate email", testDuplicateEmail},
+		{"ordering", testOrdering},
+		{"update", testUpdate},
+		{"delete", testDelete},
+		{"stream stops on error", testStreamStopsOnError},
+		{"batch", testBatch},
+		{"concurrency", testConcurrency},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newRepo(t))
+		})
+	}
+}
+
+func testCreateAndGet(t *testing.T, repo userUsecase.Repository) {
+	user := newUser("a01c6ae7-86c1-400e-beb2-5a5c6e15785c", "newuser@gmail.com", day)
+
+	userId, err := repo.Create(ctx, user)
+	require.Nil(t, err)
+	assert.EqualValues(t, user.ID, userId)
+
+	byId, err := repo.GetById(ctx, user.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, user, byId)
+
+	byEmail, err := repo.GetByEmail(ctx, user.Email)
+	require.Nil(t, err)
+	assert.EqualValues(t, user, byEmail)
+}
+
+func testNotFound(t *testing.T, repo userUsecase.Repository) {
+	const userId = "a01c6ae7-86c1-400e-beb2-5a5c6e15785a"
+
+	_, err := repo.GetById(ctx, userId)
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "GetById: %v", err)
+
+	_, err = repo.GetByEmail(ctx, "nobody@gmail.com")
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "GetByEmail: %v", err)
+
+	_, err = repo.Update(ctx, userId, newUser(userId, "nobody@gmail.com", day))
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "Update: %v", err)
+
+	_, err = repo.Delete(ctx, userId)
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "Delete: %v", err)
+}
+
+func testGetByIds(t *testing.T, repo userUsecase.Repository) {
+	users, err := repo.GetByIds(ctx, nil)
+	require.Nil(t, err)
+	assert.Empty(t, users)
+
+	first := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	second := newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", "user2@gmail.com", day)
+	for _, u := range []*entity.User{first, second, newUser("1d2ef152-f440-4be2-b659-46cc6dcbc966", "user3@gmail.com", day)} {
+		_, err = repo.Create(ctx, u)
+		require.Nil(t, err)
+	}
+
+	users, err = repo.GetByIds(ctx, []string{second.ID, "a01c6ae7-86c1-400e-beb2-5a5c6e15785a", first.ID})
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []*entity.User{first, second}, users)
+}
+
+func testDuplicateEmail(t *testing.T, repo userUsecase.Repository) {
+	first := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	second := newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", "user2@gmail.com", day)
+	_, err := repo.Create(ctx, first)
+	require.Nil(t, err)
+	_, err = repo.Create(ctx, second)
+	require.Nil(t, err)
+
+	_, err = repo.Create(ctx, newUser("1d2ef152-f440-4be2-b659-46cc6dcbc966", first.Email, day))
+	assertConflict(t, "Email", err, "Create with a taken email")
+
+	_, err = repo.Create(ctx, newUser(first.ID, "user3@gmail.com", day))
+	assertConflict(t, "ID", err, "Create with a taken ID")
+
+	_, err = repo.Update(ctx, second.ID, newUser(second.ID, first.Email, day))
+	assertConflict(t, "Email", err, "Update to a taken email")
+
+	stored, err := repo.GetById(ctx, second.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, second, stored)
+}
+
+// assertConflict checks that err is an entity.ConflictError naming field.
+func assertConflict(t *testing.T, field string, err error, msg string) {
+	var conflict *entity.ConflictError
+	if assert.True(t, errors.As(err, &conflict), "%s: %v", msg, err) {
+		assert.True(t, errors.Is(err, entity.ErrConflict), msg)
+		assert.EqualValues(t, field, conflict.Field, msg)
+	}
+}
+
+func testOrdering(t *testing.T, repo userUsecase.Repository) {
+	users, err := repo.GetAll(ctx)
+	require.Nil(t, err)
+	assert.Empty(t, users)
+
+	expected := []*entity.User{
+		newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user2@gmail.com", day),
+		newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", "user3@gmail.com", day),
+		newUser("1d2ef152-f440-4be2-b659-46cc6dcbc966", "user1@gmail.com", day.AddDate(0, 0, 1)),
+	}
+	for _, i := range []int{2, 1, 0} {
+		_, err = repo.Create(ctx, expected[i])
+		require.Nil(t, err)
+	}
+
+	users, err = repo.GetAll(ctx)
+	require.Nil(t, err)
+	assert.EqualValues(t, expected, users)
+
+	var streamed []*entity.User
+	err = repo.StreamAll(ctx, func(u *entity.User) error {
+		user := *u
+		streamed = append(streamed, &user)
+		return nil
+	})
+	require.Nil(t, err)
+	assert.EqualValues(t, expected, streamed)
+}
+
+func testUpdate(t *testing.T, repo userUsecase.Repository) {
+	user := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	_, err := repo.Create(ctx, user)
+	require.Nil(t, err)
+
+	updated := newUser(user.ID, "user1upd@gmail.com", day.AddDate(0, 1, 0))
+	updated.Firstname, updated.Age = "NewUserUPD", 31
+	userId, err := repo.Update(ctx, user.ID, updated)
+	require.Nil(t, err)
+	assert.EqualValues(t, user.ID, userId)
+
+	stored, err := repo.GetById(ctx, user.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, updated, stored)
+
+	_, err = repo.GetByEmail(ctx, user.Email)
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "old email: %v", err)
+}
+
+func testDelete(t *testing.T, repo userUsecase.Repository) {
+	user := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	_, err := repo.Create(ctx, user)
+	require.Nil(t, err)
+
+	userId, err := repo.Delete(ctx, user.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, user.ID, userId)
+
+	_, err = repo.GetById(ctx, user.ID)
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "GetById: %v", err)
+
+	// The email is free again.
+	_, err = repo.Create(ctx, newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", user.Email, day))
+	assert.Nil(t, err)
+}
+
+func testStreamStopsOnError(t *testing.T, repo userUsecase.Repository) {
+	for i := 0; i < 3; i++ {
+		u := entity.NewUser()
+		u.Email, u.Created = fmt.Sprintf("user%d@gmail.com", i), day
+		_, err := repo.Create(ctx, u)
+		require.Nil(t, err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.StreamAll(ctx, func(*entity.User) error {
+		calls++
+		return stop
+	})
+	assert.True(t, errors.Is(err, stop), "StreamAll: %v", err)
+	assert.EqualValues(t, 1, calls)
+}
+
+func testBatch(t *testing.T, repo userUsecase.Repository) {
+	batchRepo, ok := repo.(userUsecase.BatchRepository)
+	if !ok {
+		t.Skip("repository does not implement BatchRepository")
+	}
+
+	ops := []*entity.BatchOperation{
+		{Op: entity.BatchCreate, ID: "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", User: newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)},
+		{Op: entity.BatchCreate, ID: "f2a44f36-0956-4019-9134-bbb0a2f63b01", User: newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", "user2@gmail.com", day)},
+		{Op: entity.BatchDelete, ID: "a01c6ae7-86c1-400e-beb2-5a5c6e15785a"},
+	}
+
+	results, err := batchRepo.Batch(ctx, ops, true)
+	assert.NotNil(t, err, "atomic batch with a missing user")
+	require.Len(t, results, len(ops))
+	assert.NotEmpty(t, results[2].Error)
+	users, err := repo.GetAll(ctx)
+	require.Nil(t, err)
+	assert.Empty(t, users, "atomic batch must be rolled back")
+
+	results, err = batchRepo.Batch(ctx, ops, false)
+	require.Nil(t, err)
+	require.Len(t, results, len(ops))
+	assert.Empty(t, results[0].Error)
+	assert.Empty(t, results[1].Error)
+	assert.NotEmpty(t, results[2].Error)
+	users, err = repo.GetAll(ctx)
+	require.Nil(t, err)
+	assert.Len(t, users, 2)
+}
+
+func testConcurrency(t *testing.T, repo userUsecase.Repository) {
+	const workers, emails = 20, 5
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := entity.NewUser()
+			u.Email, u.Created = fmt.Sprintf("user%d@gmail.com", i%emails), day
+			_, _ = repo.Create(ctx, u)
+			_, _ = repo.GetAll(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	users, err := repo.GetAll(ctx)
+	require.Nil(t, err)
+	assert.Len(t, users, emails, "exactly one user per email")
+}
+
+// RunTxTests checks that the repository honors transactions of the manager.
+func RunTxTests(t *testing.T, newRepo TxFixture) {
+	tests := []struct {
+		name string
+		run  func(*testing.T, userUsecase.Repository, userUsecase.TxManager)
+	}{
+		{"commit", testTxCommit},
+		{"rollback", testTxRollback},
+		{"nested", testTxNested},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, tm := newRepo(t)
+			test.run(t, repo, tm)
+		})
+	}
+}
+
+func testTxCommit(t *testing.T, repo userUsecase.Repository, tm userUsecase.TxManager) {
+	first := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	second := newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", "user2@gmail.com", day)
+
+	err := tm.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := repo.Create(ctx, first); err != nil {
+			return err
+		}
+		_, err := repo.Create(ctx, second)
+		return err
+	})
+	require.Nil(t, err)
+
+	users, err := repo.GetAll(ctx)
+	require.Nil(t, err)
+	assert.Len(t, users, 2)
+}
+
+func testTxRollback(t *testing.T, repo userUsecase.Repository, tm userUsecase.TxManager) {
+	user := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	fail := errors.New("fail")
+
+	err := tm.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := repo.Create(ctx, user); err != nil {
+			return err
+		}
+
+		// The transaction sees its own writes.
+		stored, err := repo.GetById(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		assert.EqualValues(t, user, stored)
+		return fail
+	})
+	assert.True(t, errors.Is(err, fail), "WithinTx: %v", err)
+
+	_, err = repo.GetById(ctx, user.ID)
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "GetById: %v", err)
+}
+
+func testTxNested(t *testing.T, repo userUsecase.Repository, tm userUsecase.TxManager) {
+	user := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	fail := errors.New("fail")
+
+	err := tm.WithinTx(ctx, func(ctx context.Context) error {
+		err := tm.WithinTx(ctx, func(ctx context.Context) error {
+			_, err := repo.Create(ctx, user)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return fail
+	})
+	assert.True(t, errors.Is(err, fail), "WithinTx: %v", err)
+
+	// The inner call joined the outer transaction and was rolled back with it.
+	_, err = repo.GetById(ctx, user.ID)
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "GetById: %v", err)
+}
@@ -0,0 +1,72 @@
+package repotest
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"playground/rest-api/gomasters/entity"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"testing"
+	"time"
+)
+
+// VersionFixture returns an empty version repository owned by one test.
+type VersionFixture func(t *testing.T) userUsecase.VersionRepository
+
+// RunVersionRepositoryTests checks that saving a user closes its current
+// version, that AsOf finds the version valid at a time and that a closed
+// user has no current version.
+func RunVersionRepositoryTests(t *testing.T, newRepo VersionFixture) {
+	repo := newRepo(t)
+
+	user := newUser("1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", "user1@gmail.com", day)
+	updated := newUser(user.ID, "user1upd@gmail.com", day)
+	other := newUser("f2a44f36-0956-4019-9134-bbb0a2f63b01", "user2@gmail.com", day)
+
+	created, changed, deleted := day.Add(time.Hour), day.Add(2*time.Hour), day.Add(3*time.Hour)
+	require.Nil(t, repo.Save(ctx, user, created))
+	require.Nil(t, repo.Save(ctx, other, created))
+	require.Nil(t, repo.Save(ctx, updated, changed))
+	require.Nil(t, repo.Close(ctx, user.ID, deleted))
+
+	versions, err := repo.Versions(ctx, user.ID)
+	require.Nil(t, err)
+	assert.EqualValues(t, []*entity.UserVersion{
+		{Version: 1, User: user, ValidFrom: created, ValidTo: &changed},
+		{Version: 2, User: updated, ValidFrom: changed, ValidTo: &deleted},
+	}, versions)
+
+	v, err := repo.Version(ctx, user.ID, 2)
+	require.Nil(t, err)
+	assert.EqualValues(t, updated, v.User)
+
+	_, err = repo.Version(ctx, user.ID, 3)
+	assert.True(t, errors.Is(err, entity.ErrNotFound), "unknown version: %v", err)
+
+	cases := []struct {
+		name     string
+		at       time.Time
+		expected *entity.User
+	}{
+		{name: "before create", at: created.Add(-time.Second)},
+		{name: "at create", at: created, expected: user},
+		{name: "before update", at: changed.Add(-time.Second), expected: user},
+		{name: "at update", at: changed, expected: updated},
+		{name: "after delete", at: deleted},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u, err := repo.AsOf(ctx, user.ID, c.at)
+			if c.expected == nil {
+				assert.True(t, errors.Is(err, entity.ErrNotFound), "no version: %v", err)
+				return
+			}
+			require.Nil(t, err)
+			assert.EqualValues(t, c.expected, u)
+		})
+	}
+
+	u, err := repo.AsOf(ctx, other.ID, deleted)
+	require.Nil(t, err)
+	assert.EqualValues(t, other, u)
+}
@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"playground/rest-api/gomasters/entity"
+	"regexp"
+)
+
+// uniqueViolation matches the message of SQLITE_CONSTRAINT_UNIQUE and
+// SQLITE_CONSTRAINT_PRIMARYKEY errors on the users table. Violations of an
+// expression index name the index instead of the column.
+var uniqueViolation = regexp.MustCompile(`UNIQUE constraint failed: (?:users\.|index ')(\w+)`)
+
+// uniqueFields maps the unique columns and indexes of the users table to the user fields.
+var uniqueFields = map[string]string{
+	"id":                    "ID",
+	"email":                 "Email",
+	"users_email_lower_key": "Email",
+}
+
+// Conflict returns an entity.ConflictError when err is a unique violation on
+// the users table, otherwise nil.
+func Conflict(err error) error {
+	m := uniqueViolation.FindStringSubmatch(err.Error())
+	if m == nil {
+		return nil
+	}
+
+	field, ok := uniqueFields[m[1]]
+	if !ok {
+		return nil
+	}
+	return entity.Conflict(field)
+}
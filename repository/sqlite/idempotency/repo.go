@@ -0,0 +1,83 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"time"
+)
+
+// Repository keeps idempotent requests and their responses in the SQLite
+// idempotency_keys table. Times are stored in UTC so that they compare in order.
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// Reserve inserts the request, or takes over the row of an expired one.
+func (ir *Repository) Reserve(ctx context.Context, r *entity.IdempotentRequest) (*entity.IdempotentRequest, error) {
+	res, err := ir.db.ExecContext(ctx,
+		"INSERT INTO idempotency_keys(key, caller, body_hash, created, expires) VALUES ($1, $2, $3, $4, $5) "+
+			"ON CONFLICT (key, caller) DO UPDATE SET body_hash=excluded.body_hash, status=NULL, content_type=NULL, body=NULL, "+
+			"created=excluded.created, expires=excluded.expires WHERE idempotency_keys.expires <= excluded.created;",
+		r.Key, r.Caller, r.BodyHash, r.Created.UTC(), r.Expires.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("reserve idempotency key error: %v", err)
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 1 {
+		return nil, nil
+	}
+
+	existing := &entity.IdempotentRequest{}
+	var status sql.NullInt32
+	var contentType sql.NullString
+	if err = ir.db.QueryRowContext(ctx,
+		"SELECT key, caller, body_hash, status, content_type, body, created, expires FROM idempotency_keys WHERE key=$1 AND caller=$2;",
+		r.Key, r.Caller).Scan(&existing.Key, &existing.Caller, &existing.BodyHash, &status, &contentType,
+		&existing.Body, &existing.Created, &existing.Expires); err != nil {
+		return nil, fmt.Errorf("get idempotency key row scan error: %v", err)
+	}
+
+	existing.Status, existing.ContentType = int(status.Int32), contentType.String
+	existing.Created, existing.Expires = existing.Created.UTC(), existing.Expires.UTC()
+	return existing, nil
+}
+
+// Complete updates the row only while it is the reservation of r, so that a
+// request whose lease has run out does not overwrite a takeover.
+func (ir *Repository) Complete(ctx context.Context, r *entity.IdempotentRequest, now time.Time) (bool, error) {
+	res, err := ir.db.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status=$3, content_type=$4, body=$5, expires=$6 "+
+			"WHERE key=$1 AND caller=$2 AND body_hash=$7 AND status IS NULL AND expires > $8;",
+		r.Key, r.Caller, r.Status, r.ContentType, r.Body, r.Expires.UTC(), r.BodyHash, now.UTC())
+	if err != nil {
+		return false, fmt.Errorf("complete idempotency key error: %v", err)
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+func (ir *Repository) Release(ctx context.Context, key, caller string) error {
+	if _, err := ir.db.ExecContext(ctx,
+		"DELETE FROM idempotency_keys WHERE key=$1 AND caller=$2 AND status IS NULL;", key, caller); err != nil {
+		return fmt.Errorf("release idempotency key error: %v", err)
+	}
+	return nil
+}
+
+func (ir *Repository) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := ir.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires <= $1;", now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired idempotency keys error: %v", err)
+	}
+
+	deleted, _ := res.RowsAffected()
+	return int(deleted), nil
+}
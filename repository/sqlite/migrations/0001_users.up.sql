@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    id         text PRIMARY KEY,
+    first_name varchar(40) NOT NULL,
+    last_name  varchar(40) NOT NULL,
+    email      varchar(40) NOT NULL UNIQUE,
+    age        int         NOT NULL,
+    created    datetime    NOT NULL
+);
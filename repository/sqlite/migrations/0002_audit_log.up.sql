@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    seq        integer PRIMARY KEY AUTOINCREMENT,
+    id         text        NOT NULL UNIQUE,
+    entity_id  text        NOT NULL,
+    action     varchar(10) NOT NULL,
+    actor      text        NOT NULL,
+    request_id text        NOT NULL,
+    changes    text        NOT NULL,
+    created    datetime    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_id, seq);
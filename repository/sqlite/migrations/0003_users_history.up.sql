@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS users_history
+(
+    id         text        NOT NULL,
+    version    int         NOT NULL,
+    first_name varchar(40) NOT NULL,
+    last_name  varchar(40) NOT NULL,
+    email      varchar(40) NOT NULL,
+    age        int         NOT NULL,
+    created    datetime    NOT NULL,
+    valid_from datetime    NOT NULL,
+    valid_to   datetime,
+    PRIMARY KEY (id, version)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_history_current_idx ON users_history (id) WHERE valid_to IS NULL;
+
+-- Users created before the history existed get their first version.
+INSERT INTO users_history(id, version, first_name, last_name, email, age, created, valid_from)
+SELECT id, 1, first_name, last_name, email, age, created, created
+FROM users;
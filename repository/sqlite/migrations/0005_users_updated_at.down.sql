@@ -0,0 +1,3 @@
+ALTER TABLE users_history DROP COLUMN updated_at;
+
+ALTER TABLE users DROP COLUMN updated_at;
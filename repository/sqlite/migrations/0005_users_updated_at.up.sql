@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN updated_at datetime NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE users SET updated_at = created;
+
+ALTER TABLE users_history ADD COLUMN updated_at datetime NOT NULL DEFAULT '1970-01-01 00:00:00';
+UPDATE users_history SET updated_at = valid_from;
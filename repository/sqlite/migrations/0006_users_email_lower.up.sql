@@ -0,0 +1,4 @@
+-- Emails are stored lowercased. Rows written before that are backfilled, two
+-- emails differing only in case make the migration fail and have to be merged first.
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
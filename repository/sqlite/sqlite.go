@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	_ "modernc.org/sqlite"
+	"playground/rest-api/gomasters/repository/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Open opens the SQLite database at path and applies pending migrations.
+// ":memory:" gives a private in-memory database.
+func Open(path string) (*sql.DB, error) {
+	db, err := Connect(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = Migrate(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Connect opens the SQLite database at path as it is, for the migrate command.
+func Connect(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite error: %v", err)
+	}
+	// SQLite allows one writer at a time, and every connection to ":memory:"
+	// would get its own empty database.
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.Exec("PRAGMA foreign_keys = ON; PRAGMA busy_timeout = 5000;"); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("sqlite pragma error: %v", err)
+	}
+	return db, nil
+}
+
+// Migrations returns the embedded migrations of the SQLite schema.
+func Migrations() ([]migrate.Migration, error) {
+	return migrate.Load(migrations, "migrations")
+}
+
+// Migrate applies the pending embedded migrations.
+func Migrate(db *sql.DB) error {
+	ms, err := Migrations()
+	if err != nil {
+		return err
+	}
+	_, err = migrate.Up(db, ms)
+	return err
+}
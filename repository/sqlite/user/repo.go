@@ -0,0 +1,245 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/sqlite"
+	"playground/rest-api/gomasters/repository/sqltx"
+	"strings"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+func (ur *Repository) GetAll(ctx context.Context) ([]*entity.User, error) {
+	var users []*entity.User
+	err := ur.StreamAll(ctx, func(u *entity.User) error {
+		user := *u
+		users = append(users, &user)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (ur *Repository) StreamAll(ctx context.Context, fn func(*entity.User) error) error {
+	rows, err := sqltx.Conn(ctx, ur.db).QueryContext(ctx, "SELECT id, first_name, last_name, email, age, created, updated_at FROM users ORDER BY created, id;")
+	if err != nil {
+		return fmt.Errorf("get all users query error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	var u entity.User
+	for rows.Next() {
+		if err = rows.Scan(&u.ID, &u.Firstname, &u.Lastname, &u.Email, &u.Age, &u.Created, &u.Updated); err != nil {
+			return fmt.Errorf("get all users rows scan error: %v", err)
+		}
+		u.Updated = u.Updated.UTC()
+
+		if err = fn(&u); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("get all users rows error: %v", err)
+	}
+	return nil
+}
+
+func (ur *Repository) Create(ctx context.Context, u *entity.User) (string, error) {
+	if err := insertUser(ctx, sqltx.Conn(ctx, ur.db), u); err != nil {
+		return "", err
+	}
+
+	return u.ID, nil
+}
+
+func (ur *Repository) GetById(ctx context.Context, id string) (*entity.User, error) {
+	return ur.getBy(ctx, "id", id)
+}
+
+// GetByIds reads all users in one query.
+func (ur *Repository) GetByIds(ctx context.Context, ids []string) ([]*entity.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := sqltx.Conn(ctx, ur.db).QueryContext(ctx,
+		"SELECT id, first_name, last_name, email, age, created, updated_at FROM users WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+");", args...)
+	if err != nil {
+		return nil, fmt.Errorf("get users by ids query error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	var users []*entity.User
+	for rows.Next() {
+		var u entity.User
+		if err = rows.Scan(&u.ID, &u.Firstname, &u.Lastname, &u.Email, &u.Age, &u.Created, &u.Updated); err != nil {
+			return nil, fmt.Errorf("get users by ids rows scan error: %v", err)
+		}
+		u.Updated = u.Updated.UTC()
+
+		users = append(users, &u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get users by ids rows error: %v", err)
+	}
+	return users, nil
+}
+
+func (ur *Repository) GetByEmail(ctx context.Context, email string) (*entity.User, error) {
+	return ur.getBy(ctx, "email", email)
+}
+
+func (ur *Repository) Update(ctx context.Context, userId string, u *entity.User) (string, error) {
+	if err := updateUser(ctx, sqltx.Conn(ctx, ur.db), userId, u); err != nil {
+		return "", err
+	}
+
+	return u.ID, nil
+}
+
+func (ur *Repository) Delete(ctx context.Context, userId string) (string, error) {
+	if err := deleteUser(ctx, sqltx.Conn(ctx, ur.db), userId); err != nil {
+		return "", err
+	}
+
+	return userId, nil
+}
+
+// Batch runs all operations in the transaction carried by ctx or in its own.
+// In atomic mode the first failure rolls back the whole batch; otherwise each
+// operation runs under its own savepoint and only the failed ones are rolled back.
+func (ur *Repository) Batch(ctx context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error) {
+	results := entity.NewBatchResults(ops)
+
+	var batchErr error
+	err := sqltx.Run(ctx, ur.db, func(tx *sql.Tx) error {
+		for i, op := range ops {
+			if atomic {
+				if err := runOperation(ctx, tx, op); err != nil {
+					for _, r := range results {
+						r.Error = "rolled back"
+					}
+					results[i].Error = err.Error()
+					batchErr = fmt.Errorf("batch error: %v", err)
+					return batchErr
+				}
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_item;"); err != nil {
+				return fmt.Errorf("savepoint error: %v", err)
+			}
+			if opErr := runOperation(ctx, tx, op); opErr != nil {
+				results[i].Error = opErr.Error()
+				if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_item;"); err != nil {
+					return fmt.Errorf("rollback to savepoint error: %v", err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_item;"); err != nil {
+				return fmt.Errorf("release savepoint error: %v", err)
+			}
+		}
+		return nil
+	})
+	if batchErr != nil {
+		return results, batchErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("batch error: %v", err)
+	}
+
+	return results, nil
+}
+
+func (ur *Repository) getBy(ctx context.Context, column, value string) (*entity.User, error) {
+	var u entity.User
+	row := sqltx.Conn(ctx, ur.db).QueryRowContext(ctx,
+		"SELECT id, first_name, last_name, email, age, created, updated_at FROM users WHERE "+column+"=$1;", value)
+	if err := row.Scan(&u.ID, &u.Firstname, &u.Lastname, &u.Email, &u.Age, &u.Created, &u.Updated); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user by %s error: %w", column, entity.ErrNotFound)
+		}
+		return nil, fmt.Errorf("get user by %s row scan error: %v", column, err)
+	}
+	u.Updated = u.Updated.UTC()
+
+	return &u, nil
+}
+
+func runOperation(ctx context.Context, tx *sql.Tx, op *entity.BatchOperation) error {
+	switch op.Op {
+	case entity.BatchCreate:
+		return insertUser(ctx, tx, op.User)
+	case entity.BatchUpdate:
+		return updateUser(ctx, tx, op.ID, op.User)
+	case entity.BatchDelete:
+		return deleteUser(ctx, tx, op.ID)
+	default:
+		return fmt.Errorf("unknown batch operation: %s", op.Op)
+	}
+}
+
+func insertUser(ctx context.Context, q sqltx.Querier, u *entity.User) error {
+	if _, err := q.ExecContext(ctx,
+		"INSERT INTO users(id, first_name, last_name, email, age, created, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7);",
+		u.ID, u.Firstname, u.Lastname, u.Email, u.Age, u.Created, u.Updated.UTC()); err != nil {
+		if conflict := sqlite.Conflict(err); conflict != nil {
+			return fmt.Errorf("create error: %w", conflict)
+		}
+		return fmt.Errorf("create error: %v", err)
+	}
+
+	return nil
+}
+
+func updateUser(ctx context.Context, q sqltx.Querier, userId string, u *entity.User) error {
+	res, err := q.ExecContext(ctx,
+		"UPDATE users SET id=$1, first_name=$2, last_name=$3, email=$4, age=$5, created=$6, updated_at=$7 WHERE id=$8;",
+		u.ID, u.Firstname, u.Lastname, u.Email, u.Age, u.Created, u.Updated.UTC(), userId)
+	if err != nil {
+		if conflict := sqlite.Conflict(err); conflict != nil {
+			return fmt.Errorf("update error: %w", conflict)
+		}
+		return fmt.Errorf("update error: %v", err)
+	}
+
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected != 1 {
+		return fmt.Errorf("update error: %w", entity.ErrNotFound)
+	}
+	return nil
+}
+
+func deleteUser(ctx context.Context, q sqltx.Querier, userId string) error {
+	res, err := q.ExecContext(ctx, "DELETE FROM users WHERE id=$1;", userId)
+	if err != nil {
+		return fmt.Errorf("delete error: %v", err)
+	}
+
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected != 1 {
+		return entity.NotFound("no row found to delete")
+	}
+	return nil
+}
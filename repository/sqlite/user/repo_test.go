@@ -0,0 +1,61 @@
+package user
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"playground/rest-api/gomasters/repository/repotest"
+	"playground/rest-api/gomasters/repository/sqlite"
+	"playground/rest-api/gomasters/repository/sqlite/audit"
+	"playground/rest-api/gomasters/repository/sqlite/idempotency"
+	"playground/rest-api/gomasters/repository/sqlite/version"
+	"playground/rest-api/gomasters/repository/sqltx"
+	idempotencyUsecase "playground/rest-api/gomasters/usecase/idempotency"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+	"testing"
+)
+
+func openDb(t *testing.T) *sql.DB {
+	db, err := sqlite.Open(":memory:")
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestRepository_Contract(t *testing.T) {
+	repotest.RunUserRepositoryTests(t, func(t *testing.T) userUsecase.Repository {
+		db := openDb(t)
+
+		// Migrations are applied once, running them again is a no-op.
+		assert.Nil(t, sqlite.Migrate(db))
+
+		return NewRepository(db)
+	})
+}
+
+func TestRepository_Tx(t *testing.T) {
+	repotest.RunTxTests(t, func(t *testing.T) (userUsecase.Repository, userUsecase.TxManager) {
+		db := openDb(t)
+		return NewRepository(db), sqltx.NewManager(db, sqltx.Options{})
+	})
+}
+
+func TestAuditRepository_Contract(t *testing.T) {
+	repotest.RunAuditRepositoryTests(t, func(t *testing.T) userUsecase.AuditRepository {
+		return audit.NewRepository(openDb(t))
+	})
+}
+
+func TestVersionRepository_Contract(t *testing.T) {
+	repotest.RunVersionRepositoryTests(t, func(t *testing.T) userUsecase.VersionRepository {
+		return version.NewRepository(openDb(t))
+	})
+}
+
+func TestIdempotencyRepository_Contract(t *testing.T) {
+	repotest.RunIdempotencyRepositoryTests(t, func(t *testing.T) idempotencyUsecase.Repository {
+		return idempotency.NewRepository(openDb(t))
+	})
+}
@@ -0,0 +1,123 @@
+package version
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/sqltx"
+	"time"
+)
+
+// Repository keeps the versions of the users in the SQLite users_history
+// table. Times are stored in UTC so that they compare in order.
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+const selectVersions = "SELECT id, first_name, last_name, email, age, created, updated_at, version, valid_from, valid_to FROM users_history"
+
+func (vr *Repository) Save(ctx context.Context, u *entity.User, at time.Time) error {
+	return sqltx.Run(ctx, vr.db, func(tx *sql.Tx) error {
+		if err := closeVersion(ctx, tx, u.ID, at); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO users_history(id, first_name, last_name, email, age, created, updated_at, version, valid_from) "+
+				"SELECT $1, $2, $3, $4, $5, $6, $7, COALESCE(MAX(version), 0) + 1, $8 FROM users_history WHERE id=$1;",
+			u.ID, u.Firstname, u.Lastname, u.Email, u.Age, u.Created, u.Updated.UTC(), at.UTC()); err != nil {
+			return fmt.Errorf("save user version error: %v", err)
+		}
+		return nil
+	})
+}
+
+func (vr *Repository) Close(ctx context.Context, userId string, at time.Time) error {
+	return closeVersion(ctx, sqltx.Conn(ctx, vr.db), userId, at)
+}
+
+func (vr *Repository) AsOf(ctx context.Context, userId string, at time.Time) (*entity.User, error) {
+	v, err := scanVersion(sqltx.Conn(ctx, vr.db).QueryRowContext(ctx,
+		selectVersions+" WHERE id=$1 AND valid_from <= $2 AND (valid_to IS NULL OR valid_to > $2);", userId, at.UTC()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user as of %v error: %w", at, entity.ErrNotFound)
+		}
+		return nil, fmt.Errorf("get user as of row scan error: %v", err)
+	}
+
+	return v.User, nil
+}
+
+func (vr *Repository) Version(ctx context.Context, userId string, version int) (*entity.UserVersion, error) {
+	v, err := scanVersion(sqltx.Conn(ctx, vr.db).QueryRowContext(ctx,
+		selectVersions+" WHERE id=$1 AND version=$2;", userId, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("get user version %d error: %w", version, entity.ErrNotFound)
+		}
+		return nil, fmt.Errorf("get user version row scan error: %v", err)
+	}
+
+	return v, nil
+}
+
+func (vr *Repository) Versions(ctx context.Context, userId string) ([]*entity.UserVersion, error) {
+	rows, err := sqltx.Conn(ctx, vr.db).QueryContext(ctx, selectVersions+" WHERE id=$1 ORDER BY version;", userId)
+	if err != nil {
+		return nil, fmt.Errorf("get user versions query error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer rows.Close()
+
+	var versions []*entity.UserVersion
+	for rows.Next() {
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get user versions rows scan error: %v", err)
+		}
+		versions = append(versions, v)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get user versions rows error: %v", err)
+	}
+	return versions, nil
+}
+
+func closeVersion(ctx context.Context, q sqltx.Querier, userId string, at time.Time) error {
+	if _, err := q.ExecContext(ctx,
+		"UPDATE users_history SET valid_to=$2 WHERE id=$1 AND valid_to IS NULL;", userId, at.UTC()); err != nil {
+		return fmt.Errorf("close user version error: %v", err)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanVersion(s scanner) (*entity.UserVersion, error) {
+	v := &entity.UserVersion{User: &entity.User{}}
+	var validTo sql.NullTime
+	u := v.User
+	if err := s.Scan(&u.ID, &u.Firstname, &u.Lastname, &u.Email, &u.Age, &u.Created, &u.Updated,
+		&v.Version, &v.ValidFrom, &validTo); err != nil {
+		return nil, err
+	}
+
+	u.Updated, v.ValidFrom = u.Updated.UTC(), v.ValidFrom.UTC()
+	if validTo.Valid {
+		t := validTo.Time.UTC()
+		v.ValidTo = &t
+	}
+	return v, nil
+}
@@ -0,0 +1,145 @@
+// Package sqltx carries database/sql transactions in a context, so several
+// repository calls made by a usecase can share one transaction.
+package sqltx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+type Options struct {
+	Isolation sql.IsolationLevel
+	// MaxRetries is how many times a transaction failing with a Retryable
+	// error is run again.
+	MaxRetries int
+	Retryable  func(error) bool
+}
+
+// Manager starts transactions on db and hands them to repositories through
+// the context.
+type Manager struct {
+	db   *sql.DB
+	opts Options
+}
+
+func NewManager(db *sql.DB, opts Options) *Manager {
+	return &Manager{
+		db: db, opts: opts,
+	}
+}
+
+// WithinTx runs fn in a transaction carried by the context passed to fn and
+// commits it when fn succeeds. A call inside another transaction joins it.
+// fn may run several times when the transaction fails with a retryable error,
+// so it must not have side effects outside of the database.
+func (m *Manager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := FromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := m.run(ctx, fn)
+		if err == nil || m.opts.Retryable == nil || !m.opts.Retryable(err) || attempt >= m.opts.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+		}
+	}
+}
+
+func (m *Manager) run(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{Isolation: m.opts.Isolation})
+	if err != nil {
+		return fmt.Errorf("begin tx error: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback()
+
+	if err = fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx error: %w", err)
+	}
+	return nil
+}
+
+// FromContext returns the transaction started by WithinTx, if any.
+func FromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// InTx reports whether ctx carries a transaction.
+func InTx(ctx context.Context) bool {
+	_, ok := FromContext(ctx)
+	return ok
+}
+
+// Conn returns the transaction carried by ctx, or db outside of one.
+func Conn(ctx context.Context, db *sql.DB) Querier {
+	if tx, ok := FromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
+
+// Run runs fn in the transaction carried by ctx, or else in a new one that is
+// committed when fn succeeds. Repositories use it for writes made of several
+// statements.
+func Run(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	if tx, ok := FromContext(ctx); ok {
+		return fn(tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx error: %v", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit tx error: %v", err)
+	}
+	return nil
+}
+
+// ParseIsolation maps the isolation names used in configuration, such as
+// "repeatable read", to sql.IsolationLevel. An empty name is the driver default.
+func ParseIsolation(name string) (sql.IsolationLevel, error) {
+	switch name {
+	case "":
+		return sql.LevelDefault, nil
+	case "read uncommitted":
+		return sql.LevelReadUncommitted, nil
+	case "read committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	default:
+		return sql.LevelDefault, fmt.Errorf("unknown isolation level %q", name)
+	}
+}
@@ -0,0 +1,73 @@
+package sqltx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+	"testing"
+)
+
+func TestManager_WithinTx_Retries(t *testing.T) {
+	conflict := errors.New("conflict")
+
+	type expected struct {
+		Calls int
+		Err   error
+	}
+
+	type payload struct {
+		Failures int
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "no failure",
+			expected: expected{Calls: 1, Err: nil},
+			payload:  payload{Failures: 0},
+		},
+		{
+			name:     "retried until success",
+			expected: expected{Calls: 3, Err: nil},
+			payload:  payload{Failures: 2},
+		},
+		{
+			name:     "retries exhausted",
+			expected: expected{Calls: 4, Err: conflict},
+			payload:  payload{Failures: 5},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := sql.Open("sqlite", ":memory:")
+			require.Nil(t, err)
+			t.Cleanup(func() { _ = db.Close() })
+
+			m := NewManager(db, Options{
+				MaxRetries: 3,
+				Retryable:  func(err error) bool { return errors.Is(err, conflict) },
+			})
+
+			calls := 0
+			err = m.WithinTx(context.Background(), func(ctx context.Context) error {
+				calls++
+				_, ok := FromContext(ctx)
+				assert.True(t, ok, "transaction in context")
+				if calls <= test.payload.Failures {
+					return conflict
+				}
+				return nil
+			})
+
+			assert.True(t, errors.Is(err, test.expected.Err), "WithinTx: %v", err)
+			assert.EqualValues(t, test.expected.Calls, calls)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Package requestctx carries request scoped values, the request ID, the
+// actor and the client certificate name, from the HTTP layer down to the
+// usecases.
+package requestctx
+
+import "context"
+
+// SystemActor is the actor of changes made outside of HTTP requests, such as
+// the import command.
+const SystemActor = "system"
+
+type requestIdKey struct{}
+
+type actorKey struct{}
+
+type clientCNKey struct{}
+
+func WithRequestID(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestID returns the ID of the request ctx belongs to, or "".
+func RequestID(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns who acts in ctx, SystemActor when nobody was set.
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+func WithClientCN(ctx context.Context, cn string) context.Context {
+	return context.WithValue(ctx, clientCNKey{}, cn)
+}
+
+// ClientCN returns the common name of the verified client certificate of
+// the request, or "" when the client sent none.
+func ClientCN(ctx context.Context) string {
+	cn, _ := ctx.Value(clientCNKey{}).(string)
+	return cn
+}
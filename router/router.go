@@ -1,32 +1,56 @@
 package router
 
 import (
-	"database/sql"
+	"expvar"
 	"fmt"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
+	"playground/rest-api/gomasters/config"
+	"playground/rest-api/gomasters/handler/middleware"
 	userHandler "playground/rest-api/gomasters/handler/user"
-	userRepo "playground/rest-api/gomasters/repository/postgres/user"
+	idempotencyUsecase "playground/rest-api/gomasters/usecase/idempotency"
 	userUsecase "playground/rest-api/gomasters/usecase/user"
 )
 
-func NewRouter(db *sql.DB, l *zap.Logger) *mux.Router {
-	// DB inject in repository
-	uRepo := userRepo.NewRepository(db)
-	//aRepo := adminRepo.NewRepository(db)
+// NewRouter builds the routes with the current config of reloader and takes
+// over the reloadable settings of every new config. level is the level of l,
+// served on /admin/log/level.
+func NewRouter(uRepo userUsecase.Repository, aRepo userUsecase.AuditRepository, vRepo userUsecase.VersionRepository,
+	iRepo idempotencyUsecase.Repository, rlStore middleware.RateLimitStore, tm userUsecase.TxManager,
+	reloader *config.Reloader, level zap.AtomicLevel, l *zap.Logger) *mux.Router {
+	cfg := reloader.Current()
 
 	// Repo inject in usecase
-	uUsecase := userUsecase.NewUsecase(uRepo)
+	uUsecase := userUsecase.NewUsecase(uRepo, aRepo, vRepo, tm)
+	iUsecase := idempotencyUsecase.NewUsecase(l, iRepo, cfg.IdempotencyTTL, cfg.IdempotencyLease)
 	//aUsecase := adminUsecase.NewUsecase(aRepo)
 
 	// Usecase inject in handler
-	uHandler := userHandler.NewHandler(l, uUsecase)
+	uHandler := userHandler.NewHandler(l, uUsecase, handlerConfig(cfg))
 	//aHandler := adminHandler.NewHandler(l, aUsecase)
 
 	r := mux.NewRouter()
-	r.Use(middleware)
+	cors, rateLimiter := middleware.NewCORS(r), middleware.NewRateLimiter(rlStore, cfg.APIKeys, l)
+	apply := func(cfg *config.AppConfig) {
+		uHandler.SetConfig(handlerConfig(cfg))
+		if err := cors.SetConfig(corsConfig(cfg)); err != nil {
+			l.Error("CORS config error, the current policy is kept", zap.Error(err))
+		}
+		rateLimiter.SetLimits(rateLimits(cfg, l))
+	}
+	apply(cfg)
+	reloader.OnReload(apply)
+
+	// CORS before the rate limit, so that preflights are not counted and 429s carry the CORS headers.
+	r.Use(middleware.RequestContext, logMiddleware, cors.Middleware, rateLimiter.Middleware)
+
+	// OPTIONS of every route, registered first so that it wins over the 405 of the other routes.
+	// A matcher rather than Methods, which would make mux answer 405 instead of 404 for unknown paths.
+	r.MatcherFunc(func(r *http.Request, _ *mux.RouteMatch) bool {
+		return r.Method == http.MethodOptions
+	}).HandlerFunc(middleware.Options(r))
 
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if _, err := w.Write([]byte("REST API works fine)")); err != nil {
@@ -34,19 +58,98 @@ func NewRouter(db *sql.DB, l *zap.Logger) *mux.Router {
 		}
 	})
 
+	if cfg.AdminToken != "" {
+		adminAuth := middleware.AdminAuth(cfg.AdminToken)
+
+		// Runtime and cache metrics published with expvar.
+		r.Handle("/debug/vars", adminAuth(http.HandlerFunc(expvarHandler))).Methods(http.MethodGet)
+
+		// GET returns and PUT {"level":"debug"} sets the log level until LOG_LEVEL changes.
+		adminRouter := r.PathPrefix("/admin").Subrouter()
+		adminRouter.Use(adminAuth)
+		adminRouter.Handle("/log/level", level).Methods(http.MethodGet, http.MethodPut)
+	}
+
 	usersRouter := r.PathPrefix("/users").Subrouter()
-	usersRouter.HandleFunc("", uHandler.GetAll).Methods(http.MethodGet)
-	usersRouter.HandleFunc("", uHandler.Create).Methods(http.MethodPost)
+	// Export has its own file formats, every other route negotiates the response format.
+	usersRouter.HandleFunc("/export", uHandler.Export).Methods(http.MethodGet)
+
+	apiRouter := usersRouter.NewRoute().Subrouter()
+	// Imports stream their body, they are not buffered for idempotency keys.
+	apiRouter.Use(userHandler.Negotiate, middleware.Idempotent(iUsecase, middleware.IdempotencyOptions{
+		MaxBytes:    cfg.IdempotencyMaxBytes,
+		SkipRoutes:  []string{http.MethodPost + " /users/import"},
+		RenderError: userHandler.RenderError,
+	}, l))
+	apiRouter.HandleFunc("", uHandler.GetAll).Methods(http.MethodGet)
+	apiRouter.HandleFunc("", uHandler.Create).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/batch", uHandler.Batch).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/import", uHandler.Import).Methods(http.MethodPost)
 
-	usersIdRouter := usersRouter.PathPrefix("/{id}").Subrouter()
+	usersIdRouter := apiRouter.PathPrefix("/{id}").Subrouter()
 	usersIdRouter.HandleFunc("", uHandler.GetById).Methods(http.MethodGet)
 	usersIdRouter.HandleFunc("", uHandler.Update).Methods(http.MethodPut)
 	usersIdRouter.HandleFunc("", uHandler.Delete).Methods(http.MethodDelete)
+	usersIdRouter.HandleFunc("/history", uHandler.History).Methods(http.MethodGet)
+	usersIdRouter.HandleFunc("/versions", uHandler.Versions).Methods(http.MethodGet)
+	usersIdRouter.HandleFunc("/revert", uHandler.Revert).Methods(http.MethodPost)
 
 	return r
 }
 
-func middleware(next http.Handler) http.Handler {
+// expvarHandler serves the published vars like expvar.Handler, without
+// cmdline: the command line may carry secrets passed as flags.
+func expvarHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = fmt.Fprint(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			_, _ = fmt.Fprint(w, ",\n")
+		}
+		first = false
+		_, _ = fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	_, _ = fmt.Fprint(w, "\n}\n")
+}
+
+func handlerConfig(cfg *config.AppConfig) userHandler.Config {
+	return userHandler.Config{
+		BatchAtomic:   cfg.BatchAtomic,
+		BatchMaxSize:  cfg.BatchMaxSize,
+		BatchMaxBytes: cfg.BatchMaxBytes,
+		CacheMaxAge:   cfg.HTTPCacheMaxAge,
+	}
+}
+
+func corsConfig(cfg *config.AppConfig) middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowedOrigins:   cfg.CorsAllowedOrigins,
+		AllowedMethods:   cfg.CorsAllowedMethods,
+		AllowedHeaders:   cfg.CorsAllowedHeaders,
+		ExposedHeaders:   cfg.CorsExposedHeaders,
+		AllowCredentials: cfg.CorsAllowCredentials,
+		MaxAge:           cfg.CorsMaxAge,
+	}
+}
+
+// rateLimits are no limits when rate limiting is disabled.
+func rateLimits(cfg *config.AppConfig, l *zap.Logger) middleware.RateLimits {
+	if !cfg.RateLimitEnabled {
+		return middleware.RateLimits{}
+	}
+	def, routes, err := cfg.GetRateLimits()
+	if err != nil {
+		l.Error("rate limits error, requests are not limited", zap.Error(err))
+		return middleware.RateLimits{}
+	}
+	return middleware.RateLimits{Default: def, Routes: routes}
+}
+
+func logMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Println(fmt.Sprintf("Method: %s, path: %s", r.Method, r.RequestURI))
 		next.ServeHTTP(w, r)
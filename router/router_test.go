@@ -0,0 +1,678 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"playground/rest-api/gomasters/config"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/repository/memory"
+	memoryAuditRepo "playground/rest-api/gomasters/repository/memory/audit"
+	memoryIdempotencyRepo "playground/rest-api/gomasters/repository/memory/idempotency"
+	memoryRateLimit "playground/rest-api/gomasters/repository/memory/ratelimit"
+	memoryUserRepo "playground/rest-api/gomasters/repository/memory/user"
+	memoryVersionRepo "playground/rest-api/gomasters/repository/memory/version"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return newTestServerWithConfig(t, &config.AppConfig{BatchAtomic: true, BatchMaxSize: 100, BatchMaxBytes: 1 << 20, IdempotencyTTL: time.Hour, IdempotencyLease: time.Minute})
+}
+
+func newTestServerWithConfig(t *testing.T, cfg *config.AppConfig) *httptest.Server {
+	repo, audits, versions := memoryUserRepo.NewRepository(), memoryAuditRepo.NewRepository(), memoryVersionRepo.NewRepository()
+	server := httptest.NewServer(NewRouter(repo, audits, versions, memoryIdempotencyRepo.NewRepository(),
+		memoryRateLimit.NewStore(), memory.NewTxManager(repo, audits, versions), config.NewReloader(zap.NewNop(), cfg, nil), zap.NewAtomicLevel(), zap.NewNop()))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func do(t *testing.T, method, url, body string, out interface{}) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.Nil(t, err)
+
+	return send(t, req, out)
+}
+
+func send(t *testing.T, req *http.Request, out interface{}) *http.Response {
+	res, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	if out != nil {
+		assert.Nil(t, json.Unmarshal(data, out), string(data))
+	}
+	return res
+}
+
+func TestRouter_UserLifecycle(t *testing.T) {
+	server := newTestServer(t)
+	usersUrl := server.URL + "/users"
+
+	var msg string
+	do(t, http.MethodPost, usersUrl, `{"Firstname": "NewUser", "Lastname": "NewUserLastname", "Email": "newuser@gmail.com", "Age": 30}`, &msg)
+	assert.Contains(t, msg, "created successfully!")
+
+	do(t, http.MethodPost, usersUrl, `{"Firstname": "NewUser100", "Lastname": "NewUserLastname", "Email": "newuser2@gmail.com", "Age": 30}`, &msg)
+	assert.EqualValues(t, "create user error", msg)
+
+	var users []*entity.User
+	do(t, http.MethodGet, usersUrl, "", &users)
+	if !assert.Len(t, users, 1) {
+		return
+	}
+	userUrl := usersUrl + "/" + users[0].ID
+
+	var user entity.User
+	do(t, http.MethodGet, userUrl, "", &user)
+	assert.EqualValues(t, "newuser@gmail.com", user.Email)
+
+	do(t, http.MethodPut, userUrl, `{"Firstname": "NewUserUPD"}`, &msg)
+	assert.Contains(t, msg, "updated successfully!")
+	do(t, http.MethodGet, userUrl, "", &user)
+	assert.EqualValues(t, "NewUserUPD", user.Firstname)
+	assert.EqualValues(t, 30, user.Age)
+
+	do(t, http.MethodDelete, userUrl, "", &msg)
+	assert.Contains(t, msg, "deleted successfully!")
+	do(t, http.MethodGet, userUrl, "", &msg)
+	assert.EqualValues(t, "get by id error", msg)
+}
+
+func TestRouter_BatchAndExport(t *testing.T) {
+	server := newTestServer(t)
+	usersUrl := server.URL + "/users"
+
+	var results []*entity.BatchResult
+	do(t, http.MethodPost, usersUrl+"/batch?atomic=false", `[
+		{"Op": "create", "User": {"Firstname": "FirstUser", "Lastname": "LastNameA", "Email": "user1@gmail.com", "Age": 20}},
+		{"Op": "create", "User": {"Firstname": "SecondUser", "Lastname": "LastNameB", "Email": "user1@gmail.com", "Age": 21}},
+		{"Op": "delete", "ID": "1d2ef152-f440-4be2-b659-46cc6dcbc966"}
+	]`, &results)
+	if !assert.Len(t, results, 3) {
+		return
+	}
+	assert.EqualValues(t, "", results[0].Error)
+	assert.EqualValues(t, "create error: duplicate email", results[1].Error)
+	assert.EqualValues(t, "no row found to delete", results[2].Error)
+
+	req, _ := http.NewRequest(http.MethodGet, usersUrl+"/export", nil)
+	req.Header.Set("Accept", "text/csv")
+	res, err := http.DefaultClient.Do(req)
+	if !assert.Nil(t, err) {
+		return
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer res.Body.Close()
+
+	var body bytes.Buffer
+	_, _ = body.ReadFrom(res.Body)
+	assert.EqualValues(t, "text/csv", res.Header.Get("Content-Type"))
+	assert.Contains(t, body.String(), "ID,Firstname,Lastname,Email,Age,Created\n")
+	assert.Contains(t, body.String(), ",FirstUser,LastNameA,user1@gmail.com,20,")
+}
+
+func TestRouter_BatchErrors(t *testing.T) {
+	server := newTestServerWithConfig(t, &config.AppConfig{BatchAtomic: true, BatchMaxSize: 2, BatchMaxBytes: 512, IdempotencyTTL: time.Hour, IdempotencyLease: time.Minute})
+	batchUrl := server.URL + "/users/batch"
+
+	var results []*entity.BatchResult
+	res := do(t, http.MethodPost, batchUrl, `[
+		{"Op": "create", "User": {"Firstname": "FirstUser", "Lastname": "LastNameA", "Email": "user1@gmail.com", "Age": 20}}
+	]`, &results)
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+	if !assert.Len(t, results, 1) {
+		return
+	}
+	userId := results[0].ID
+
+	// The update is decoded on top of the stored user, the duplicate email rolls it back.
+	res = do(t, http.MethodPost, batchUrl, `[
+		{"Op": "update", "ID": "`+userId+`", "User": {"Age": 21}},
+		{"Op": "create", "User": {"Firstname": "SecondUser", "Lastname": "LastNameB", "Email": "user1@gmail.com", "Age": 21}}
+	]`, &results)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, res.StatusCode)
+	if assert.Len(t, results, 2) {
+		assert.EqualValues(t, "rolled back", results[0].Error)
+		assert.EqualValues(t, "create error: duplicate email", results[1].Error)
+	}
+
+	var user entity.User
+	do(t, http.MethodGet, server.URL+"/users/"+userId, "", &user)
+	assert.EqualValues(t, 20, user.Age)
+
+	tc := []struct {
+		name string
+		body string
+	}{
+		{name: "too many operations", body: `[{"Op": "delete"}, {"Op": "delete"}, {"Op": "delete"}]`},
+		{name: "too many bytes", body: `[{"Op": "delete", "ID": "` + strings.Repeat("x", 600) + `"}]`},
+	}
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			res := do(t, http.MethodPost, batchUrl, test.body, nil)
+			assert.EqualValues(t, http.StatusRequestEntityTooLarge, res.StatusCode)
+		})
+	}
+}
+
+func TestRouter_BatchFormats(t *testing.T) {
+	server := newTestServer(t)
+	usersUrl := server.URL + "/users"
+
+	post := func(url, contentType, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return send(t, req, nil)
+	}
+
+	res := post(usersUrl+"/batch", "application/xml", `<?xml version="1.0"?><Response>
+		<Operation><Op>create</Op><User><Firstname>FirstUser</Firstname><Lastname>LastNameA</Lastname><Email>user1@gmail.com</Email><Age>20</Age></User></Operation>
+	</Response>`)
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+
+	var users []*entity.User
+	do(t, http.MethodGet, usersUrl, "", &users)
+	if !assert.Len(t, users, 1) {
+		return
+	}
+
+	// Fields the update does not set keep their stored values.
+	res = post(usersUrl+"/batch", "application/yaml", "- op: update\n  id: "+users[0].ID+"\n  user:\n    age: 21\n")
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+	var user entity.User
+	do(t, http.MethodGet, usersUrl+"/"+users[0].ID, "", &user)
+	assert.EqualValues(t, 21, user.Age)
+	assert.EqualValues(t, "FirstUser", user.Firstname)
+
+	res = post(usersUrl+"/batch", "text/plain", "[]")
+	assert.EqualValues(t, http.StatusUnsupportedMediaType, res.StatusCode)
+	res = post(usersUrl+"/import", "application/pdf", "")
+	assert.EqualValues(t, http.StatusUnsupportedMediaType, res.StatusCode)
+
+	req, _ := http.NewRequest(http.MethodPost, usersUrl+"/import", strings.NewReader(""))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Accept", "text/html")
+	var msg string
+	res = send(t, req, &msg)
+	assert.EqualValues(t, http.StatusNotAcceptable, res.StatusCode)
+	assert.Contains(t, msg, "not acceptable")
+}
+
+func TestRouter_History(t *testing.T) {
+	server := newTestServer(t)
+	usersUrl := server.URL + "/users"
+
+	var msg string
+	req, _ := http.NewRequest(http.MethodPost, usersUrl, strings.NewReader(
+		`{"Firstname": "NewUser", "Lastname": "NewUserLastname", "Email": "newuser@gmail.com", "Age": 30}`))
+	req.Header.Set("X-Actor", "alice")
+	req.Header.Set("X-Request-ID", "req-create")
+	res := send(t, req, &msg)
+	assert.EqualValues(t, "req-create", res.Header.Get("X-Request-ID"))
+
+	var users []*entity.User
+	do(t, http.MethodGet, usersUrl, "", &users)
+	if !assert.Len(t, users, 1) {
+		return
+	}
+	userUrl := usersUrl + "/" + users[0].ID
+
+	req, _ = http.NewRequest(http.MethodPut, userUrl, strings.NewReader(`{"Email": "changed@gmail.com"}`))
+	req.Header.Set("X-Actor", "bob")
+	res = send(t, req, &msg)
+	assert.Contains(t, msg, "updated successfully!")
+	assert.NotEmpty(t, res.Header.Get("X-Request-ID"), "generated request ID")
+
+	var history []*entity.AuditRecord
+	do(t, http.MethodGet, userUrl+"/history", "", &history)
+	if !assert.Len(t, history, 2) {
+		return
+	}
+	assert.EqualValues(t, entity.AuditCreate, history[0].Action)
+	assert.EqualValues(t, "alice", history[0].Actor)
+	assert.EqualValues(t, "req-create", history[0].RequestID)
+
+	assert.EqualValues(t, entity.AuditUpdate, history[1].Action)
+	assert.EqualValues(t, "bob", history[1].Actor)
+	assert.EqualValues(t, res.Header.Get("X-Request-ID"), history[1].RequestID)
+	assert.EqualValues(t, []*entity.FieldChange{
+		{Field: "Email", Before: "newuser@gmail.com", After: "changed@gmail.com"},
+	}, history[1].Changes)
+}
+
+func TestRouter_AsOfAndRevert(t *testing.T) {
+	server := newTestServer(t)
+	usersUrl := server.URL + "/users"
+
+	var msg string
+	do(t, http.MethodPost, usersUrl, `{"Firstname": "NewUser", "Lastname": "NewUserLastname", "Email": "newuser@gmail.com", "Age": 30}`, &msg)
+
+	var users []*entity.User
+	do(t, http.MethodGet, usersUrl, "", &users)
+	if !assert.Len(t, users, 1) {
+		return
+	}
+	userUrl := usersUrl + "/" + users[0].ID
+
+	do(t, http.MethodPut, userUrl, `{"Age": 31}`, &msg)
+	do(t, http.MethodDelete, userUrl, "", &msg)
+
+	var versions []*entity.UserVersion
+	do(t, http.MethodGet, userUrl+"/versions", "", &versions)
+	if !assert.Len(t, versions, 2) {
+		return
+	}
+	assert.EqualValues(t, 30, versions[0].User.Age)
+	assert.EqualValues(t, 31, versions[1].User.Age)
+	assert.NotNil(t, versions[1].ValidTo, "closed by the delete")
+
+	var user entity.User
+	do(t, http.MethodGet, userUrl+"?as_of="+versions[0].ValidFrom.Format(time.RFC3339Nano), "", &user)
+	assert.EqualValues(t, 30, user.Age)
+	do(t, http.MethodGet, userUrl+"?as_of="+versions[1].ValidTo.Format(time.RFC3339Nano), "", &msg)
+	assert.EqualValues(t, "get as of error", msg)
+	do(t, http.MethodGet, userUrl+"?as_of=yesterday", "", &msg)
+	assert.EqualValues(t, "as_of parameter error", msg)
+
+	// The deleted user is created again with the state of version 1.
+	do(t, http.MethodPost, userUrl+"/revert?version=1", "", &msg)
+	assert.Contains(t, msg, "reverted to version 1 successfully!")
+	do(t, http.MethodGet, userUrl, "", &user)
+	assert.EqualValues(t, 30, user.Age)
+
+	do(t, http.MethodPost, userUrl+"/revert?version=9", "", &msg)
+	assert.EqualValues(t, "revert error", msg)
+	do(t, http.MethodPost, userUrl+"/revert?version=first", "", &msg)
+	assert.EqualValues(t, "version parameter error", msg)
+
+	do(t, http.MethodGet, userUrl+"/versions", "", &versions)
+	assert.Len(t, versions, 3)
+}
+
+func TestRouter_Conflict(t *testing.T) {
+	server := newTestServer(t)
+	usersUrl := server.URL + "/users"
+
+	var msg string
+	do(t, http.MethodPost, usersUrl, `{"Firstname": "NewUser", "Lastname": "NewUserLastname", "Email": "newuser@gmail.com", "Age": 30}`, &msg)
+	assert.Contains(t, msg, "created successfully!")
+
+	// The email is normalized before the unique check.
+	var conflict struct {
+		Error string
+		Field string
+	}
+	res := do(t, http.MethodPost, usersUrl, `{"Firstname": "OtherUser", "Lastname": "OtherLastname", "Email": " NewUser@Gmail.com ", "Age": 31}`, &conflict)
+	assert.EqualValues(t, http.StatusConflict, res.StatusCode)
+	assert.EqualValues(t, "Email", conflict.Field)
+	assert.EqualValues(t, "duplicate email", conflict.Error)
+
+	do(t, http.MethodPost, usersUrl, `{"Firstname": "OtherUser", "Lastname": "OtherLastname", "Email": "other@gmail.com", "Age": 31}`, &msg)
+	var users []*entity.User
+	do(t, http.MethodGet, usersUrl, "", &users)
+	if !assert.Len(t, users, 2) {
+		return
+	}
+	other := users[0]
+	if other.Email != "other@gmail.com" {
+		other = users[1]
+	}
+
+	res = do(t, http.MethodPut, usersUrl+"/"+other.ID, `{"Email": "NEWUSER@gmail.com"}`, &conflict)
+	assert.EqualValues(t, http.StatusConflict, res.StatusCode)
+	assert.EqualValues(t, "Email", conflict.Field)
+}
+
+func TestRouter_Idempotency(t *testing.T) {
+	server := newTestServer(t)
+	usersUrl := server.URL + "/users"
+	body := `{"Firstname": "NewUser", "Lastname": "NewUserLastname", "Email": "newuser@gmail.com", "Age": 30}`
+
+	post := func(key, actor, body string, out interface{}) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, usersUrl, strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		req.Header.Set("X-Actor", actor)
+		return send(t, req, out)
+	}
+
+	var first, retry string
+	res := post("key-1", "alice", body, &first)
+	assert.Contains(t, first, "created successfully!")
+	assert.Empty(t, res.Header.Get("Idempotent-Replayed"))
+
+	res = post("key-1", "alice", body, &retry)
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+	assert.EqualValues(t, "true", res.Header.Get("Idempotent-Replayed"))
+	assert.EqualValues(t, first, retry, "the stored response")
+
+	var mismatch string
+	res = post("key-1", "alice", strings.Replace(body, "30", "31", 1), &mismatch)
+	assert.EqualValues(t, http.StatusUnprocessableEntity, res.StatusCode)
+	assert.EqualValues(t, "application/json", res.Header.Get("Content-Type"), "the error format of the handlers")
+	assert.EqualValues(t, "idempotency key reused with a different request", mismatch)
+
+	// The caller is the client, not X-Actor: another actor gets the stored response.
+	res = post("key-1", "bob", body, nil)
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+	assert.EqualValues(t, "true", res.Header.Get("Idempotent-Replayed"))
+
+	var users []*entity.User
+	do(t, http.MethodGet, usersUrl, "", &users)
+	assert.Len(t, users, 1)
+}
+
+func TestRouter_IdempotencyBody(t *testing.T) {
+	server := newTestServerWithConfig(t, &config.AppConfig{
+		IdempotencyTTL:      time.Hour,
+		IdempotencyLease:    time.Minute,
+		IdempotencyMaxBytes: 256,
+	})
+	usersUrl := server.URL + "/users"
+
+	type expected struct {
+		Status int
+	}
+
+	type payload struct {
+		Url         string
+		ContentType string
+		Body        string
+	}
+
+	user := `{"Firstname": "NewUser", "Lastname": "NewUserLastname", "Email": "newuser@gmail.com", "Age": 30}`
+	csv := "Firstname,Lastname,Email,Age\n" + strings.Repeat("NewUser,NewUserLastname,newuser@gmail.com,30\n", 10)
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "body within the limit",
+			expected: expected{Status: http.StatusOK},
+			payload:  payload{Url: usersUrl, ContentType: "application/json", Body: user},
+		},
+		{
+			name:     "body over the limit",
+			expected: expected{Status: http.StatusRequestEntityTooLarge},
+			payload:  payload{Url: usersUrl, ContentType: "application/json", Body: user + strings.Repeat(" ", 256)},
+		},
+		{
+			name:     "import is streamed past the limit",
+			expected: expected{Status: http.StatusOK},
+			payload:  payload{Url: usersUrl + "/import", ContentType: "text/csv", Body: csv},
+		},
+	}
+
+	for i, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, test.payload.Url, strings.NewReader(test.payload.Body))
+			req.Header.Set("Content-Type", test.payload.ContentType)
+			req.Header.Set("Idempotency-Key", "key-"+strconv.Itoa(i))
+			res := send(t, req, nil)
+
+			assert.EqualValues(t, test.expected.Status, res.StatusCode)
+		})
+	}
+}
+
+func TestRouter_RateLimit(t *testing.T) {
+	server := newTestServerWithConfig(t, &config.AppConfig{
+		IdempotencyTTL:   time.Hour,
+		IdempotencyLease: time.Minute,
+		RateLimitEnabled: true,
+		RateLimitDefault: "3/1h",
+		RateLimits:       map[string]string{"GET /users/{id}": "1/1h"},
+		APIKeys:          []string{"key-1"},
+	})
+	usersUrl := server.URL + "/users"
+
+	get := func(url, apiKey string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		return send(t, req, nil)
+	}
+
+	for i := 2; i >= 0; i-- {
+		res := get(usersUrl, "")
+		assert.EqualValues(t, http.StatusOK, res.StatusCode)
+		assert.EqualValues(t, "3", res.Header.Get("X-RateLimit-Limit"))
+		assert.EqualValues(t, strconv.Itoa(i), res.Header.Get("X-RateLimit-Remaining"))
+	}
+
+	res := get(usersUrl, "")
+	assert.EqualValues(t, http.StatusTooManyRequests, res.StatusCode)
+	assert.EqualValues(t, "1200", res.Header.Get("Retry-After"), "a token every 20 minutes")
+	assert.EqualValues(t, "3600", res.Header.Get("X-RateLimit-Reset"))
+
+	// Other clients and routes have their own buckets.
+	res = get(usersUrl, "key-1")
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+
+	userUrl := usersUrl + "/1d2ef152-f440-4be2-b659-46cc6dcbc966"
+	res = get(userUrl, "")
+	assert.EqualValues(t, "1", res.Header.Get("X-RateLimit-Limit"))
+	assert.EqualValues(t, "0", res.Header.Get("X-RateLimit-Remaining"))
+	res = get(userUrl, "")
+	assert.EqualValues(t, http.StatusTooManyRequests, res.StatusCode)
+}
+
+func TestRouter_RateLimitClient(t *testing.T) {
+	type payload struct {
+		Header string
+		Values []string
+	}
+
+	tc := []struct {
+		name     string
+		expected int
+		payload  payload
+	}{
+		{
+			name:     "rotating unknown api keys",
+			expected: http.StatusTooManyRequests,
+			payload:  payload{Header: "X-API-Key", Values: []string{"a", "b", "c"}},
+		},
+		{
+			name:     "rotating actors",
+			expected: http.StatusTooManyRequests,
+			payload:  payload{Header: "X-Actor", Values: []string{"alice", "bob", "carol"}},
+		},
+		{
+			name:     "known api keys",
+			expected: http.StatusOK,
+			payload:  payload{Header: "X-API-Key", Values: []string{"key-1", "key-2", "key-1"}},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServerWithConfig(t, &config.AppConfig{
+				IdempotencyTTL:   time.Hour,
+				IdempotencyLease: time.Minute,
+				RateLimitEnabled: true,
+				RateLimitDefault: "2/1h",
+				APIKeys:          []string{"key-1", "key-2"},
+			})
+
+			var res *http.Response
+			for _, value := range test.payload.Values {
+				req, _ := http.NewRequest(http.MethodGet, server.URL+"/users", nil)
+				req.Header.Set(test.payload.Header, value)
+				res = send(t, req, nil)
+			}
+
+			assert.EqualValues(t, test.expected, res.StatusCode, "the third request")
+		})
+	}
+}
+
+func TestRouter_CORS(t *testing.T) {
+	server := newTestServerWithConfig(t, &config.AppConfig{
+		IdempotencyTTL:       time.Hour,
+		IdempotencyLease:     time.Minute,
+		CorsAllowedOrigins:   []string{"https://*.example.com"},
+		CorsAllowedMethods:   []string{"GET", "POST", "PUT"},
+		CorsAllowedHeaders:   []string{"Content-Type", "X-Actor"},
+		CorsExposedHeaders:   []string{"ETag"},
+		CorsAllowCredentials: true,
+		CorsMaxAge:           10 * time.Minute,
+	})
+	usersUrl := server.URL + "/users"
+	userUrl := usersUrl + "/1d2ef152-f440-4be2-b659-46cc6dcbc966"
+
+	request := func(method, url, origin, requestMethod string) *http.Response {
+		req, _ := http.NewRequest(method, url, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		return send(t, req, nil)
+	}
+
+	res := request(http.MethodOptions, userUrl, "https://admin.example.com", http.MethodPut)
+	assert.EqualValues(t, http.StatusNoContent, res.StatusCode)
+	assert.EqualValues(t, "https://admin.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.EqualValues(t, "true", res.Header.Get("Access-Control-Allow-Credentials"))
+	assert.EqualValues(t, "GET, PUT", res.Header.Get("Access-Control-Allow-Methods"), "DELETE is not allowed by the config")
+	assert.EqualValues(t, "Content-Type, X-Actor", res.Header.Get("Access-Control-Allow-Headers"))
+	assert.EqualValues(t, "600", res.Header.Get("Access-Control-Max-Age"))
+
+	res = request(http.MethodOptions, usersUrl+"/unknown/path", "https://admin.example.com", http.MethodGet)
+	assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+
+	res = request(http.MethodGet, usersUrl, "https://admin.example.com", "")
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+	assert.EqualValues(t, "https://admin.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.EqualValues(t, "ETag", res.Header.Get("Access-Control-Expose-Headers"))
+
+	// Other origins get no CORS headers, plain OPTIONS lists the methods of the route.
+	res = request(http.MethodOptions, userUrl, "https://example.org", http.MethodPut)
+	assert.EqualValues(t, http.StatusNoContent, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+	assert.EqualValues(t, "GET, PUT, DELETE, OPTIONS", res.Header.Get("Allow"))
+
+	res = request(http.MethodOptions, usersUrl, "", "")
+	assert.EqualValues(t, "GET, POST, OPTIONS", res.Header.Get("Allow"))
+}
+
+func TestRouter_NotFound(t *testing.T) {
+	server := newTestServer(t)
+
+	res := do(t, http.MethodGet, server.URL+"/unknown", "", nil)
+	assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+	res = do(t, http.MethodPatch, server.URL+"/users", "", nil)
+	assert.EqualValues(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestRouter_AdminLogLevel(t *testing.T) {
+	server := newTestServerWithConfig(t, &config.AppConfig{IdempotencyTTL: time.Hour, IdempotencyLease: time.Minute, AdminToken: "s3cret"})
+	levelUrl := server.URL + "/admin/log/level"
+
+	admin := func(method, token, body string, out interface{}) *http.Response {
+		req, _ := http.NewRequest(method, levelUrl, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return send(t, req, out)
+	}
+
+	res := admin(http.MethodGet, "", "", nil)
+	assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+	res = admin(http.MethodPut, "wrong", `{"level":"debug"}`, nil)
+	assert.EqualValues(t, http.StatusUnauthorized, res.StatusCode)
+
+	var level struct{ Level string }
+	res = admin(http.MethodGet, "s3cret", "", &level)
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+	assert.EqualValues(t, "info", level.Level)
+
+	res = admin(http.MethodPut, "s3cret", `{"level":"debug"}`, &level)
+	assert.EqualValues(t, http.StatusOK, res.StatusCode)
+	admin(http.MethodGet, "s3cret", "", &level)
+	assert.EqualValues(t, "debug", level.Level)
+
+	res = admin(http.MethodPut, "s3cret", `{"level":"loud"}`, nil)
+	assert.EqualValues(t, http.StatusBadRequest, res.StatusCode)
+
+	// Without a token the admin routes do not exist.
+	res = do(t, http.MethodGet, newTestServer(t).URL+"/admin/log/level", "", nil)
+	assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestRouter_DebugVars(t *testing.T) {
+	server := newTestServerWithConfig(t, &config.AppConfig{IdempotencyTTL: time.Hour, IdempotencyLease: time.Minute, AdminToken: "s3cret"})
+
+	type expected struct {
+		Status int
+	}
+
+	type payload struct {
+		Token string
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "without a token",
+			expected: expected{Status: http.StatusUnauthorized},
+			payload:  payload{},
+		},
+		{
+			name:     "wrong token",
+			expected: expected{Status: http.StatusUnauthorized},
+			payload:  payload{Token: "wrong"},
+		},
+		{
+			name:     "admin token",
+			expected: expected{Status: http.StatusOK},
+			payload:  payload{Token: "s3cret"},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/debug/vars", nil)
+			if test.payload.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.payload.Token)
+			}
+
+			var vars map[string]interface{}
+			var out interface{}
+			if test.expected.Status == http.StatusOK {
+				out = &vars
+			}
+			res := send(t, req, out)
+
+			assert.EqualValues(t, test.expected.Status, res.StatusCode)
+			if test.expected.Status == http.StatusOK {
+				assert.Contains(t, vars, "memstats")
+				assert.NotContains(t, vars, "cmdline")
+			}
+		})
+	}
+
+	// Without a token the route does not exist.
+	res := do(t, http.MethodGet, newTestServer(t).URL+"/debug/vars", "", nil)
+	assert.EqualValues(t, http.StatusNotFound, res.StatusCode)
+}
@@ -0,0 +1,64 @@
+// Package seeder generates realistic fake users for development databases.
+package seeder
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"math/rand"
+	"playground/rest-api/gomasters/entity"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	firstnames = []string{
+		"Olivia", "Liam", "Emma", "Noah", "Amelia", "Oliver", "Sophia", "Elijah", "Charlotte", "James",
+		"Isabella", "William", "Mia", "Benjamin", "Evelyn", "Lucas", "Harper", "Henry", "Luna", "Theodore",
+		"Camila", "Mateo", "Gianna", "Levi", "Elizabeth", "Sebastian", "Eleanor", "Daniel", "Ella", "Jack",
+		"Abigail", "Michael", "Sofia", "Alexander", "Avery", "Owen", "Scarlett", "Asher", "Emily", "Samuel",
+		"Aria", "Ethan", "Penelope", "Leo", "Chloe", "Jackson", "Layla", "Mason", "Mila", "Ezra",
+	}
+	lastnames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+		"Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin",
+		"Lee", "Perez", "Thompson", "White", "Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson",
+		"Walker", "Young", "Allen", "King", "Wright", "Scott", "Torres", "Nguyen", "Hill", "Flores",
+		"Green", "Adams", "Nelson", "Baker", "Hall", "Rivera", "Campbell", "Mitchell", "Carter", "Roberts",
+	}
+	domains = []string{"gmail.com", "yahoo.com", "outlook.com", "icloud.com", "proton.me", "example.com"}
+)
+
+// Users returns n users with valid names, emails, ages and creation dates of
+// the last three years. The same rnd seed gives the same users; emails are
+// unique among them, but may exist in the database already.
+func Users(rnd *rand.Rand, n int) []*entity.User {
+	now := time.Now().UTC()
+	users := make([]*entity.User, n)
+	for i := range users {
+		first, last := firstnames[rnd.Intn(len(firstnames))], lastnames[rnd.Intn(len(lastnames))]
+		id, err := uuid.NewRandomFromReader(rnd)
+		if err != nil {
+			// A math/rand source never fails.
+			panic(err)
+		}
+
+		users[i] = &entity.User{
+			ID:        id.String(),
+			Firstname: first,
+			Lastname:  last,
+			Email:     email(rnd, i, first, last),
+			Age:       18 + rnd.Intn(63),
+			Created:   now.AddDate(0, 0, -rnd.Intn(3*365)).Truncate(24 * time.Hour),
+		}
+	}
+	return users
+}
+
+// email makes the address unique among the users with the index i and
+// likely unique across runs with a random part, in base 36 so that it fits
+// the 40 characters of the email column.
+func email(rnd *rand.Rand, i int, first, last string) string {
+	suffix := strconv.FormatInt(int64(i)*10000+int64(rnd.Intn(10000)), 36)
+	return fmt.Sprintf("%s.%s%s@%s", strings.ToLower(first), strings.ToLower(last), suffix, domains[rnd.Intn(len(domains))])
+}
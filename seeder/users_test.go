@@ -0,0 +1,26 @@
+package seeder
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestUsers(t *testing.T) {
+	users := Users(rand.New(rand.NewSource(1)), 1000)
+	assert.Len(t, users, 1000)
+
+	v := validator.New()
+	emails := make(map[string]bool, len(users))
+	for _, u := range users {
+		assert.Nil(t, v.Struct(u), u.Email)
+		assert.LessOrEqual(t, len(u.Email), 40, u.Email)
+		assert.False(t, emails[u.Email], "duplicate email %s", u.Email)
+		emails[u.Email] = true
+	}
+
+	again := Users(rand.New(rand.NewSource(1)), 1000)
+	assert.EqualValues(t, users[999].ID, again[999].ID, "same seed, same users")
+	assert.EqualValues(t, users[999].Email, again[999].Email)
+}
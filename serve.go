@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"playground/rest-api/gomasters/config"
+	"playground/rest-api/gomasters/publisher"
+	cacheUserRepo "playground/rest-api/gomasters/repository/cache/user"
+	memoryRateLimit "playground/rest-api/gomasters/repository/memory/ratelimit"
+	outboxRepo "playground/rest-api/gomasters/repository/postgres/outbox"
+	"playground/rest-api/gomasters/router"
+	"playground/rest-api/gomasters/tlsconfig"
+	idempotencyUsecase "playground/rest-api/gomasters/usecase/idempotency"
+	outboxUsecase "playground/rest-api/gomasters/usecase/outbox"
+)
+
+// serve runs the HTTP server until it fails. The log level is changed by
+// reloads and on /admin/log/level.
+func serve(reloader *config.Reloader, level zap.AtomicLevel, logger *zap.Logger) error {
+	cfg := reloader.Current()
+	s, err := openStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	if s.outbox != nil {
+		startRelay(s.outbox, cfg, logger)
+	}
+	if cfg.CacheEnabled {
+		cached := cacheUserRepo.NewRepository(s.users, cacheUserRepo.Options{Size: cfg.CacheSize, TTL: cfg.CacheTTL, InTx: s.inTx})
+		expvar.Publish("user_cache", expvar.Func(func() interface{} { return cached.Stats() }))
+		s.users, s.tm = cached, cached.WrapTxManager(s.tm)
+		logger.Info("User cache OK", zap.Int("size", cfg.CacheSize), zap.Duration("ttl", cfg.CacheTTL))
+	}
+
+	startIdempotencyPurge(s.idempotency, cfg, logger)
+	r := router.NewRouter(s.users, s.audits, s.versions, s.idempotency, memoryRateLimit.NewStore(), s.tm, reloader, level, logger)
+	go reloader.Run(context.Background(), cfg.ConfigWatchInterval)
+
+	server := &http.Server{
+		Addr:    cfg.AppAddr,
+		Handler: r,
+	}
+	if cfg.TLSEnabled() {
+		certs, err := tlsconfig.NewReloader(logger, tlsconfig.Options{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCAFile,
+			ClientAuth:   cfg.TLSClientAuth,
+		})
+		if err != nil {
+			return fmt.Errorf("tls config error: %v", err)
+		}
+		go certs.Run(context.Background(), cfg.TLSReloadInterval)
+		server.TLSConfig = certs.TLSConfig()
+
+		logger.Info("Start https server", zap.String("server", cfg.AppAddr), zap.Bool("mtls", cfg.TLSClientCAFile != ""))
+		return server.ListenAndServeTLS("", "")
+	}
+	logger.Info("Start http server", zap.String("server", cfg.AppAddr))
+	return server.ListenAndServe()
+}
+
+func startRelay(db *sql.DB, cfg *config.AppConfig, logger *zap.Logger) {
+	relay := outboxUsecase.NewRelay(logger, outboxRepo.NewRepository(db), publisher.NewLogPublisher(logger),
+		cfg.OutboxInterval, cfg.OutboxBatchSize)
+	go relay.Run(context.Background())
+	logger.Info("Outbox relay started")
+}
+
+func startIdempotencyPurge(repo idempotencyUsecase.Repository, cfg *config.AppConfig, logger *zap.Logger) {
+	uc := idempotencyUsecase.NewUsecase(logger, repo, cfg.IdempotencyTTL, cfg.IdempotencyLease)
+	go uc.Run(context.Background(), cfg.IdempotencyPurgeInterval)
+	logger.Info("Idempotency key purge started")
+}
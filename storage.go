@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4/stdlib"
+	"go.uber.org/zap"
+	"playground/rest-api/gomasters/config"
+	"playground/rest-api/gomasters/repository/memory"
+	memoryAuditRepo "playground/rest-api/gomasters/repository/memory/audit"
+	memoryIdempotencyRepo "playground/rest-api/gomasters/repository/memory/idempotency"
+	memoryUserRepo "playground/rest-api/gomasters/repository/memory/user"
+	memoryVersionRepo "playground/rest-api/gomasters/repository/memory/version"
+	"playground/rest-api/gomasters/repository/migrate"
+	pgxRepo "playground/rest-api/gomasters/repository/pgx"
+	pgxAuditRepo "playground/rest-api/gomasters/repository/pgx/audit"
+	pgxUserRepo "playground/rest-api/gomasters/repository/pgx/user"
+	pgxVersionRepo "playground/rest-api/gomasters/repository/pgx/version"
+	"playground/rest-api/gomasters/repository/postgres"
+	auditRepo "playground/rest-api/gomasters/repository/postgres/audit"
+	idempotencyRepo "playground/rest-api/gomasters/repository/postgres/idempotency"
+	userRepo "playground/rest-api/gomasters/repository/postgres/user"
+	versionRepo "playground/rest-api/gomasters/repository/postgres/version"
+	"playground/rest-api/gomasters/repository/sqlite"
+	sqliteAuditRepo "playground/rest-api/gomasters/repository/sqlite/audit"
+	sqliteIdempotencyRepo "playground/rest-api/gomasters/repository/sqlite/idempotency"
+	sqliteUserRepo "playground/rest-api/gomasters/repository/sqlite/user"
+	sqliteVersionRepo "playground/rest-api/gomasters/repository/sqlite/version"
+	"playground/rest-api/gomasters/repository/sqltx"
+	idempotencyUsecase "playground/rest-api/gomasters/usecase/idempotency"
+	userUsecase "playground/rest-api/gomasters/usecase/user"
+)
+
+// storage holds the repositories of DB_DRIVER, shared by serve and the other commands.
+type storage struct {
+	users       userUsecase.Repository
+	audits      userUsecase.AuditRepository
+	versions    userUsecase.VersionRepository
+	idempotency idempotencyUsecase.Repository
+	tm          userUsecase.TxManager
+	inTx        func(ctx context.Context) bool
+	// outbox is the database of the outbox relay, nil for drivers without outbox.
+	outbox  *sql.DB
+	closers []func()
+}
+
+func openStorage(cfg *config.AppConfig, logger *zap.Logger) (*storage, error) {
+	s := &storage{}
+	switch cfg.DbDriver {
+	case config.DriverMemory:
+		repo, audits, versions := memoryUserRepo.NewRepository(), memoryAuditRepo.NewRepository(), memoryVersionRepo.NewRepository()
+		s.users, s.audits, s.versions, s.tm = repo, audits, versions, memory.NewTxManager(repo, audits, versions)
+		s.idempotency, s.inTx = memoryIdempotencyRepo.NewRepository(), memory.InTx
+		logger.Warn("In-memory storage OK, it is for tests and development only: users are lost on exit " +
+			"and a failed transaction also drops the writes made meanwhile outside of it")
+	case config.DriverSQLite:
+		db, err := sqlite.Open(cfg.SqlitePath)
+		if err != nil {
+			return nil, err
+		}
+		s.onClose(func() { _ = db.Close() })
+		logger.Info("SQLite OK", zap.String("path", cfg.SqlitePath))
+
+		// SQLite transactions are always serializable.
+		s.users, s.audits = sqliteUserRepo.NewRepository(db), sqliteAuditRepo.NewRepository(db)
+		s.versions, s.idempotency = sqliteVersionRepo.NewRepository(db), sqliteIdempotencyRepo.NewRepository(db)
+		s.tm, s.inTx = sqltx.NewManager(db, sqltx.Options{}), sqltx.InTx
+	case config.DriverPgx:
+		pool, err := pgxRepo.NewPool(context.Background(), cfg.GetDbString(), pgxRepo.PoolOptions{
+			MaxConns:               cfg.PgPoolMaxConns,
+			MinConns:               cfg.PgPoolMinConns,
+			MaxConnLifetime:        cfg.PgPoolMaxConnLifetime,
+			MaxConnIdleTime:        cfg.PgPoolMaxConnIdleTime,
+			HealthCheckPeriod:      cfg.PgPoolHealthCheckPeriod,
+			StatementCacheCapacity: cfg.PgStatementCacheSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.onClose(pool.Close)
+		logger.Info("Db pool OK", zap.String("db", cfg.GetRedactedDbString()))
+
+		s.users, s.audits = pgxUserRepo.NewRepository(pool), pgxAuditRepo.NewRepository(pool)
+		s.versions = pgxVersionRepo.NewRepository(pool)
+		s.tm, s.inTx = pgxRepo.NewTxManager(pool, cfg.TxIsolation, cfg.TxMaxRetries), pgxRepo.InTx
+
+		// The relay works outside of user transactions, database/sql over the same config is enough.
+		db := stdlib.OpenDB(*pool.Config().ConnConfig)
+		s.onClose(func() { _ = db.Close() })
+		s.idempotency, s.outbox = idempotencyRepo.NewRepository(db), db
+	default:
+		db, err := openPostgres(cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.onClose(func() { _ = db.Close() })
+		logger.Info("Db OK", zap.String("db", cfg.GetRedactedDbString()))
+
+		isolation, err := sqltx.ParseIsolation(cfg.TxIsolation)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+
+		s.users, s.audits = userRepo.NewRepository(db), auditRepo.NewRepository(db)
+		s.versions, s.idempotency = versionRepo.NewRepository(db), idempotencyRepo.NewRepository(db)
+		s.tm, s.inTx = postgres.NewTxManager(db, isolation, cfg.TxMaxRetries), sqltx.InTx
+		s.outbox = db
+	}
+	return s, nil
+}
+
+// onClose registers fn to run on close, in reverse order of registration.
+func (s *storage) onClose(fn func()) {
+	s.closers = append(s.closers, fn)
+}
+
+func (s *storage) close() {
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		s.closers[i]()
+	}
+}
+
+func (s *storage) usecase() *userUsecase.Usecase {
+	return userUsecase.NewUsecase(s.users, s.audits, s.versions, s.tm)
+}
+
+func openPostgres(cfg *config.AppConfig) (*sql.DB, error) {
+	// https://github.com/jackc/pgx/blob/master/stdlib/sql.go
+	db, err := sql.Open("pgx", cfg.GetDbString())
+	if err != nil {
+		return nil, fmt.Errorf("open db error: %v", err)
+	}
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("ping db error: %v", err)
+	}
+	return db, nil
+}
+
+// openMigrations opens the database of DB_DRIVER without applying migrations,
+// and returns the migrations of its schema.
+func openMigrations(cfg *config.AppConfig) (*sql.DB, []migrate.Migration, error) {
+	var db *sql.DB
+	var ms []migrate.Migration
+	var err error
+	switch cfg.DbDriver {
+	case config.DriverMemory:
+		return nil, nil, errors.New("the memory driver has no schema to migrate")
+	case config.DriverSQLite:
+		if ms, err = sqlite.Migrations(); err == nil {
+			db, err = sqlite.Connect(cfg.SqlitePath)
+		}
+	default:
+		if ms, err = postgres.Migrations(); err == nil {
+			db, err = openPostgres(cfg)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, ms, nil
+}
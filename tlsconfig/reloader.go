@@ -0,0 +1,176 @@
+// Package tlsconfig builds the TLS configuration of the HTTP server from
+// certificate files and reloads them when they change on disk.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate modes of Options.ClientAuth.
+const (
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+type Options struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is the PEM bundle client certificates are verified
+	// against. Client certificates are not asked for without it.
+	ClientCAFile string
+	// ClientAuth is ClientAuthRequire or ClientAuthVerifyIfGiven.
+	ClientAuth string
+}
+
+// Reloader holds the server certificate and the client CA pool read from the
+// files of Options and swaps them when Run sees the files change. Handshakes
+// in progress keep the certificate they started with.
+type Reloader struct {
+	logger *zap.Logger
+	opts   Options
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewReloader reads the files once, so that a broken configuration fails at start.
+func NewReloader(l *zap.Logger, opts Options) (*Reloader, error) {
+	switch opts.ClientAuth {
+	case "", ClientAuthRequire, ClientAuthVerifyIfGiven:
+	default:
+		return nil, fmt.Errorf("unknown client auth %q", opts.ClientAuth)
+	}
+
+	r := &Reloader{logger: l, opts: opts}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the server configuration. Every handshake gets the
+// current certificate and client CA pool, and HTTP/2 is offered before
+// HTTP/1.1.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   []string{"h2", "http/1.1"},
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCA != nil {
+				cfg.ClientCAs = r.clientCA
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				if r.opts.ClientAuth == ClientAuthVerifyIfGiven {
+					cfg.ClientAuth = tls.VerifyClientCertIfGiven
+				}
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// Run checks the files every interval until ctx is done. A failed reload is
+// logged and the previous certificates stay in use.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.Reload()
+		if err != nil {
+			r.logger.Error("reload tls certificates error", zap.Error(err))
+			continue
+		}
+		if reloaded {
+			r.logger.Info("tls certificates reloaded")
+		}
+	}
+}
+
+// Reload reads the files again when one of them has been modified since the
+// last read, and tells whether it did.
+func (r *Reloader) Reload() (bool, error) {
+	modTimes, err := r.statFiles()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := !equalModTimes(r.modTimes, modTimes)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("load key pair error: %v", err)
+	}
+
+	var clientCA *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("read client CA error: %v", err)
+		}
+		clientCA = x509.NewCertPool()
+		if !clientCA.AppendCertsFromPEM(pem) {
+			return false, errors.New("client CA file has no PEM certificates")
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.clientCA, r.modTimes = &cert, clientCA, modTimes
+	r.mu.Unlock()
+	return true, nil
+}
+
+func (r *Reloader) statFiles() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time, 3)
+	for _, name := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("stat tls file error: %v", err)
+		}
+		modTimes[name] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func equalModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, t := range a {
+		if !b[name].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"playground/rest-api/gomasters/handler/middleware"
+	"playground/rest-api/gomasters/requestctx"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newCert issues a certificate for cn signed by parent, or a self-signed CA
+// without parent.
+func newCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tpl, key
+	if parent == nil {
+		tpl.IsCA, tpl.BasicConstraintsValid = true, true
+		tpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signer, &key.PublicKey, signerKey)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600))
+	if keyFile == "" {
+		return
+	}
+	key, err := x509.MarshalECPrivateKey(c.key)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0o600))
+}
+
+func (c *testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestReloader_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newCert(t, "test-ca", 1, nil)
+	ca.write(t, caFile, "")
+	newCert(t, "server-1", 2, ca).write(t, certFile, keyFile)
+
+	reloader, err := NewReloader(zap.NewNop(), Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	require.Nil(t, err)
+
+	server := httptest.NewUnstartedServer(middleware.RequestContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto + " " + requestctx.ClientCN(r.Context())))
+	})))
+	server.TLS = reloader.TLSConfig()
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certs},
+			ForceAttemptHTTP2: true,
+		}}
+	}
+	get := func(c *http.Client) (string, *tls.ConnectionState, error) {
+		res, err := c.Get(server.URL)
+		if err != nil {
+			return "", nil, err
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer res.Body.Close()
+		buf := make([]byte, 64)
+		n, _ := res.Body.Read(buf)
+		return string(buf[:n]), res.TLS, nil
+	}
+
+	_, _, err = get(client())
+	assert.NotNil(t, err, "a client certificate is required")
+
+	other := newCert(t, "other-ca", 3, nil)
+	_, _, err = get(client(newCert(t, "intruder", 4, other).tls()))
+	assert.NotNil(t, err, "the client certificate has to be signed by the CA")
+
+	body, state, err := get(client(newCert(t, "admin-panel", 5, ca).tls()))
+	require.Nil(t, err)
+	assert.EqualValues(t, "HTTP/2.0 admin-panel", body)
+	assert.EqualValues(t, "server-1", state.PeerCertificates[0].Subject.CommonName)
+
+	reloaded, err := reloader.Reload()
+	require.Nil(t, err)
+	assert.False(t, reloaded, "files have not changed")
+
+	newCert(t, "server-2", 6, ca).write(t, certFile, keyFile)
+	future := time.Now().Add(time.Minute)
+	require.Nil(t, os.Chtimes(certFile, future, future))
+	reloaded, err = reloader.Reload()
+	require.Nil(t, err)
+	assert.True(t, reloaded)
+
+	_, state, err = get(client(newCert(t, "admin-panel", 7, ca).tls()))
+	require.Nil(t, err)
+	assert.EqualValues(t, "server-2", state.PeerCertificates[0].Subject.CommonName)
+}
@@ -0,0 +1,114 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"playground/rest-api/gomasters/entity"
+	"time"
+)
+
+var (
+	// ErrMismatch is returned when a key is reused with a different request body.
+	ErrMismatch = errors.New("idempotency key reused with a different request")
+	// ErrInProgress is returned for a retry that arrives before the first request has been handled.
+	ErrInProgress = errors.New("request with the idempotency key is in progress")
+	// ErrLost is returned by Complete when the lease of the request ran out
+	// before it was handled and the key may have been taken over.
+	ErrLost = errors.New("idempotency key lease lost")
+)
+
+type Repository interface {
+	// Reserve stores r unless an unexpired request with the same key and
+	// caller exists, and returns that request instead. It returns nil when r
+	// has been stored.
+	Reserve(ctx context.Context, r *entity.IdempotentRequest) (*entity.IdempotentRequest, error)
+	// Complete stores the response of a request reserved with the same body
+	// hash, and its expiry, unless the response is stored or the lease has
+	// expired by now. It reports whether the response has been stored.
+	Complete(ctx context.Context, r *entity.IdempotentRequest, now time.Time) (bool, error)
+	// Release removes a reserved request that has no response.
+	Release(ctx context.Context, key, caller string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+type Usecase struct {
+	logger *zap.Logger
+	repo   Repository
+	ttl    time.Duration
+	lease  time.Duration
+}
+
+// NewUsecase keeps responses for ttl. A key in progress is reserved for
+// lease only, so that the key of a request that never completed, because
+// the instance handling it died, can be used again soon.
+func NewUsecase(l *zap.Logger, r Repository, ttl, lease time.Duration) *Usecase {
+	return &Usecase{
+		logger: l,
+		repo:   r,
+		ttl:    ttl,
+		lease:  lease,
+	}
+}
+
+// Begin reserves the key for the caller for the lease. It returns nil when
+// the request is new and has to be handled, and the stored request when it
+// has been handled before with the same body hash.
+func (u *Usecase) Begin(ctx context.Context, key, caller, bodyHash string) (*entity.IdempotentRequest, error) {
+	existing, err := u.repo.Reserve(ctx, entity.NewIdempotentRequest(key, caller, bodyHash, u.lease))
+	if err != nil || existing == nil {
+		return nil, err
+	}
+
+	switch {
+	case existing.BodyHash != bodyHash:
+		return nil, ErrMismatch
+	case !existing.Done():
+		return nil, ErrInProgress
+	}
+	return existing, nil
+}
+
+// Complete stores the response of a request started with Begin, it is
+// replayed for the ttl from now on. It returns ErrLost when the lease of the
+// request has run out.
+func (u *Usecase) Complete(ctx context.Context, r *entity.IdempotentRequest) error {
+	now := time.Now().UTC()
+	r.Expires = now.Add(u.ttl)
+	stored, err := u.repo.Complete(ctx, r, now)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		return ErrLost
+	}
+	return nil
+}
+
+// Release gives the key up, so that a retry is handled again.
+func (u *Usecase) Release(ctx context.Context, key, caller string) error {
+	return u.repo.Release(ctx, key, caller)
+}
+
+// Run deletes expired requests every interval until ctx is done.
+func (u *Usecase) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := u.repo.DeleteExpired(ctx, time.Now().UTC())
+		if err != nil {
+			u.logger.Error("delete expired idempotency keys error", zap.Error(err))
+			continue
+		}
+		if deleted > 0 {
+			u.logger.Info("expired idempotency keys deleted", zap.Int("count", deleted))
+		}
+	}
+}
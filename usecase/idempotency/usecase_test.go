@@ -0,0 +1,137 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/mock"
+	"testing"
+	"time"
+)
+
+func TestUsecase_Begin(t *testing.T) {
+	type expected struct {
+		Request *entity.IdempotentRequest
+		Err     error
+	}
+
+	type payload struct {
+		Existing   *entity.IdempotentRequest
+		ReserveErr error
+	}
+
+	done := &entity.IdempotentRequest{
+		Key: "key-1", Caller: "alice", BodyHash: "hash-1",
+		Status: 200, ContentType: "application/json", Body: []byte(`"created"`),
+	}
+	inProgress := &entity.IdempotentRequest{Key: "key-1", Caller: "alice", BodyHash: "hash-1"}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "new request",
+			expected: expected{},
+			payload:  payload{},
+		},
+		{
+			name:     "handled request is replayed",
+			expected: expected{Request: done},
+			payload:  payload{Existing: done},
+		},
+		{
+			name:     "request in progress",
+			expected: expected{Err: ErrInProgress},
+			payload:  payload{Existing: inProgress},
+		},
+		{
+			name:     "key reused with another body",
+			expected: expected{Err: ErrMismatch},
+			payload:  payload{Existing: &entity.IdempotentRequest{Key: "key-1", Caller: "alice", BodyHash: "hash-2", Status: 200}},
+		},
+		{
+			name:     "repository error",
+			expected: expected{Err: errors.New("reserve idempotency key error: connection reset")},
+			payload:  payload{ReserveErr: errors.New("reserve idempotency key error: connection reset")},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockRepo := mock.NewMockIdempotencyRepository(mockCtrl)
+			mockRepo.EXPECT().Reserve(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, r *entity.IdempotentRequest) (*entity.IdempotentRequest, error) {
+					assert.EqualValues(t, "key-1", r.Key)
+					assert.EqualValues(t, "alice", r.Caller)
+					assert.EqualValues(t, "hash-1", r.BodyHash)
+					assert.EqualValues(t, time.Minute, r.Expires.Sub(r.Created), "reserved for the lease")
+					return test.payload.Existing, test.payload.ReserveErr
+				}).Times(1)
+
+			usecase := NewUsecase(zap.NewNop(), mockRepo, time.Hour, time.Minute)
+			r, err := usecase.Begin(context.Background(), "key-1", "alice", "hash-1")
+
+			if test.expected.Err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.EqualValues(t, test.expected.Request, r)
+		})
+	}
+}
+
+func TestUsecase_Complete(t *testing.T) {
+	type expected struct {
+		Err error
+	}
+
+	type payload struct {
+		Stored bool
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "response stored",
+			expected: expected{},
+			payload:  payload{Stored: true},
+		},
+		{
+			name:     "lease lost",
+			expected: expected{Err: ErrLost},
+			payload:  payload{Stored: false},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			before := time.Now().UTC()
+			mockRepo := mock.NewMockIdempotencyRepository(mockCtrl)
+			mockRepo.EXPECT().Complete(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, r *entity.IdempotentRequest, now time.Time) (bool, error) {
+					assert.False(t, now.Before(before), "checked against the lease now")
+					assert.EqualValues(t, now.Add(time.Hour), r.Expires, "kept for the ttl")
+					return test.payload.Stored, nil
+				}).Times(1)
+
+			usecase := NewUsecase(zap.NewNop(), mockRepo, time.Hour, time.Minute)
+			err := usecase.Complete(context.Background(), &entity.IdempotentRequest{Key: "key-1", Caller: "alice", Status: 200})
+			assert.EqualValues(t, test.expected.Err, err)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"playground/rest-api/gomasters/entity"
+	"time"
+)
+
+type Store interface {
+	Process(limit int, publish func(*entity.Event) error) (int, error)
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, e *entity.Event) error
+}
+
+type Relay struct {
+	logger    *zap.Logger
+	store     Store
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelay(l *zap.Logger, s Store, p Publisher, interval time.Duration, batchSize int) *Relay {
+	return &Relay{
+		logger:    l,
+		store:     s,
+		publisher: p,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run polls the outbox every interval until ctx is done. A full batch means
+// more events are probably waiting, so the next batch is taken without delay.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			sent, err := r.RelayOnce(ctx)
+			if err != nil {
+				r.logger.Error("relay outbox error", zap.Error(err))
+				break
+			}
+			if sent < r.batchSize || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
+
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	sent, err := r.store.Process(r.batchSize, func(e *entity.Event) error {
+		return r.publisher.Publish(ctx, e)
+	})
+	if sent > 0 {
+		r.logger.Info("outbox events published", zap.Int("count", sent))
+	}
+
+	return sent, err
+}
@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/mock"
+	"testing"
+)
+
+func TestRelay_RelayOnce(t *testing.T) {
+	type expected struct {
+		Sent int
+		Err  error
+	}
+
+	type payload struct {
+		Events       []*entity.Event
+		GetPublisher func(*gomock.Controller) *mock.MockPublisher
+	}
+
+	events := []*entity.Event{
+		entity.NewEvent(entity.EventUserCreated, "1d2ef152-f440-4be2-b659-46cc6dcbc966", []byte(`{}`)),
+		entity.NewEvent(entity.EventUserDeleted, "1d2ef152-f440-4be2-b659-46cc6dcbc966", []byte(`{}`)),
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "all events published",
+			expected: expected{
+				Sent: 2,
+				Err:  nil,
+			},
+			payload: payload{
+				Events: events,
+				GetPublisher: func(mockCtrl *gomock.Controller) *mock.MockPublisher {
+					mockPublisher := mock.NewMockPublisher(mockCtrl)
+					mockPublisher.EXPECT().Publish(gomock.Any(), events[0]).Return(nil).Times(1)
+					mockPublisher.EXPECT().Publish(gomock.Any(), events[1]).Return(nil).Times(1)
+					return mockPublisher
+				}},
+		},
+		{
+			name: "publish error stops batch",
+			expected: expected{
+				Sent: 0,
+				Err:  errors.New("broker unavailable"),
+			},
+			payload: payload{
+				Events: events,
+				GetPublisher: func(mockCtrl *gomock.Controller) *mock.MockPublisher {
+					mockPublisher := mock.NewMockPublisher(mockCtrl)
+					mockPublisher.EXPECT().Publish(gomock.Any(), events[0]).Return(errors.New("broker unavailable")).Times(1)
+					return mockPublisher
+				}},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockStore := mock.NewMockStore(mockCtrl)
+			mockStore.EXPECT().Process(10, gomock.Any()).DoAndReturn(
+				func(_ int, publish func(*entity.Event) error) (int, error) {
+					sent := 0
+					for _, e := range test.payload.Events {
+						if err := publish(e); err != nil {
+							return sent, err
+						}
+						sent++
+					}
+					return sent, nil
+				}).Times(1)
+
+			relay := NewRelay(zap.NewNop(), mockStore, test.payload.GetPublisher(mockCtrl), 0, 10)
+			sent, err := relay.RelayOnce(context.Background())
+
+			if err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+				assert.EqualValues(t, test.expected.Sent, sent)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected.Sent, sent)
+		})
+	}
+}
@@ -1,58 +1,468 @@
 package user
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
+	"io"
 	"playground/rest-api/gomasters/entity"
+	"playground/rest-api/gomasters/requestctx"
+	"strings"
+	"time"
 )
 
 type Repository interface {
-	GetAll() ([]*entity.User, error)
-	Create(*entity.User) (string, error)
-	GetById(id string) (*entity.User, error)
-	Update(string, *entity.User) (string, error)
-	Delete(recordId string) (string, error)
+	GetAll(ctx context.Context) ([]*entity.User, error)
+	StreamAll(ctx context.Context, fn func(*entity.User) error) error
+	Create(ctx context.Context, u *entity.User) (string, error)
+	GetById(ctx context.Context, id string) (*entity.User, error)
+	// GetByIds returns the existing users among ids, in no particular order.
+	GetByIds(ctx context.Context, ids []string) ([]*entity.User, error)
+	GetByEmail(ctx context.Context, email string) (*entity.User, error)
+	Update(ctx context.Context, userId string, u *entity.User) (string, error)
+	Delete(ctx context.Context, recordId string) (string, error)
+}
+
+// BatchRepository is implemented by repositories able to execute a batch in
+// one transaction. Other repositories are driven one operation at a time.
+type BatchRepository interface {
+	Batch(ctx context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error)
+}
+
+// AuditRepository stores the audit log of user changes.
+type AuditRepository interface {
+	Save(ctx context.Context, r *entity.AuditRecord) error
+	// History returns the records of one user, oldest first.
+	History(ctx context.Context, entityId string) ([]*entity.AuditRecord, error)
+}
+
+// VersionRepository keeps every version of the users together with the time
+// it was valid.
+type VersionRepository interface {
+	// Save ends the current version of u at the given time and starts a new one.
+	Save(ctx context.Context, u *entity.User, at time.Time) error
+	// Close ends the current version of a deleted user.
+	Close(ctx context.Context, userId string, at time.Time) error
+	// AsOf returns the user as it was at the given time.
+	AsOf(ctx context.Context, userId string, at time.Time) (*entity.User, error)
+	Version(ctx context.Context, userId string, version int) (*entity.UserVersion, error)
+	// Versions returns all versions of a user, oldest first.
+	Versions(ctx context.Context, userId string) ([]*entity.UserVersion, error)
+}
+
+// TxManager groups repository calls into one transaction. WithinTx passes fn
+// a context carrying the transaction, and repositories called with that
+// context take part in it. fn may be run again after a serialization failure.
+type TxManager interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type Usecase struct {
-	repo Repository
+	repo     Repository
+	audits   AuditRepository
+	versions VersionRepository
+	tm       TxManager
 }
 
-func NewUsecase(r Repository) *Usecase {
+func NewUsecase(r Repository, a AuditRepository, v VersionRepository, tm TxManager) *Usecase {
 	return &Usecase{
-		repo: r,
+		repo: r, audits: a, versions: v, tm: tm,
 	}
 }
 
-func (u *Usecase) GetAll() ([]*entity.User, error) {
-	return u.repo.GetAll()
+func (u *Usecase) GetAll(ctx context.Context) ([]*entity.User, error) {
+	return u.repo.GetAll(ctx)
+}
+
+// Export passes users to fn one by one as they are read from the repository.
+func (u *Usecase) Export(ctx context.Context, fn func(*entity.User) error) error {
+	return u.repo.StreamAll(ctx, fn)
 }
 
-func (u *Usecase) Create(user *entity.User) (string, error) {
+// Create, Update and Delete write the change and its audit record in one
+// transaction. The actor and request ID of the record come from ctx. Create
+// and Update normalize and stamp the user they are given before writing it.
+func (u *Usecase) Create(ctx context.Context, user *entity.User) (string, error) {
+	normalize(user)
 	if err := validate(user); err != nil {
 		return "", fmt.Errorf("validation error: %v", err)
 	}
+	touch(user)
+
+	var userId string
+	err := u.tm.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		userId, err = u.create(ctx, user)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
 
-	return u.repo.Create(user)
+	return userId, nil
 }
 
-func (u *Usecase) GetById(userId string) (*entity.User, error) {
-	return u.repo.GetById(userId)
+func (u *Usecase) GetById(ctx context.Context, userId string) (*entity.User, error) {
+	return u.repo.GetById(ctx, userId)
 }
 
-func (u *Usecase) Update(userId string, user *entity.User) (string, error) {
+// GetByIds returns the existing users among userIds, in no particular order.
+func (u *Usecase) GetByIds(ctx context.Context, userIds []string) ([]*entity.User, error) {
+	return u.repo.GetByIds(ctx, userIds)
+}
+
+func (u *Usecase) Update(ctx context.Context, userId string, user *entity.User) (string, error) {
+	normalize(user)
 	if err := validate(user); err != nil {
 		return "", fmt.Errorf("validation error: %v", err)
 	}
+	touch(user)
+
+	var id string
+	err := u.tm.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := u.repo.GetById(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		id, err = u.update(ctx, before, user)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (u *Usecase) Delete(ctx context.Context, userId string) (string, error) {
+	var id string
+	err := u.tm.WithinTx(ctx, func(ctx context.Context) error {
+		before, err := u.repo.GetById(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		if id, err = u.repo.Delete(ctx, userId); err != nil {
+			return err
+		}
+		return u.record(ctx, entity.AuditDelete, before, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
 
-	return u.repo.Update(userId, user)
+// GetAsOf returns the user as it was at the given time, also when it has
+// been deleted since.
+func (u *Usecase) GetAsOf(ctx context.Context, userId string, at time.Time) (*entity.User, error) {
+	return u.versions.AsOf(ctx, userId, at)
 }
 
-func (u *Usecase) Delete(userId string) (string, error) {
-	return u.repo.Delete(userId)
+// Versions returns all versions of a user, oldest first.
+func (u *Usecase) Versions(ctx context.Context, userId string) ([]*entity.UserVersion, error) {
+	return u.versions.Versions(ctx, userId)
+}
+
+// Revert restores a previous version of a user through Update, or through
+// Create when the user has been deleted since. The restored state is
+// validated like any other change and becomes a new version.
+func (u *Usecase) Revert(ctx context.Context, userId string, version int) (string, error) {
+	var id string
+	err := u.tm.WithinTx(ctx, func(ctx context.Context) error {
+		v, err := u.versions.Version(ctx, userId, version)
+		if err != nil {
+			return err
+		}
+
+		_, err = u.repo.GetById(ctx, userId)
+		switch {
+		case err == nil:
+			id, err = u.Update(ctx, userId, v.User)
+		case errors.Is(err, entity.ErrNotFound):
+			id, err = u.Create(ctx, v.User)
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// History returns the audit records of a user, oldest first.
+func (u *Usecase) History(ctx context.Context, userId string) ([]*entity.AuditRecord, error) {
+	return u.audits.History(ctx, userId)
+}
+
+func (u *Usecase) create(ctx context.Context, user *entity.User) (string, error) {
+	userId, err := u.repo.Create(ctx, user)
+	if err != nil {
+		return "", err
+	}
+
+	return userId, u.record(ctx, entity.AuditCreate, nil, user)
+}
+
+func (u *Usecase) update(ctx context.Context, before, user *entity.User) (string, error) {
+	userId, err := u.repo.Update(ctx, before.ID, user)
+	if err != nil {
+		return "", err
+	}
+
+	return userId, u.record(ctx, entity.AuditUpdate, before, user)
+}
+
+// record writes the audit record of a change and the user version it
+// produces, both stamped with the same time.
+func (u *Usecase) record(ctx context.Context, action string, before, after *entity.User) error {
+	r, err := entity.NewAuditRecord(action, requestctx.Actor(ctx), requestctx.RequestID(ctx), before, after)
+	if err != nil {
+		return err
+	}
+	if err = u.audits.Save(ctx, r); err != nil {
+		return err
+	}
+
+	if before != nil && (after == nil || after.ID != before.ID) {
+		if err = u.versions.Close(ctx, before.ID, r.Created); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		return u.versions.Save(ctx, after, r.Created)
+	}
+	return nil
+}
+
+// Batch validates every operation individually. In atomic mode a single
+// invalid or failed operation cancels the whole batch; otherwise each
+// operation gets its own result.
+func (u *Usecase) Batch(ctx context.Context, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error) {
+	results := entity.NewBatchResults(ops)
+
+	valid := make([]*entity.BatchOperation, 0, len(ops))
+	indexes := make([]int, 0, len(ops))
+	for i, op := range ops {
+		if op.User != nil {
+			normalize(op.User)
+			touch(op.User)
+		}
+		err := validateOperation(op)
+		results[i].ID = op.ID
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		valid = append(valid, op)
+		indexes = append(indexes, i)
+	}
+
+	if atomic && len(valid) != len(ops) {
+		return results, fmt.Errorf("batch validation error: %d invalid operations", len(ops)-len(valid))
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	var repoResults []*entity.BatchResult
+	var err error
+	if br, ok := u.repo.(BatchRepository); ok {
+		repoResults, err = u.batch(ctx, br, valid, atomic)
+	} else if atomic {
+		return results, errors.New("atomic batch is not supported by repository")
+	} else {
+		repoResults = u.batchEach(ctx, valid)
+	}
+
+	for i, r := range repoResults {
+		r.Index = indexes[i]
+		results[indexes[i]] = r
+	}
+
+	return results, err
+}
+
+// batch runs the operations on the repository and writes the audit records of
+// the successful ones in the same transaction. The stored users are read once
+// before the batch and then followed through the operations, so that an
+// operation on a user changed earlier in the batch is recorded against the
+// user as that operation left it.
+func (u *Usecase) batch(ctx context.Context, br BatchRepository, ops []*entity.BatchOperation, atomic bool) ([]*entity.BatchResult, error) {
+	var results []*entity.BatchResult
+	var batchErr error
+	err := u.tm.WithinTx(ctx, func(ctx context.Context) error {
+		var ids []string
+		for _, op := range ops {
+			if op.Op != entity.BatchCreate {
+				ids = append(ids, op.ID)
+			}
+		}
+		stored, err := u.repo.GetByIds(ctx, ids)
+		if err != nil {
+			return err
+		}
+		users := make(map[string]*entity.User, len(stored))
+		for _, u := range stored {
+			users[u.ID] = u
+		}
+
+		if results, batchErr = br.Batch(ctx, ops, atomic); batchErr != nil {
+			return batchErr
+		}
+
+		for i, r := range results {
+			if r.Error != "" {
+				continue
+			}
+
+			var err error
+			op := ops[i]
+			switch op.Op {
+			case entity.BatchCreate:
+				err = u.record(ctx, entity.AuditCreate, nil, op.User)
+				users[op.User.ID] = op.User
+			case entity.BatchUpdate:
+				err = u.record(ctx, entity.AuditUpdate, users[op.ID], op.User)
+				delete(users, op.ID)
+				users[op.User.ID] = op.User
+			case entity.BatchDelete:
+				err = u.record(ctx, entity.AuditDelete, users[op.ID], nil)
+				delete(users, op.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if batchErr != nil {
+		return results, batchErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// batchEach runs the operations one by one, each in its own transaction.
+func (u *Usecase) batchEach(ctx context.Context, ops []*entity.BatchOperation) []*entity.BatchResult {
+	results := entity.NewBatchResults(ops)
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case entity.BatchCreate:
+			_, err = u.Create(ctx, op.User)
+		case entity.BatchUpdate:
+			_, err = u.Update(ctx, op.ID, op.User)
+		case entity.BatchDelete:
+			_, err = u.Delete(ctx, op.ID)
+		}
+
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	return results
+}
+
+// Import upserts every row by email: a user with the same email is updated
+// keeping its ID and Created, otherwise a new user is inserted. Invalid rows are
+// rejected and reported with their line; only a broken stream stops the import.
+// Each row is looked up and written in its own transaction.
+func (u *Usecase) Import(ctx context.Context, r entity.UserReader) (*entity.ImportReport, error) {
+	report := &entity.ImportReport{}
+	for {
+		line, user, err := r.Read()
+		if err == io.EOF {
+			return report, nil
+		}
+
+		var rowErr *entity.RowError
+		if errors.As(err, &rowErr) {
+			report.Add(&entity.ImportRow{Line: rowErr.Line, Status: entity.ImportRejected, Reason: rowErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("import read error: %v", err)
+		}
+
+		report.Add(u.importUser(ctx, line, user))
+	}
+}
+
+func (u *Usecase) importUser(ctx context.Context, line int, user *entity.User) *entity.ImportRow {
+	row := &entity.ImportRow{Line: line, Email: user.Email}
+	normalize(user)
+	if err := validate(user); err != nil {
+		row.Status, row.Reason = entity.ImportRejected, fmt.Sprintf("validation error: %v", err)
+		return row
+	}
+	row.Email = user.Email
+	touch(user)
+
+	err := u.tm.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := u.repo.GetByEmail(ctx, user.Email)
+		switch {
+		case err == nil:
+			user.ID, user.Created = existing.ID, existing.Created
+			row.Status = entity.ImportUpdated
+			_, err = u.update(ctx, existing, user)
+		case errors.Is(err, entity.ErrNotFound):
+			row.Status = entity.ImportInserted
+			_, err = u.create(ctx, user)
+		}
+		return err
+	})
+	if err != nil {
+		row.Status, row.Reason = entity.ImportRejected, err.Error()
+	}
+	return row
+}
+
+func validateOperation(op *entity.BatchOperation) error {
+	switch op.Op {
+	case entity.BatchCreate, entity.BatchUpdate:
+		if op.User == nil {
+			return fmt.Errorf("no user to %s", op.Op)
+		}
+		if op.Op == entity.BatchCreate {
+			op.ID = op.User.ID
+		}
+		if err := validate(op.User); err != nil {
+			return fmt.Errorf("validation error: %v", err)
+		}
+	case entity.BatchDelete:
+	default:
+		return fmt.Errorf("unknown batch operation: %q", op.Op)
+	}
+
+	if err := validator.New().Var(op.ID, "required,uuid"); err != nil {
+		return fmt.Errorf("validation error: invalid ID %q", op.ID)
+	}
+
+	return nil
 }
 
 func validate(user *entity.User) error {
 	v := validator.New()
 	return v.Struct(user)
 }
+
+// normalize lowercases and trims the email before it is validated, so that
+// the unique email check of the repository does not depend on case or spaces.
+func normalize(user *entity.User) {
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+}
+
+// touch stamps Updated before a write, rounded to the microseconds postgres keeps.
+func touch(user *entity.User) {
+	user.Updated = time.Now().UTC().Truncate(time.Microsecond)
+}
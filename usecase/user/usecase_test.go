@@ -1,16 +1,45 @@
 package user
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"playground/rest-api/gomasters/entity"
 	"playground/rest-api/gomasters/mock"
+	"playground/rest-api/gomasters/requestctx"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 )
 
+// newTxManager runs every transaction function directly.
+func newTxManager(mockCtrl *gomock.Controller) *mock.MockTxManager {
+	tm := mock.NewMockTxManager(mockCtrl)
+	tm.EXPECT().WithinTx(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, fn func(context.Context) error) error {
+			return fn(ctx)
+		}).AnyTimes()
+	return tm
+}
+
+// newAuditRepo accepts any audit record.
+func newAuditRepo(mockCtrl *gomock.Controller) *mock.MockAuditRepository {
+	audits := mock.NewMockAuditRepository(mockCtrl)
+	audits.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	return audits
+}
+
+// newVersionRepo accepts any saved or closed version.
+func newVersionRepo(mockCtrl *gomock.Controller) *mock.MockVersionRepository {
+	versions := mock.NewMockVersionRepository(mockCtrl)
+	versions.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	versions.EXPECT().Close(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	return versions
+}
+
 func TestUsecase_GetAll(t *testing.T) {
 	type expected struct {
 		Users []*entity.User
@@ -60,7 +89,7 @@ func TestUsecase_GetAll(t *testing.T) {
 			payload: payload{
 				GetMockRepo: func(mockCtrl *gomock.Controller, users []*entity.User, err error) *mock.MockRepository {
 					mockRepo := mock.NewMockRepository(mockCtrl)
-					mockRepo.EXPECT().GetAll().Return(users, err).Times(1)
+					mockRepo.EXPECT().GetAll(gomock.Any()).Return(users, err).Times(1)
 					return mockRepo
 				}},
 		},
@@ -72,8 +101,8 @@ func TestUsecase_GetAll(t *testing.T) {
 			defer mockCtrl.Finish()
 
 			mockRepo := test.payload.GetMockRepo(mockCtrl, test.expected.Users, test.expected.Err)
-			usecase := NewUsecase(mockRepo)
-			users, err := usecase.GetAll()
+			usecase := NewUsecase(mockRepo, newAuditRepo(mockCtrl), newVersionRepo(mockCtrl), newTxManager(mockCtrl))
+			users, err := usecase.GetAll(context.Background())
 
 			assert.Nil(t, err)
 			assert.ElementsMatch(t, users, test.expected.Users)
@@ -114,7 +143,7 @@ func TestUsecase_GetById(t *testing.T) {
 				UserId: "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c",
 				GetMockRepo: func(mockCtrl *gomock.Controller, userId string, user *entity.User, err error) *mock.MockRepository {
 					mockRepo := mock.NewMockRepository(mockCtrl)
-					mockRepo.EXPECT().GetById(userId).Return(user, err).Times(1)
+					mockRepo.EXPECT().GetById(gomock.Any(), userId).Return(user, err).Times(1)
 					return mockRepo
 				}},
 		},
@@ -126,8 +155,8 @@ func TestUsecase_GetById(t *testing.T) {
 			defer mockCtrl.Finish()
 
 			mockRepo := test.payload.GetMockRepo(mockCtrl, test.payload.UserId, test.expected.User, test.expected.Err)
-			usecase := NewUsecase(mockRepo)
-			user, err := usecase.GetById(test.payload.UserId)
+			usecase := NewUsecase(mockRepo, newAuditRepo(mockCtrl), newVersionRepo(mockCtrl), newTxManager(mockCtrl))
+			user, err := usecase.GetById(context.Background(), test.payload.UserId)
 
 			assert.Nil(t, err)
 			assert.EqualValues(t, test.expected.User, user)
@@ -159,6 +188,7 @@ func TestUsecase_Update(t *testing.T) {
 				Err: nil,
 			},
 			payload: payload{
+				UserId: "1d2ef152-f440-4be2-b659-46cc6dcbc966",
 				User: &entity.User{
 					ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
 					Firstname: "FirstUser",
@@ -168,8 +198,12 @@ func TestUsecase_Update(t *testing.T) {
 					Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
 				},
 				GetMockRepo: func(mockCtrl *gomock.Controller, userId string, user *entity.User, id string, err error) *mock.MockRepository {
+					before := *user
+					before.Firstname = "OldName"
+
 					mockRepo := mock.NewMockRepository(mockCtrl)
-					mockRepo.EXPECT().Update(userId, user).Return(id, err).Times(1)
+					mockRepo.EXPECT().GetById(gomock.Any(), userId).Return(&before, nil).Times(1)
+					mockRepo.EXPECT().Update(gomock.Any(), userId, user).Return(id, err).Times(1)
 					return mockRepo
 				}},
 		},
@@ -200,8 +234,8 @@ func TestUsecase_Update(t *testing.T) {
 			defer mockCtrl.Finish()
 
 			mockRepo := test.payload.GetMockRepo(mockCtrl, test.payload.UserId, test.payload.User, test.expected.Id, test.expected.Err)
-			usecase := NewUsecase(mockRepo)
-			resId, err := usecase.Update(test.payload.UserId, test.payload.User)
+			usecase := NewUsecase(mockRepo, newAuditRepo(mockCtrl), newVersionRepo(mockCtrl), newTxManager(mockCtrl))
+			resId, err := usecase.Update(context.Background(), test.payload.UserId, test.payload.User)
 
 			if err != nil {
 				assert.EqualError(t, err, test.expected.Err.Error())
@@ -242,7 +276,8 @@ func TestUsecase_Delete(t *testing.T) {
 				UserId: "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c",
 				GetMockRepo: func(mockCtrl *gomock.Controller, userIdIn string, userIdOut string, err error) *mock.MockRepository {
 					mockRepo := mock.NewMockRepository(mockCtrl)
-					mockRepo.EXPECT().Delete(userIdIn).Return(userIdOut, err).Times(1)
+					mockRepo.EXPECT().GetById(gomock.Any(), userIdIn).Return(&entity.User{ID: userIdIn}, nil).Times(1)
+					mockRepo.EXPECT().Delete(gomock.Any(), userIdIn).Return(userIdOut, err).Times(1)
 					return mockRepo
 				}},
 		},
@@ -254,11 +289,655 @@ func TestUsecase_Delete(t *testing.T) {
 			defer mockCtrl.Finish()
 
 			mockRepo := test.payload.GetMockRepo(mockCtrl, test.payload.UserId, test.expected.UserId, test.expected.Err)
-			usecase := NewUsecase(mockRepo)
-			userId, err := usecase.Delete(test.payload.UserId)
+			usecase := NewUsecase(mockRepo, newAuditRepo(mockCtrl), newVersionRepo(mockCtrl), newTxManager(mockCtrl))
+			userId, err := usecase.Delete(context.Background(), test.payload.UserId)
 
 			assert.Nil(t, err)
 			assert.EqualValues(t, test.expected.UserId, userId)
 		})
 	}
 }
+
+func TestUsecase_Batch(t *testing.T) {
+	type expected struct {
+		Results []*entity.BatchResult
+		Err     error
+	}
+
+	type payload struct {
+		Ops     []*entity.BatchOperation
+		Atomic  bool
+		GetRepo func(*gomock.Controller, []*entity.BatchOperation) Repository
+	}
+
+	validUser := &entity.User{
+		ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+		Firstname: "FirstUser",
+		Lastname:  "LastNameA",
+		Email:     "user1@gmail.com",
+		Age:       20,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+	invalidUser := &entity.User{
+		ID:        "f2a44f36-0956-4019-9134-bbb0a2f63b01",
+		Firstname: "ThirdUser100",
+		Lastname:  "LastNameC",
+		Email:     "user3@gmail.com",
+		Age:       22,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "per item results without batch repository",
+			expected: expected{
+				Results: []*entity.BatchResult{
+					{Index: 0, Op: entity.BatchCreate, ID: validUser.ID},
+					{Index: 1, Op: entity.BatchUpdate, ID: invalidUser.ID, Error: "validation error: Key: 'User.Firstname' Error:Field validation for 'Firstname' failed on the 'alpha' tag"},
+					{Index: 2, Op: entity.BatchDelete, ID: "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c", Error: "get user by id error: not found"},
+				},
+				Err: nil,
+			},
+			payload: payload{
+				Ops: []*entity.BatchOperation{
+					{Op: entity.BatchCreate, User: validUser},
+					{Op: entity.BatchUpdate, ID: invalidUser.ID, User: invalidUser},
+					{Op: entity.BatchDelete, ID: "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c"},
+				},
+				GetRepo: func(mockCtrl *gomock.Controller, ops []*entity.BatchOperation) Repository {
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().Create(gomock.Any(), validUser).Return(validUser.ID, nil).Times(1)
+					mockRepo.EXPECT().GetById(gomock.Any(), "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c").
+						Return(nil, fmt.Errorf("get user by id error: %w", entity.ErrNotFound)).Times(1)
+					return mockRepo
+				}},
+		},
+		{
+			name: "atomic validation error",
+			expected: expected{
+				Results: []*entity.BatchResult{
+					{Index: 0, Op: entity.BatchCreate, ID: validUser.ID},
+					{Index: 1, Op: "upsert", Error: "unknown batch operation: \"upsert\""},
+				},
+				Err: errors.New("batch validation error: 1 invalid operations"),
+			},
+			payload: payload{
+				Ops: []*entity.BatchOperation{
+					{Op: entity.BatchCreate, User: validUser},
+					{Op: "upsert", User: validUser},
+				},
+				Atomic: true,
+				GetRepo: func(mockCtrl *gomock.Controller, ops []*entity.BatchOperation) Repository {
+					return mock.NewMockRepository(mockCtrl)
+				}},
+		},
+		{
+			name: "atomic batch repository",
+			expected: expected{
+				Results: []*entity.BatchResult{
+					{Index: 0, Op: entity.BatchCreate, ID: validUser.ID},
+					{Index: 1, Op: entity.BatchDelete, ID: validUser.ID},
+				},
+				Err: nil,
+			},
+			payload: payload{
+				Ops: []*entity.BatchOperation{
+					{Op: entity.BatchCreate, User: validUser},
+					{Op: entity.BatchDelete, ID: validUser.ID},
+				},
+				Atomic: true,
+				GetRepo: func(mockCtrl *gomock.Controller, ops []*entity.BatchOperation) Repository {
+					mockBatchRepo := mock.NewMockBatchRepository(mockCtrl)
+					mockBatchRepo.EXPECT().Batch(gomock.Any(), ops, true).DoAndReturn(
+						func(_ context.Context, ops []*entity.BatchOperation, _ bool) ([]*entity.BatchResult, error) {
+							return entity.NewBatchResults(ops), nil
+						}).Times(1)
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().GetByIds(gomock.Any(), []string{validUser.ID}).Return(nil, nil).Times(1)
+					return struct {
+						*mock.MockRepository
+						*mock.MockBatchRepository
+					}{mockRepo, mockBatchRepo}
+				}},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			usecase := NewUsecase(test.payload.GetRepo(mockCtrl, test.payload.Ops), newAuditRepo(mockCtrl), newVersionRepo(mockCtrl), newTxManager(mockCtrl))
+			results, err := usecase.Batch(context.Background(), test.payload.Ops, test.payload.Atomic)
+
+			if err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+				assert.EqualValues(t, test.expected.Results, results)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected.Results, results)
+		})
+	}
+}
+
+type importRow struct {
+	Line int
+	User *entity.User
+	Err  error
+}
+
+type sliceReader struct {
+	rows []importRow
+}
+
+func (r *sliceReader) Read() (int, *entity.User, error) {
+	if len(r.rows) == 0 {
+		return 0, nil, io.EOF
+	}
+
+	row := r.rows[0]
+	r.rows = r.rows[1:]
+	return row.Line, row.User, row.Err
+}
+
+func TestUsecase_BatchAudit(t *testing.T) {
+	type record struct {
+		EntityID string
+		Action   string
+		// Firstname is the Firstname change, nil when there is none.
+		Firstname *entity.FieldChange
+	}
+
+	type expected struct {
+		Records []record
+		Closed  []string
+	}
+
+	type payload struct {
+		Stored []*entity.User
+		Ops    []*entity.BatchOperation
+	}
+
+	newUser := func(firstname string) *entity.User {
+		return &entity.User{
+			ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+			Firstname: firstname,
+			Lastname:  "LastNameA",
+			Email:     "user1@gmail.com",
+			Age:       20,
+			Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	id := newUser("").ID
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "create then delete",
+			expected: expected{
+				Records: []record{
+					{EntityID: id, Action: entity.AuditCreate},
+					{EntityID: id, Action: entity.AuditDelete},
+				},
+				Closed: []string{id},
+			},
+			payload: payload{
+				Ops: []*entity.BatchOperation{
+					{Op: entity.BatchCreate, User: newUser("FirstUser")},
+					{Op: entity.BatchDelete, ID: id},
+				},
+			},
+		},
+		{
+			name: "two updates",
+			expected: expected{
+				Records: []record{
+					{EntityID: id, Action: entity.AuditUpdate, Firstname: &entity.FieldChange{Field: "Firstname", Before: "FirstUser", After: "Second"}},
+					{EntityID: id, Action: entity.AuditUpdate, Firstname: &entity.FieldChange{Field: "Firstname", Before: "Second", After: "Third"}},
+				},
+			},
+			payload: payload{
+				Stored: []*entity.User{newUser("FirstUser")},
+				Ops: []*entity.BatchOperation{
+					{Op: entity.BatchUpdate, ID: id, User: newUser("Second")},
+					{Op: entity.BatchUpdate, ID: id, User: newUser("Third")},
+				},
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockBatchRepo := mock.NewMockBatchRepository(mockCtrl)
+			mockBatchRepo.EXPECT().Batch(gomock.Any(), test.payload.Ops, true).DoAndReturn(
+				func(_ context.Context, ops []*entity.BatchOperation, _ bool) ([]*entity.BatchResult, error) {
+					return entity.NewBatchResults(ops), nil
+				}).Times(1)
+			mockRepo := mock.NewMockRepository(mockCtrl)
+			mockRepo.EXPECT().GetByIds(gomock.Any(), gomock.Any()).Return(test.payload.Stored, nil).Times(1)
+			repo := struct {
+				*mock.MockRepository
+				*mock.MockBatchRepository
+			}{mockRepo, mockBatchRepo}
+
+			var records []record
+			audits := mock.NewMockAuditRepository(mockCtrl)
+			audits.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, r *entity.AuditRecord) error {
+					saved := record{EntityID: r.EntityID, Action: r.Action}
+					for _, c := range r.Changes {
+						if c.Field == "Firstname" && r.Action == entity.AuditUpdate {
+							saved.Firstname = c
+						}
+					}
+					records = append(records, saved)
+					return nil
+				}).AnyTimes()
+
+			var closed []string
+			versions := mock.NewMockVersionRepository(mockCtrl)
+			versions.EXPECT().Save(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			versions.EXPECT().Close(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, _ time.Time) error {
+					closed = append(closed, id)
+					return nil
+				}).AnyTimes()
+
+			usecase := NewUsecase(repo, audits, versions, newTxManager(mockCtrl))
+			_, err := usecase.Batch(context.Background(), test.payload.Ops, true)
+
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected.Records, records)
+			assert.EqualValues(t, test.expected.Closed, closed)
+		})
+	}
+}
+
+func TestUsecase_Import(t *testing.T) {
+	type expected struct {
+		Report *entity.ImportReport
+		Err    error
+	}
+
+	type payload struct {
+		Rows        []importRow
+		GetMockRepo func(*gomock.Controller) *mock.MockRepository
+	}
+
+	existing := &entity.User{
+		ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+		Firstname: "FirstUser",
+		Lastname:  "LastNameA",
+		Email:     "user1@gmail.com",
+		Age:       20,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+	updated := &entity.User{
+		ID:        "f2a44f36-0956-4019-9134-bbb0a2f63b01",
+		Firstname: "FirstUserUPD",
+		Lastname:  "LastNameA",
+		Email:     "user1@gmail.com",
+		Age:       21,
+		Created:   time.Now(),
+	}
+	inserted := &entity.User{
+		ID:        "1636c7ff-e1bc-40d1-a368-3cdbfc2dd97c",
+		Firstname: "SecondUser",
+		Lastname:  "LastNameB",
+		Email:     "user2@gmail.com",
+		Age:       21,
+		Created:   time.Now(),
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "upsert by email",
+			expected: expected{
+				Report: &entity.ImportReport{
+					Inserted: 1,
+					Updated:  1,
+					Rejected: 2,
+					Rows: []*entity.ImportRow{
+						{Line: 2, Email: "user1@gmail.com", Status: entity.ImportUpdated},
+						{Line: 3, Status: entity.ImportRejected, Reason: "invalid age \"thirty\""},
+						{Line: 4, Email: "user2@gmail.com", Status: entity.ImportInserted},
+						{Line: 5, Email: "user3", Status: entity.ImportRejected, Reason: "validation error: Key: 'User.Email' Error:Field validation for 'Email' failed on the 'email' tag"},
+					},
+				},
+				Err: nil,
+			},
+			payload: payload{
+				Rows: []importRow{
+					{Line: 2, User: updated},
+					{Line: 3, Err: &entity.RowError{Line: 3, Err: errors.New("invalid age \"thirty\"")}},
+					{Line: 4, User: inserted},
+					{Line: 5, User: &entity.User{
+						ID:        "a01c6ae7-86c1-400e-beb2-5a5c6e15785c",
+						Firstname: "ThirdUser",
+						Lastname:  "LastNameC",
+						Email:     "user3",
+						Age:       22,
+						Created:   time.Now(),
+					}},
+				},
+				GetMockRepo: func(mockCtrl *gomock.Controller) *mock.MockRepository {
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().GetByEmail(gomock.Any(), "user1@gmail.com").Return(existing, nil).Times(1)
+					mockRepo.EXPECT().Update(gomock.Any(), existing.ID, updated).DoAndReturn(
+						func(_ context.Context, id string, u *entity.User) (string, error) {
+							assert.EqualValues(t, existing.Created, u.Created)
+							return id, nil
+						}).Times(1)
+					mockRepo.EXPECT().GetByEmail(gomock.Any(), "user2@gmail.com").Return(nil, entity.ErrNotFound).Times(1)
+					mockRepo.EXPECT().Create(gomock.Any(), inserted).Return(inserted.ID, nil).Times(1)
+					return mockRepo
+				}},
+		},
+		{
+			name: "read error stops import",
+			expected: expected{
+				Report: &entity.ImportReport{},
+				Err:    errors.New("import read error: connection reset"),
+			},
+			payload: payload{
+				Rows: []importRow{
+					{Err: errors.New("connection reset")},
+				},
+				GetMockRepo: func(mockCtrl *gomock.Controller) *mock.MockRepository {
+					return mock.NewMockRepository(mockCtrl)
+				}},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			usecase := NewUsecase(test.payload.GetMockRepo(mockCtrl), newAuditRepo(mockCtrl), newVersionRepo(mockCtrl), newTxManager(mockCtrl))
+			report, err := usecase.Import(context.Background(), &sliceReader{rows: test.payload.Rows})
+
+			if err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+				assert.EqualValues(t, test.expected.Report, report)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.EqualValues(t, test.expected.Report, report)
+		})
+	}
+}
+
+func TestUsecase_Audit(t *testing.T) {
+	type expected struct {
+		Record *entity.AuditRecord
+		Err    error
+	}
+
+	type payload struct {
+		Run         func(*Usecase, context.Context) error
+		GetMockRepo func(*gomock.Controller) *mock.MockRepository
+		SaveErr     error
+	}
+
+	before := &entity.User{
+		ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+		Firstname: "FirstUser",
+		Lastname:  "LastNameA",
+		Email:     "user1@gmail.com",
+		Age:       20,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+	after := *before
+	after.Email = "changed@gmail.com"
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name: "update records the changed fields",
+			expected: expected{
+				Record: &entity.AuditRecord{
+					EntityID:  before.ID,
+					Action:    entity.AuditUpdate,
+					Actor:     "alice",
+					RequestID: "req-1",
+					Changes: []*entity.FieldChange{
+						{Field: "Email", Before: "user1@gmail.com", After: "changed@gmail.com"},
+					},
+				},
+			},
+			payload: payload{
+				Run: func(uc *Usecase, ctx context.Context) error {
+					_, err := uc.Update(ctx, before.ID, &after)
+					return err
+				},
+				GetMockRepo: func(mockCtrl *gomock.Controller) *mock.MockRepository {
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().GetById(gomock.Any(), before.ID).Return(before, nil).Times(1)
+					mockRepo.EXPECT().Update(gomock.Any(), before.ID, &after).Return(before.ID, nil).Times(1)
+					return mockRepo
+				}},
+		},
+		{
+			name: "failed audit fails the create",
+			expected: expected{
+				Record: &entity.AuditRecord{
+					EntityID:  before.ID,
+					Action:    entity.AuditCreate,
+					Actor:     "alice",
+					RequestID: "req-1",
+				},
+				Err: errors.New("save audit record error: connection reset"),
+			},
+			payload: payload{
+				Run: func(uc *Usecase, ctx context.Context) error {
+					_, err := uc.Create(ctx, before)
+					return err
+				},
+				GetMockRepo: func(mockCtrl *gomock.Controller) *mock.MockRepository {
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().Create(gomock.Any(), before).Return(before.ID, nil).Times(1)
+					return mockRepo
+				},
+				SaveErr: errors.New("save audit record error: connection reset"),
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			var saved *entity.AuditRecord
+			audits := mock.NewMockAuditRepository(mockCtrl)
+			audits.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, r *entity.AuditRecord) error {
+					saved = r
+					return test.payload.SaveErr
+				}).Times(1)
+
+			usecase := NewUsecase(test.payload.GetMockRepo(mockCtrl), audits, newVersionRepo(mockCtrl), newTxManager(mockCtrl))
+			ctx := requestctx.WithActor(requestctx.WithRequestID(context.Background(), "req-1"), "alice")
+			err := test.payload.Run(usecase, ctx)
+
+			if test.expected.Err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+			} else {
+				assert.Nil(t, err)
+			}
+
+			if !assert.NotNil(t, saved) {
+				return
+			}
+			assert.EqualValues(t, test.expected.Record.EntityID, saved.EntityID)
+			assert.EqualValues(t, test.expected.Record.Action, saved.Action)
+			assert.EqualValues(t, test.expected.Record.Actor, saved.Actor)
+			assert.EqualValues(t, test.expected.Record.RequestID, saved.RequestID)
+			if test.expected.Record.Changes != nil {
+				assert.EqualValues(t, test.expected.Record.Changes, saved.Changes)
+			}
+		})
+	}
+}
+
+func TestUsecase_Revert(t *testing.T) {
+	type expected struct {
+		ID  string
+		Err error
+	}
+
+	type payload struct {
+		Version     int
+		GetMockRepo func(*gomock.Controller) *mock.MockRepository
+	}
+
+	stored := &entity.User{
+		ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+		Firstname: "FirstUser",
+		Lastname:  "LastNameA",
+		Email:     "user1@gmail.com",
+		Age:       20,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+	first := *stored
+	first.Age = 19
+	invalid := *stored
+	invalid.Firstname = "F"
+
+	versions := map[int]*entity.UserVersion{
+		1: {Version: 1, User: &first},
+		2: {Version: 2, User: &invalid},
+	}
+
+	tc := []struct {
+		name     string
+		expected expected
+		payload  payload
+	}{
+		{
+			name:     "existing user is updated",
+			expected: expected{ID: stored.ID},
+			payload: payload{
+				Version: 1,
+				GetMockRepo: func(mockCtrl *gomock.Controller) *mock.MockRepository {
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().GetById(gomock.Any(), stored.ID).Return(stored, nil).Times(2)
+					mockRepo.EXPECT().Update(gomock.Any(), stored.ID, &first).Return(stored.ID, nil).Times(1)
+					return mockRepo
+				}},
+		},
+		{
+			name:     "deleted user is created again",
+			expected: expected{ID: stored.ID},
+			payload: payload{
+				Version: 1,
+				GetMockRepo: func(mockCtrl *gomock.Controller) *mock.MockRepository {
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().GetById(gomock.Any(), stored.ID).Return(nil, entity.ErrNotFound).Times(1)
+					mockRepo.EXPECT().Create(gomock.Any(), &first).Return(stored.ID, nil).Times(1)
+					return mockRepo
+				}},
+		},
+		{
+			name:     "invalid version is rejected",
+			expected: expected{Err: errors.New("validation error: Key: 'User.Firstname' Error:Field validation for 'Firstname' failed on the 'min' tag")},
+			payload: payload{
+				Version: 2,
+				GetMockRepo: func(mockCtrl *gomock.Controller) *mock.MockRepository {
+					mockRepo := mock.NewMockRepository(mockCtrl)
+					mockRepo.EXPECT().GetById(gomock.Any(), stored.ID).Return(stored, nil).Times(1)
+					return mockRepo
+				}},
+		},
+		{
+			name:     "unknown version",
+			expected: expected{Err: fmt.Errorf("get user version 3 error: %w", entity.ErrNotFound)},
+			payload: payload{
+				Version:     3,
+				GetMockRepo: mock.NewMockRepository,
+			},
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockVersions := newVersionRepo(mockCtrl)
+			mockVersions.EXPECT().Version(gomock.Any(), stored.ID, test.payload.Version).DoAndReturn(
+				func(_ context.Context, _ string, version int) (*entity.UserVersion, error) {
+					if v, ok := versions[version]; ok {
+						return v, nil
+					}
+					return nil, fmt.Errorf("get user version %d error: %w", version, entity.ErrNotFound)
+				}).Times(1)
+
+			usecase := NewUsecase(test.payload.GetMockRepo(mockCtrl), newAuditRepo(mockCtrl), mockVersions, newTxManager(mockCtrl))
+			userId, err := usecase.Revert(context.Background(), stored.ID, test.payload.Version)
+
+			if test.expected.Err != nil {
+				assert.EqualError(t, err, test.expected.Err.Error())
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.EqualValues(t, test.expected.ID, userId)
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tc := []struct {
+		name     string
+		email    string
+		expected string
+	}{
+		{name: "already normalized", email: "user1@gmail.com", expected: "user1@gmail.com"},
+		{name: "upper case", email: "User1@GMail.com", expected: "user1@gmail.com"},
+		{name: "spaces", email: "\t user1@gmail.com \n", expected: "user1@gmail.com"},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			user := &entity.User{Email: test.email}
+			normalize(user)
+			assert.EqualValues(t, test.expected, user.Email)
+		})
+	}
+}
+
+func TestValidate_DoesNotChangeTheUser(t *testing.T) {
+	user := entity.User{
+		ID:        "1d2ef152-f440-4be2-b659-46cc6dcbc966",
+		Firstname: "FirstUser",
+		Lastname:  "LastNameA",
+		Email:     "user1@gmail.com",
+		Age:       20,
+		Created:   time.Date(2022, time.Month(5), 7, 0, 0, 0, 0, time.UTC),
+	}
+	before := user
+
+	assert.Nil(t, validate(&user))
+	assert.EqualValues(t, before, user)
+}